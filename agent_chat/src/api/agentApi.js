@@ -18,8 +18,36 @@ export async function createAgent(payload) {
   return res.json();
 }
 
-export async function listAgent() {
-  const res = await fetch("https://agent.chat.app:6121/v1/agents", {
+// listAgent fetches one page of agents. The server answers with
+// { results, total, next_cursor }; pass next_cursor back as cursor to get
+// the following page. Other params (q, provider, model, tags, sort, ...)
+// filter and order the listing.
+export async function listAgent({ cursor, limit = 24, ...filters } = {}) {
+  const params = new URLSearchParams({ limit: String(limit) });
+  if (cursor) params.set("cursor", cursor);
+  for (const [key, value] of Object.entries(filters)) {
+    if (value) params.set(key, Array.isArray(value) ? value.join(",") : value);
+  }
+  const res = await fetch(`https://agent.chat.app:6121/v1/agents?${params}`, {
+    method: "GET",
+    headers: {
+      "Content-Type": "application/json",
+    },
+  });
+  if (!res.ok) {
+    let message;
+    try {
+      message = await res.text();
+    } catch {
+      message = `Failed with status ${res.status}`;
+    }
+    throw new Error(message);
+  }
+  return res.json();
+}
+
+export async function getAgent(agentId) {
+  const res = await fetch(`https://agent.chat.app:6121/v1/agents/${agentId}`, {
     method: "GET",
     headers: {
       "Content-Type": "application/json",
@@ -37,6 +65,42 @@ export async function listAgent() {
   return res.json();
 }
 
+// updateAgent sends only the changed fields; the server keeps the rest.
+export async function updateAgent(agentId, changes) {
+  const res = await fetch(`https://agent.chat.app:6121/v1/agents/${agentId}`, {
+    method: "PATCH",
+    headers: {
+      "Content-Type": "application/json",
+    },
+    body: JSON.stringify(changes),
+  });
+  if (!res.ok) {
+    let message;
+    try {
+      message = await res.text();
+    } catch {
+      message = `Failed with status ${res.status}`;
+    }
+    throw new Error(message);
+  }
+  return res.json();
+}
+
+export async function deleteAgent(agentId) {
+  const res = await fetch(`https://agent.chat.app:6121/v1/agents/${agentId}`, {
+    method: "DELETE",
+  });
+  if (!res.ok) {
+    let message;
+    try {
+      message = await res.text();
+    } catch {
+      message = `Failed with status ${res.status}`;
+    }
+    throw new Error(message);
+  }
+}
+
 export function parseFeatureConfig(str) {
   // Try to parse as JSON. Fallback to empty object
   try {
@@ -20,4 +20,63 @@ export async function createCredential({ name, provider_id, meta_data, api_key }
     throw new Error(msg);
   }
   return res.json();
-}
\ No newline at end of file
+}
+
+// Secrets come back masked from every credential endpoint.
+export async function listCredentials() {
+  const res = await fetch("https://agent.chat.app:6121/v1/credentials", {
+    method: "GET",
+    headers: {
+      "Content-Type": "application/json",
+    },
+  });
+
+  if (!res.ok) {
+    const msg = await res.text();
+    throw new Error(msg);
+  }
+  return res.json();
+}
+
+export async function getCredential(credentialId) {
+  const res = await fetch(`https://agent.chat.app:6121/v1/credentials/${credentialId}`, {
+    method: "GET",
+    headers: {
+      "Content-Type": "application/json",
+    },
+  });
+
+  if (!res.ok) {
+    const msg = await res.text();
+    throw new Error(msg);
+  }
+  return res.json();
+}
+
+// rotateCredential swaps the api key; the credential keeps its id.
+export async function rotateCredential(credentialId, api_key) {
+  const res = await fetch(`https://agent.chat.app:6121/v1/credentials/${credentialId}/rotate`, {
+    method: "POST",
+    headers: {
+      "Content-Type": "application/json",
+    },
+    body: JSON.stringify({ credentials: { api_key } }),
+  });
+
+  if (!res.ok) {
+    const msg = await res.text();
+    throw new Error(msg);
+  }
+  return res.json();
+}
+
+export async function deleteCredential(credentialId) {
+  const res = await fetch(`https://agent.chat.app:6121/v1/credentials/${credentialId}`, {
+    method: "DELETE",
+  });
+
+  if (!res.ok) {
+    const msg = await res.text();
+    throw new Error(msg);
+  }
+}
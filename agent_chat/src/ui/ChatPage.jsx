@@ -63,24 +63,48 @@ export default function ChatPage({ agent }) {
           timestamp: new Date(),
         },
       ]);
-      wsRef.current.send(JSON.stringify({}));
+      wsRef.current.send(JSON.stringify({ agent_id: agent._id }));
     };
 
     ws.onmessage = (event) => {
       try {
         // Assuming server sends plain text messages; if JSON, parse accordingly
         const data = event.data;
-        const { from, text } = JSON.parse(data);
-        // Add new message from agent
+        const { type, id, client_id, message_id, parent_id, from, text } = JSON.parse(data);
+        // The server acknowledges each stored message with its persisted id
+        if (type === "ack") {
+          setMessages((prev) =>
+            prev.map((m) =>
+              m.id === client_id ? { ...m, serverId: message_id, delivered: true } : m
+            )
+          );
+          return;
+        }
+        // A draft is the agent answer to parent_id so far; it grows until the answer arrives
+        if (type === "draft") {
+          const draftId = "draft-" + parent_id;
+          setMessages((prev) =>
+            prev.some((m) => m.id === draftId)
+              ? prev.map((m) => (m.id === draftId ? { ...m, text } : m))
+              : [...prev, { id: draftId, from: "agent", text, timestamp: new Date() }]
+          );
+          return;
+        }
+        // Other protocol frames (session, receipts, ...) carry a type; chat messages do not
+        if (type) return;
+        // Add new message from agent, in place of its draft
         setMessages((prev) => [
-          ...prev,
+          ...prev.filter((m) => !parent_id || m.id !== "draft-" + parent_id),
           {
-            id: (Date.now() + Math.random()).toString(),
+            id: id || (Date.now() + Math.random()).toString(),
             from: from,
             text: text,
             timestamp: new Date(),
           },
         ]);
+        if (id && document.visibilityState === "visible") {
+          ws.send(JSON.stringify({ type: "read", message_id: id }));
+        }
       } catch (e) {
         console.error("Error parsing message:", e);
       }
@@ -277,6 +301,7 @@ export default function ChatPage({ agent }) {
                     hour: "2-digit",
                     minute: "2-digit",
                   })}
+                  {isUser && msg.delivered && " ✓"}
                 </Typography>
               )}
             </Box>
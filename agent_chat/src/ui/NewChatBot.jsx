@@ -18,7 +18,6 @@ export default function AgentCreationForm() {
   const [description, setDescription] = useState("");
   const [features, setFeatures] = useState([]);
   const [tools, setTools] = useState([]);
-  const [llmCredentialId, setLlmCredentialId] = useState("");
   const [providerId, setProviderId] = useState("");
   const [model, setModel] = useState("");
   const [topP, setTopP] = useState(0.95);
@@ -77,19 +76,12 @@ export default function AgentCreationForm() {
   const addTool = () => setTools([...tools, ""]);
   const removeTool = (idx) => setTools(tools.filter((_, i) => i !== idx));
 
-  // Function to handle when a new credential is successfully created
-  const handleCredentialCreated = (newCredential) => {
-    // Add the new credential to the existing options
-    setCredentialOptions(prevOptions => [
-      ...prevOptions,
-      {
-        id: newCredential.id,  // Make sure your API returns an id field
-        name: newCredential.name || `Credential ${newCredential.id}`
-      }
-    ]);
-    
-    // Optionally select the newly created credential
-    setLlmCredentialId(newCredential.id);
+  // Use a created or picked credential for the agent
+  const handleCredentialSelected = (credential) => {
+    setLlmCredentials({
+      id: credential.id,
+      display: credential.name || `Credential ${credential.id}`,
+    });
   };
 
   // Submit
@@ -129,14 +121,14 @@ export default function AgentCreationForm() {
             Create a Lyzr Agent
           </Typography>
           
-          {/* <Button 
-            variant="outlined" 
+          <Button
+            variant="outlined"
             onClick={() => setIsCredentialModalOpen(true)}
             sx={{ mb: 3 }}
             startIcon={<AddCircleIcon />}
           >
-            Add New Credentials
-          </Button> */}
+            Manage Credentials
+          </Button>
 
           <TextField
             fullWidth
@@ -297,7 +289,8 @@ export default function AgentCreationForm() {
           <CreateCredentialsModal 
             open={isCredentialModalOpen}
             onClose={() => setIsCredentialModalOpen(false)}
-            onSuccess={handleCredentialCreated}
+            onSuccess={handleCredentialSelected}
+            onSelect={handleCredentialSelected}
           />
 
           <Box sx={{ mt: 4, display: 'flex', justifyContent: 'flex-end' }}>
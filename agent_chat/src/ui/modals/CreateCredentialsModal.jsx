@@ -1,5 +1,5 @@
 import React, { useState } from "react";
-import { useMutation } from "@tanstack/react-query";
+import { useMutation, useQuery, useQueryClient } from "@tanstack/react-query";
 import Modal from "@mui/material/Modal";
 import Box from "@mui/material/Box";
 import Typography from "@mui/material/Typography";
@@ -7,7 +7,19 @@ import Button from "@mui/material/Button";
 import TextField from "@mui/material/TextField";
 import IconButton from "@mui/material/IconButton";
 import CloseIcon from "@mui/icons-material/Close";
-import { createCredential } from "../../api/credentialsApi";
+import List from "@mui/material/List";
+import ListItem from "@mui/material/ListItem";
+import ListItemButton from "@mui/material/ListItemButton";
+import ListItemText from "@mui/material/ListItemText";
+import Divider from "@mui/material/Divider";
+import Alert from "@mui/material/Alert";
+import {
+  createCredential,
+  listCredentials,
+  getCredential,
+  rotateCredential,
+  deleteCredential,
+} from "../../api/credentialsApi";
 
 const style = {
   position: 'absolute',
@@ -16,21 +28,81 @@ const style = {
   transform: 'translate(-50%, -50%)',
   minWidth: 375,
   maxWidth: 450,
+  maxHeight: '90vh',
+  overflowY: 'auto',
   bgcolor: 'background.paper',
   borderRadius: 2,
   boxShadow: 24,
   p: 4,
 };
 
-export default function CredentialModal({ open, onClose, onSuccess }) {
+// CredentialDetails shows one credential; secrets arrive masked.
+function CredentialDetails({ credentialId }) {
+  const { data, isLoading, isError } = useQuery({
+    queryKey: ["credential", credentialId],
+    queryFn: () => getCredential(credentialId),
+  });
+  if (isLoading) return <Typography variant="body2">Loading...</Typography>;
+  if (isError) return <Alert severity="error">Unable to load the credential.</Alert>;
+  return (
+    <Box sx={{ pl: 2, pb: 1 }}>
+      {Object.entries(data.credentials || {}).map(([key, value]) => (
+        <Typography key={key} variant="body2" color="text.secondary">
+          {key}: {String(value)}
+        </Typography>
+      ))}
+      {data.meta_data && Object.keys(data.meta_data).length > 0 && (
+        <Typography variant="body2" color="text.secondary">
+          meta data: {JSON.stringify(data.meta_data)}
+        </Typography>
+      )}
+    </Box>
+  );
+}
+
+export default function CredentialModal({ open, onClose, onSuccess, onSelect }) {
+  const queryClient = useQueryClient();
+  const [expanded, setExpanded] = useState(null);
   const [name, setName] = useState("");
   const [providerId, setProviderId] = useState("");
   const [apiKey, setApiKey] = useState("");
   const [metaData, setMetaData] = useState("{}");
 
+  const credentials = useQuery({
+    queryKey: ["credentials"],
+    queryFn: listCredentials,
+    enabled: open,
+  });
+  const refresh = () => {
+    queryClient.invalidateQueries({ queryKey: ["credentials"] });
+    queryClient.invalidateQueries({ queryKey: ["credential"] });
+  };
+  const rotateMutation = useMutation({
+    mutationFn: ({ id, apiKey }) => rotateCredential(id, apiKey),
+    onSuccess: refresh,
+    onError: error => alert("Rotation failed: " + error.message),
+  });
+  const deleteMutation = useMutation({
+    mutationFn: deleteCredential,
+    onSuccess: refresh,
+    onError: error => alert("Delete failed: " + error.message),
+  });
+
+  const handleRotate = (credential) => {
+    const apiKey = window.prompt(`New API key for ${credential.name}`);
+    if (apiKey) rotateMutation.mutate({ id: credential.id, apiKey });
+  };
+
+  const handleDelete = (credential) => {
+    if (window.confirm(`Delete ${credential.name}? Agents using it will stop working.`)) {
+      deleteMutation.mutate(credential.id);
+    }
+  };
+
   const mutation = useMutation({
     mutationFn: values => createCredential(values),
     onSuccess: (data) => {
+      refresh();
       // Reset form fields
       setName("");
       setProviderId("");
@@ -55,10 +127,45 @@ export default function CredentialModal({ open, onClose, onSuccess }) {
       <Box sx={style}>
         <Box sx={{ display: "flex", justifyContent: "space-between", alignItems: "center", mb: 2 }}>
           <Typography id="credential-modal-title" variant="h6" component="h2">
-            Add LLM Credential
+            LLM Credentials
           </Typography>
           <IconButton onClick={onClose}><CloseIcon /></IconButton>
         </Box>
+        {credentials.isError && <Alert severity="error">Unable to load credentials.</Alert>}
+        {credentials.data?.length === 0 && (
+          <Typography variant="body2" color="text.secondary">No credentials yet.</Typography>
+        )}
+        <List dense>
+          {(credentials.data || []).map(credential => (
+            <React.Fragment key={credential.id}>
+              <ListItem
+                disablePadding
+                secondaryAction={
+                  <Box>
+                    {onSelect && (
+                      <Button size="small" onClick={() => { onSelect(credential); onClose(); }}>
+                        Use
+                      </Button>
+                    )}
+                    <Button size="small" onClick={() => handleRotate(credential)} disabled={rotateMutation.isPending}>
+                      Rotate
+                    </Button>
+                    <Button size="small" color="error" onClick={() => handleDelete(credential)} disabled={deleteMutation.isPending}>
+                      Delete
+                    </Button>
+                  </Box>
+                }
+              >
+                <ListItemButton onClick={() => setExpanded(expanded === credential.id ? null : credential.id)}>
+                  <ListItemText primary={credential.name} secondary={credential.provider_id} />
+                </ListItemButton>
+              </ListItem>
+              {expanded === credential.id && <CredentialDetails credentialId={credential.id} />}
+            </React.Fragment>
+          ))}
+        </List>
+        <Divider sx={{ my: 2 }} />
+        <Typography variant="subtitle1">Add LLM Credential</Typography>
         <form onSubmit={e => {
           e.preventDefault();
           e.stopPropagation();
@@ -0,0 +1,143 @@
+import React, { useEffect, useState } from "react";
+import { useMutation, useQuery, useQueryClient } from "@tanstack/react-query";
+import Modal from "@mui/material/Modal";
+import Box from "@mui/material/Box";
+import Typography from "@mui/material/Typography";
+import Button from "@mui/material/Button";
+import TextField from "@mui/material/TextField";
+import IconButton from "@mui/material/IconButton";
+import CircularProgress from "@mui/material/CircularProgress";
+import Alert from "@mui/material/Alert";
+import CloseIcon from "@mui/icons-material/Close";
+import { getAgent, updateAgent } from "../../api/agentApi";
+
+const style = {
+  position: 'absolute',
+  top: '50%',
+  left: '50%',
+  transform: 'translate(-50%, -50%)',
+  minWidth: 375,
+  maxWidth: 560,
+  maxHeight: '90vh',
+  overflowY: 'auto',
+  bgcolor: 'background.paper',
+  borderRadius: 2,
+  boxShadow: 24,
+  p: 4,
+};
+
+// fromAgent maps an agent as the server returns it to the form fields.
+function fromAgent(agent) {
+  return {
+    name: agent.name ?? "",
+    description: agent.description ?? "",
+    system_prompt: agent.agent_instructions ?? "",
+    model: agent.model ?? "",
+    temperature: String(agent.temperature ?? 0),
+    top_p: String(agent.top_p ?? 0),
+  };
+}
+
+// changedFields returns the fields that differ from the loaded agent, so
+// the update leaves everything else as it is.
+function changedFields(initial, form) {
+  const changes = {};
+  for (const key of Object.keys(form)) {
+    if (form[key] === initial[key]) continue;
+    changes[key] = key === "temperature" || key === "top_p" ? Number(form[key]) : form[key];
+  }
+  return changes;
+}
+
+export default function EditAgentModal({ agentId, open, onClose }) {
+  const queryClient = useQueryClient();
+  const { data: agent, isLoading, isError } = useQuery({
+    queryKey: ["agent", agentId],
+    queryFn: () => getAgent(agentId),
+    enabled: open && !!agentId,
+  });
+  const [form, setForm] = useState(null);
+
+  useEffect(() => {
+    if (agent) setForm(fromAgent(agent));
+  }, [agent]);
+
+  const mutation = useMutation({
+    mutationFn: changes => updateAgent(agentId, changes),
+    onSuccess: () => {
+      queryClient.invalidateQueries({ queryKey: ["agents"] });
+      queryClient.invalidateQueries({ queryKey: ["agent", agentId] });
+      onClose();
+    },
+    onError: error => {
+      alert("Failed: " + error.message);
+    }
+  });
+
+  const field = key => ({
+    value: form[key],
+    onChange: e => setForm({ ...form, [key]: e.target.value }),
+    fullWidth: true,
+    margin: "normal",
+  });
+
+  return (
+    <Modal open={open} onClose={onClose} aria-labelledby="edit-agent-modal-title">
+      <Box sx={style}>
+        <Box sx={{ display: "flex", justifyContent: "space-between", alignItems: "center", mb: 2 }}>
+          <Typography id="edit-agent-modal-title" variant="h6" component="h2">
+            Edit Agent
+          </Typography>
+          <IconButton onClick={onClose}><CloseIcon /></IconButton>
+        </Box>
+        {isLoading && (
+          <Box sx={{ py: 4, textAlign: "center" }}>
+            <CircularProgress />
+          </Box>
+        )}
+        {isError && <Alert severity="error">Unable to load the agent.</Alert>}
+        {form && (
+          <form onSubmit={e => {
+            e.preventDefault();
+            e.stopPropagation();
+            const changes = changedFields(fromAgent(agent), form);
+            if (Object.keys(changes).length === 0) {
+              onClose();
+              return;
+            }
+            mutation.mutate(changes);
+          }}>
+            <TextField label="Name" required {...field("name")} />
+            <TextField label="Description" {...field("description")} />
+            <TextField label="System Prompt" required multiline minRows={3} {...field("system_prompt")} />
+            <TextField label="Model" required {...field("model")} />
+            <TextField
+              label="Temperature"
+              type="number"
+              inputProps={{ min: 0, max: 2, step: 0.1 }}
+              required
+              {...field("temperature")}
+            />
+            <TextField
+              label="Top P"
+              type="number"
+              inputProps={{ min: 0, max: 1, step: 0.05 }}
+              required
+              {...field("top_p")}
+            />
+            <Button
+              variant="contained"
+              color="primary"
+              type="submit"
+              fullWidth
+              sx={{ mt: 2 }}
+              disabled={mutation.isPending}
+            >
+              {mutation.isPending ? "Saving..." : "Save"}
+            </Button>
+          </form>
+        )}
+      </Box>
+    </Modal>
+  );
+}
@@ -8,11 +8,19 @@ import {
   Alert,
   Avatar,
   Modal,
+  Button,
+  TextField,
 } from "@mui/material";
-import { useQuery } from "@tanstack/react-query";
+import {
+  keepPreviousData,
+  useInfiniteQuery,
+  useMutation,
+  useQueryClient,
+} from "@tanstack/react-query";
 import AgentMenu from "../common/AgentMenu";
 import ChatPage from "../ChatPage"; // Adjust path as required
-import { listAgent } from "../../api/agentApi"; // Your API function
+import EditAgentModal from "../modals/EditAgentModal";
+import { listAgent, deleteAgent } from "../../api/agentApi"; // Your API function
 
 // Utility to split array into chunks (for grid layout)
 function chunkArray(arr, size) {
@@ -35,13 +43,44 @@ function getInitials(name) {
 }
 
 export function AgentListPage() {
-  const { data: agents, isLoading, isError } = useQuery({
-    queryKey: ["agents"],
-    queryFn: listAgent,
+  const [search, setSearch] = React.useState("");
+  const [query, setQuery] = React.useState("");
+
+  // Search once typing pauses rather than on every keystroke
+  React.useEffect(() => {
+    const timer = setTimeout(() => setQuery(search.trim()), 300);
+    return () => clearTimeout(timer);
+  }, [search]);
+
+  const {
+    data,
+    isLoading,
+    isError,
+    fetchNextPage,
+    hasNextPage,
+    isFetchingNextPage,
+  } = useInfiniteQuery({
+    queryKey: ["agents", query],
+    queryFn: ({ pageParam }) =>
+      listAgent({ cursor: pageParam, q: query, sort: "name" }),
+    initialPageParam: undefined,
+    getNextPageParam: (lastPage) => lastPage.next_cursor ?? undefined,
+    // keep showing the current agents while a new search loads
+    placeholderData: keepPreviousData,
+  });
+  const agents = data?.pages.flatMap((page) => page.results) ?? [];
+  const total = data?.pages[0]?.total ?? 0;
+
+  const queryClient = useQueryClient();
+  const deleteMutation = useMutation({
+    mutationFn: deleteAgent,
+    onSuccess: () => queryClient.invalidateQueries({ queryKey: ["agents"] }),
+    onError: (err) => window.alert(`Could not delete agent: ${err.message}`),
   });
 
-  const agentsChunks = agents ? chunkArray(agents, 3) : [];
+  const agentsChunks = chunkArray(agents, 3);
 
+  const [editingAgentId, setEditingAgentId] = React.useState(null);
   const [activeAgentForWidget, setActiveAgentForWidget] = React.useState(null);
   const [chatOpen, setChatOpen] = React.useState(false);
 
@@ -148,11 +187,13 @@ export function AgentListPage() {
 
   // Handler functions for Edit, Delete, Duplicate
   const handleEdit = (agentId) => {
-    console.log("Edit agent:", agentId);
+    setEditingAgentId(agentId);
   };
 
   const handleDelete = (agentId) => {
-    console.log("Delete agent:", agentId);
+    if (window.confirm("Delete this agent? This cannot be undone.")) {
+      deleteMutation.mutate(agentId);
+    }
   };
 
   const handleDuplicate = (agentId) => {
@@ -183,14 +224,6 @@ export function AgentListPage() {
     );
   }
 
-  if (!agents || agents.length === 0) {
-    return (
-      <Box sx={{ py: 4, textAlign: "center" }}>
-        <Typography>No agents found.</Typography>
-      </Box>
-    );
-  }
-
   return (
     <Box
       sx={{
@@ -207,9 +240,31 @@ export function AgentListPage() {
           px: { xs: 2, sm: 3, md: 6 },
         }}
       >
-        <Typography variant="h4" fontWeight={700} mb={4} color="text.primary">
-          Agents
-        </Typography>
+        <Box
+          sx={{
+            display: "flex",
+            alignItems: "center",
+            justifyContent: "space-between",
+            gap: 2,
+            mb: 4,
+          }}
+        >
+          <Typography variant="h4" fontWeight={700} color="text.primary">
+            Agents
+          </Typography>
+          <TextField
+            size="small"
+            placeholder="Search agents"
+            value={search}
+            onChange={(e) => setSearch(e.target.value)}
+          />
+        </Box>
+
+        {agents.length === 0 && (
+          <Box sx={{ py: 4, textAlign: "center" }}>
+            <Typography>No agents found.</Typography>
+          </Box>
+        )}
 
         {agentsChunks.map((chunk, idx) => (
           <Grid container spacing={4} key={`row-${idx}`} sx={{ mb: 2 }}>
@@ -279,6 +334,30 @@ export function AgentListPage() {
           </Grid>
         ))}
 
+        {agents.length > 0 && (
+          <Box sx={{ mt: 2, textAlign: "center" }}>
+            <Typography variant="body2" color="text.secondary" mb={1}>
+              Showing {agents.length} of {total}
+            </Typography>
+            {hasNextPage && (
+              <Button
+                variant="outlined"
+                onClick={() => fetchNextPage()}
+                disabled={isFetchingNextPage}
+              >
+                {isFetchingNextPage ? "Loading..." : "Load more"}
+              </Button>
+            )}
+          </Box>
+        )}
+
+        <EditAgentModal
+          key={editingAgentId}
+          agentId={editingAgentId}
+          open={!!editingAgentId}
+          onClose={() => setEditingAgentId(null)}
+        />
+
         {/* Draggable Floating Chat Widget */}
         {activeAgentForWidget && (
           <Box
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	models "github.com/sdutt/agentserver/models/agents"
+	"github.com/sdutt/agentserver/pkg/mirror"
+	"github.com/sdutt/agentserver/pkg/providers"
+	"github.com/sdutt/agentserver/repository"
+)
+
+// mirrorCreated copies a new agent into the mirror, owned by the workspace
+// it was created for, if any.
+func (api *agentApi) mirrorCreated(c *gin.Context, agentID, workspaceID string) {
+	ctx := c.Request.Context()
+	if err := api.mirror.Refresh(ctx, agentID); err != nil {
+		log.Printf("Unable to mirror agent %s: %v", agentID, err)
+		return
+	}
+	if workspaceID != "" {
+		if _, err := api.mirror.SetMetadata(ctx, agentID, mirror.Metadata{WorkspaceID: workspaceID}); err != nil {
+			log.Printf("Unable to set the workspace of agent %s: %v", agentID, err)
+		}
+	}
+}
+
+// SyncAgents reconciles the mirror now and returns the report. The report
+// names the providers that could not be listed, if any.
+func (api *agentApi) SyncAgents(c *gin.Context) {
+	report, err := api.mirror.Sync(c.Request.Context(), models.SyncManual)
+	var partial *providers.ListError
+	if err != nil && !errors.As(err, &partial) {
+		writeLyzrError(c, err, "agent")
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// ListSyncs reports the latest syncs, newest first, with the agents each
+// found changed outside the app.
+func (api *agentApi) ListSyncs(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive number"})
+		return
+	}
+	syncs, err := api.mirror.Syncs(c.Request.Context(), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, syncs)
+}
+
+// SetMetadata replaces the owner, workspace and tags of an agent.
+func (api *agentApi) SetMetadata(c *gin.Context) {
+	var metadata mirror.Metadata
+	if err := c.ShouldBindJSON(&metadata); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON: " + err.Error()})
+		return
+	}
+	agent, err := api.mirror.SetMetadata(c.Request.Context(), c.Param("id"), metadata)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, agent)
+}
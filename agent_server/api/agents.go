@@ -1,10 +1,16 @@
 package api
 
 import (
+	"encoding/base64"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"io"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
@@ -12,50 +18,312 @@ import (
 	clients "github.com/sdutt/agentserver/clients/lyzr"
 	"github.com/sdutt/agentserver/configs"
 	lyzr "github.com/sdutt/agentserver/models/lyzr"
+	webhookmodels "github.com/sdutt/agentserver/models/webhooks"
+	"github.com/sdutt/agentserver/pkg/cache"
+	"github.com/sdutt/agentserver/pkg/chat"
+	"github.com/sdutt/agentserver/pkg/mirror"
+	"github.com/sdutt/agentserver/pkg/providers"
+	"github.com/sdutt/agentserver/pkg/webhooks"
+	"github.com/sdutt/agentserver/repository"
 )
 
 type agentApi struct {
-	config     *configs.AppConfig
-	lyzrClient *clients.LyzrClient
-	ws         *webtransport.Server
+	config    *configs.AppConfig
+	providers *providers.Registry
+	mirror    *mirror.Mirror
+	ws        *webtransport.Server
+	chat      *chat.Service
+	webhooks  *webhooks.Dispatcher
 }
 
-func NewAgentApi(config *configs.AppConfig, lyzr_client *clients.LyzrClient, ws *webtransport.Server) *agentApi {
-	return &agentApi{config, lyzr_client, ws}
+func NewAgentApi(config *configs.AppConfig, registry *providers.Registry, agentMirror *mirror.Mirror, ws *webtransport.Server, chatService *chat.Service, dispatcher *webhooks.Dispatcher) *agentApi {
+	return &agentApi{config, registry, agentMirror, ws, chatService, dispatcher}
+}
+
+// createAgentPayload is an agent and the workspace that owns it. The
+// workspace is kept in the mirror, not sent to the provider.
+type createAgentPayload struct {
+	lyzr.AgentPayload
+	WorkspaceID string `json:"workspace_id"`
 }
 
 func (api *agentApi) CreateAgent(c *gin.Context) {
-	var payload lyzr.AgentPayload
-	if err := c.ShouldBindJSON(&payload); err != nil {
+	var body createAgentPayload
+	if err := c.ShouldBindJSON(&body); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON: " + err.Error()})
 		return
 	}
+	payload := body.AgentPayload
 	if err := payload.Validate(); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + err.Error()})
 		return
 	}
-	resp, err := api.lyzrClient.CreateAgent(c.Request.Context(), payload)
+	resp, err := api.providers.CreateAgent(c.Request.Context(), payload, providerOptions(c)...)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, err)
+		writeLyzrError(c, err, "agent")
 		return
 	}
+	api.mirrorCreated(c, resp.AgentId, body.WorkspaceID)
+	api.webhooks.Publish(c.Request.Context(), webhookmodels.EventAgentCreated, api.mirror.Workspace(c.Request.Context(), resp.AgentId), gin.H{
+		"agent_id": resp.AgentId,
+		"agent":    payload,
+	})
 	c.JSON(http.StatusOK, resp)
 }
 
+// ListAgents pages through the agents of the local mirror. They can be
+// filtered by provider, model, tags (comma separated, all required), a
+// search q over name and description and a created_after/created_before
+// range, and sorted by name, created_at or updated_at, prefixed with - for
+// descending order. Pages are continued with the returned next_cursor.
 func (api *agentApi) ListAgents(c *gin.Context) {
-	resp, err := api.lyzrClient.ListAgents(c.Request.Context())
+	filter, err := parseAgentFilter(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	page, err := api.mirror.Find(c.Request.Context(), filter)
+	if err != nil {
+		writeLyzrError(c, err, "agent")
+		return
+	}
+	var next *string
+	if page.Next != nil {
+		cursor := encodeAgentCursor(filter, page.Next)
+		next = &cursor
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"results":     page.Agents,
+		"total":       page.Total,
+		"next_cursor": next,
+	})
+}
+
+// agentCursor is what a next_cursor encodes. The sort is kept so a cursor
+// is not applied to a listing in another order.
+type agentCursor struct {
+	Sort  string                 `json:"sort"`
+	After repository.AgentCursor `json:"after"`
+}
+
+func encodeAgentCursor(filter repository.AgentFilter, after *repository.AgentCursor) string {
+	data, _ := json.Marshal(agentCursor{Sort: agentSort(filter), After: *after})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func agentSort(filter repository.AgentFilter) string {
+	if filter.Descending {
+		return "-" + filter.Sort
+	}
+	return filter.Sort
+}
+
+func parseAgentFilter(c *gin.Context) (repository.AgentFilter, error) {
+	filter := repository.AgentFilter{
+		Provider: c.Query("provider"),
+		Model:    c.Query("model"),
+		Query:    strings.TrimSpace(c.Query("q")),
+	}
+	for _, tag := range strings.Split(c.Query("tags"), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			filter.Tags = append(filter.Tags, tag)
+		}
+	}
+
+	var err error
+	if filter.CreatedAfter, err = parseTime(c.Query("created_after")); err != nil {
+		return filter, errors.New("Invalid created_after: " + err.Error())
+	}
+	if filter.CreatedBefore, err = parseTime(c.Query("created_before")); err != nil {
+		return filter, errors.New("Invalid created_before: " + err.Error())
+	}
+	// the mirror stores local times and SQLite compares them as text
+	if !filter.CreatedAfter.IsZero() {
+		filter.CreatedAfter = filter.CreatedAfter.Local()
+	}
+	if !filter.CreatedBefore.IsZero() {
+		filter.CreatedBefore = filter.CreatedBefore.Local()
+	}
+
+	sort := c.DefaultQuery("sort", repository.AgentSortCreatedAt)
+	filter.Sort = strings.TrimPrefix(sort, "-")
+	filter.Descending = filter.Sort != sort
+	switch filter.Sort {
+	case repository.AgentSortName, repository.AgentSortCreatedAt, repository.AgentSortUpdatedAt:
+	default:
+		return filter, errors.New("sort must be one of name, created_at, updated_at, optionally prefixed with -")
+	}
+
+	filter.Limit, err = strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultPageSize)))
+	if err != nil || filter.Limit < 1 || filter.Limit > maxPageSize {
+		return filter, errors.New("limit must be between 1 and 100")
+	}
+
+	if value := c.Query("cursor"); value != "" {
+		var cursor agentCursor
+		data, err := base64.RawURLEncoding.DecodeString(value)
+		if err == nil {
+			err = json.Unmarshal(data, &cursor)
+		}
+		if err != nil || cursor.After.ID == "" {
+			return filter, errors.New("invalid cursor")
+		}
+		if cursor.Sort != agentSort(filter) {
+			return filter, errors.New("cursor was issued for sort " + cursor.Sort)
+		}
+		cursor.After.Timestamp = cursor.After.Timestamp.Local()
+		filter.After = &cursor.After
+	}
+	return filter, nil
+}
+
+func (api *agentApi) GetAgent(c *gin.Context) {
+	agent, err := api.providers.GetAgent(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		writeLyzrError(c, err, "agent")
+		return
+	}
+	c.JSON(http.StatusOK, agent)
+}
+
+// UpdateAgent replaces the whole agent configuration.
+func (api *agentApi) UpdateAgent(c *gin.Context) {
+	var payload lyzr.AgentPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON: " + err.Error()})
+		return
+	}
+	api.saveAgent(c, payload)
+}
+
+// PatchAgent changes the fields present in the body and keeps the rest of
+// the current configuration.
+func (api *agentApi) PatchAgent(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// a cached copy would revert changes made at the provider since
+	agent, err := api.providers.GetAgent(cache.Refresh(c.Request.Context()), c.Param("id"))
+	if err != nil {
+		writeLyzrError(c, err, "agent")
+		return
+	}
+	payload := agent.Payload()
+	if err := json.Unmarshal(body, &payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON: " + err.Error()})
+		return
+	}
+	api.saveAgent(c, payload)
+}
+
+func (api *agentApi) saveAgent(c *gin.Context, payload lyzr.AgentPayload) {
+	agentID := c.Param("id")
+	// validation depends on the provider the agent already runs on
+	provider, err := api.providers.ForAgent(c.Request.Context(), agentID)
+	if err != nil {
+		writeLyzrError(c, err, "agent")
+		return
+	}
+	if payload.Provider != "" && payload.Provider != provider.Name() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "the provider of an agent cannot change"})
+		return
+	}
+	payload.Provider = provider.Name()
+	if err := payload.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + err.Error()})
+		return
+	}
+	resp, err := api.providers.UpdateAgent(c.Request.Context(), agentID, payload)
+	if err != nil {
+		writeLyzrError(c, err, "agent")
+		return
+	}
+	if err := api.mirror.Refresh(c.Request.Context(), agentID); err != nil {
+		log.Printf("Unable to mirror agent %s: %v", agentID, err)
+	}
+	api.webhooks.Publish(c.Request.Context(), webhookmodels.EventAgentUpdated, api.mirror.Workspace(c.Request.Context(), agentID), gin.H{
+		"agent_id": agentID,
+		"agent":    payload,
+	})
 	c.JSON(http.StatusOK, resp)
 }
 
-type Message struct {
-	ID        string `json:"id"`
-	From      string `json:"from"`
-	Text      string `json:"text"`
-	Timestamp string `json:"timestamp"`
+func (api *agentApi) DeleteAgent(c *gin.Context) {
+	agentID := c.Param("id")
+	// the mirror row goes with the agent, so its workspace is read first
+	workspaceID := api.mirror.Workspace(c.Request.Context(), agentID)
+	if err := api.providers.DeleteAgent(c.Request.Context(), agentID); err != nil {
+		writeLyzrError(c, err, "agent")
+		return
+	}
+	if err := api.mirror.Forget(c.Request.Context(), agentID); err != nil {
+		log.Printf("Unable to drop agent %s from the mirror: %v", agentID, err)
+	}
+	api.webhooks.Publish(c.Request.Context(), webhookmodels.EventAgentDeleted, workspaceID, gin.H{
+		"agent_id": agentID,
+	})
+	c.Status(http.StatusNoContent)
+}
+
+// idempotencyOptions forwards the caller's Idempotency-Key so a create can
+// safely be retried upstream.
+func idempotencyOptions(c *gin.Context) []clients.CallOption {
+	if key := c.GetHeader(clients.HeaderIdempotencyKey); key != "" {
+		return []clients.CallOption{clients.WithIdempotencyKey(key)}
+	}
+	return nil
+}
+
+// providerOptions is idempotencyOptions for calls through an agent provider.
+func providerOptions(c *gin.Context) []providers.CallOption {
+	if key := c.GetHeader(clients.HeaderIdempotencyKey); key != "" {
+		return []providers.CallOption{providers.WithIdempotencyKey(key)}
+	}
+	return nil
+}
+
+// writeLyzrError passes not found and conflict answers of the Lyzr API, or
+// another agent provider, on; anything else it rejected is a bad gateway.
+// resource names what was not found. While the circuit breaker is open,
+// callers are told when to come back.
+func writeLyzrError(c *gin.Context, err error, resource string) {
+	if errors.Is(err, providers.ErrUnknownProvider) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// the credential endpoints call the Lyzr client itself
+	var clientErr *clients.APIError
+	if errors.As(err, &clientErr) {
+		err = &providers.Error{StatusCode: clientErr.StatusCode, Message: clientErr.Message}
+	}
+	var clientUnavailable *clients.UpstreamUnavailableError
+	if errors.As(err, &clientUnavailable) {
+		err = &providers.UnavailableError{Provider: clientUnavailable.Upstream, RetryIn: clientUnavailable.RetryIn}
+	}
+
+	var unavailable *providers.UnavailableError
+	if errors.As(err, &unavailable) {
+		c.Header("Retry-After", strconv.Itoa(int(unavailable.RetryIn.Seconds())+1))
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "The agent service is temporarily unavailable, please try again shortly."})
+		return
+	}
+	var apiErr *providers.Error
+	if !errors.As(err, &apiErr) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	switch apiErr.StatusCode {
+	case http.StatusNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": resource + " not found"})
+	case http.StatusConflict:
+		c.JSON(http.StatusConflict, gin.H{"error": apiErr.Message})
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		c.JSON(http.StatusBadRequest, gin.H{"error": apiErr.Message})
+	default:
+		c.JSON(http.StatusBadGateway, gin.H{"error": apiErr.Error()})
+	}
 }
 
 func (api *agentApi) Chat(w http.ResponseWriter, r *http.Request) {
@@ -68,16 +336,50 @@ func (api *agentApi) Chat(w http.ResponseWriter, r *http.Request) {
 	defer sess.CloseWithError(0, "bye")
 	stream, err := sess.AcceptStream(ctx)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		log.Printf("Unable to accept stream: %v", err)
 		return
 	}
-	buf := make([]byte, 1024)
-	for {
-		_, err := stream.Read(buf)
-		if err != nil {
-			break
-		}
+	defer stream.Close()
+	api.chat.Serve(ctx, newStreamClient(stream))
+}
+
+// writeTimeout bounds how long a broadcast waits on a client that stopped
+// reading.
+const writeTimeout = 10 * time.Second
+
+// streamClient speaks the chat protocol over a WebTransport stream as
+// newline-delimited JSON frames.
+type streamClient struct {
+	mu      sync.Mutex
+	stream  *webtransport.Stream
+	decoder *json.Decoder
+	encoder *json.Encoder
+}
+
+func newStreamClient(stream *webtransport.Stream) *streamClient {
+	return &streamClient{stream: stream, decoder: json.NewDecoder(stream), encoder: json.NewEncoder(stream)}
+}
+
+func (client *streamClient) Read() ([]byte, error) {
+	var raw json.RawMessage
+	if err := client.decoder.Decode(&raw); err != nil {
+		return nil, err
 	}
+	return raw, nil
+}
+
+// Close ends both directions; closing the stream alone only ends the
+// send side and leaves a pending Read waiting.
+func (client *streamClient) Close() error {
+	client.stream.CancelRead(0)
+	return client.stream.Close()
+}
+
+func (client *streamClient) Send(frame interface{}) error {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.stream.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return client.encoder.Encode(frame)
 }
 
 var upgrader = websocket.Upgrader{
@@ -88,6 +390,29 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
+// wsClient serialises writes to a websocket shared by the read loop and
+// broadcasts from other conversations' goroutines.
+type wsClient struct {
+	mu   sync.Mutex
+	conn *websocket.Conn
+}
+
+func (client *wsClient) Read() ([]byte, error) {
+	_, msgBytes, err := client.conn.ReadMessage()
+	return msgBytes, err
+}
+
+func (client *wsClient) Close() error {
+	return client.conn.Close()
+}
+
+func (client *wsClient) Send(frame interface{}) error {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return client.conn.WriteJSON(frame)
+}
+
 func (api *agentApi) ChatWs(c *gin.Context) {
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
@@ -95,43 +420,5 @@ func (api *agentApi) ChatWs(c *gin.Context) {
 		return
 	}
 	defer conn.Close()
-
-	// Wait for an initial client message before entering main loop
-	res, msgBytes, err := conn.ReadMessage()
-	if err != nil {
-		log.Printf("Read error during handshake: %v %v", err, res)
-		return
-	}
-
-	log.Printf("Initial message from client: %s", string(msgBytes))
-
-	for {
-
-		_, msgBytes, err := conn.ReadMessage()
-		if err != nil {
-			log.Printf("Read error: %v", err)
-			break
-		}
-
-		// Print the raw message as a string
-		log.Printf("Received: %s", string(msgBytes))
-		var msg Message
-		err = json.Unmarshal(msgBytes, &msg)
-		if err != nil {
-			log.Printf("Unmarshal error: %v", err)
-			continue
-		}
-		log.Printf("Deserialized struct: %+v", msg)
-
-		// Optionally do something with msg here
-
-		// Echo back the message as JSON
-		msg.From = "agent"
-		msg.Text = fmt.Sprintf("Hello %s", msg.Text)
-		err = conn.WriteJSON(msg)
-		if err != nil {
-			log.Printf("Write error: %v", err)
-			break
-		}
-	}
+	api.chat.Serve(c.Request.Context(), &wsClient{conn: conn})
 }
@@ -0,0 +1,370 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdutt/agentserver/configs"
+	chatmodels "github.com/sdutt/agentserver/models/chat"
+	jobmodels "github.com/sdutt/agentserver/models/jobs"
+	"github.com/sdutt/agentserver/pkg/chat"
+	"github.com/sdutt/agentserver/pkg/export"
+	"github.com/sdutt/agentserver/pkg/jobs"
+	"github.com/sdutt/agentserver/pkg/transcript"
+	"github.com/sdutt/agentserver/repository"
+)
+
+type conversationsApi struct {
+	config        *configs.AppConfig
+	conversations repository.ConversationRepository
+	chat          *chat.Service
+	queue         *jobs.Queue
+	jobs          repository.JobRepository
+	exporter      *export.Exporter
+}
+
+func NewConversationsApi(config *configs.AppConfig, conversations repository.ConversationRepository, chatService *chat.Service, queue *jobs.Queue, jobRepository repository.JobRepository, exporter *export.Exporter) *conversationsApi {
+	return &conversationsApi{config, conversations, chatService, queue, jobRepository, exporter}
+}
+
+type editMessagePayload struct {
+	Text   string `json:"text" binding:"required"`
+	UserID string `json:"user_id" binding:"required"`
+	// Role is user (the default) or operator. Operators may change the
+	// messages of any user.
+	Role       string `json:"role"`
+	Regenerate bool   `json:"regenerate"`
+}
+
+// actor is who an edit or delete request acts for. Acting as an operator
+// takes the operator key as bearer token.
+func (api *conversationsApi) actor(c *gin.Context, userID, role string) (chat.Participant, error) {
+	if role == "" {
+		role = chatmodels.RoleUser
+	}
+	if role == chatmodels.RoleOperator && !api.chat.IsOperator(bearerToken(c)) {
+		return chat.Participant{}, chat.ErrOperatorKey
+	}
+	return chat.Participant{ID: userID, Role: role}, nil
+}
+
+func (api *conversationsApi) ListMessages(c *gin.Context) {
+	ctx := c.Request.Context()
+	conversation, err := api.conversations.GetConversation(ctx, c.Param("id"))
+	if err != nil {
+		writeChatError(c, err)
+		return
+	}
+	messages, err := api.conversations.ListMessages(ctx, conversation.ID)
+	if err != nil {
+		writeChatError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, messages)
+}
+
+// EditMessage changes the text of a user message and optionally queues a new
+// agent answer to it.
+func (api *conversationsApi) EditMessage(c *gin.Context) {
+	var payload editMessagePayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON: " + err.Error()})
+		return
+	}
+	actor, err := api.actor(c, payload.UserID, payload.Role)
+	if err != nil {
+		writeChatError(c, err)
+		return
+	}
+	ctx := c.Request.Context()
+	message, err := api.chat.Edit(ctx, c.Param("id"), c.Param("message_id"), actor, payload.Text)
+	if err != nil {
+		writeChatError(c, err)
+		return
+	}
+	if !payload.Regenerate {
+		c.JSON(http.StatusOK, gin.H{"message": message})
+		return
+	}
+	job, err := api.chat.Regenerate(ctx, message.ConversationID, message.ID)
+	if err != nil {
+		writeChatError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": message, "job": job})
+}
+
+// DeleteMessage removes a user message on behalf of the user_id and role
+// query parameters.
+func (api *conversationsApi) DeleteMessage(c *gin.Context) {
+	actor, err := api.actor(c, c.Query("user_id"), c.Query("role"))
+	if err != nil {
+		writeChatError(c, err)
+		return
+	}
+	err = api.chat.Delete(c.Request.Context(), c.Param("id"), c.Param("message_id"), actor)
+	if err != nil {
+		writeChatError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (api *conversationsApi) ListEdits(c *gin.Context) {
+	ctx := c.Request.Context()
+	message, err := api.conversations.GetMessage(ctx, c.Param("id"), c.Param("message_id"))
+	if err != nil {
+		writeChatError(c, err)
+		return
+	}
+	edits, err := api.conversations.ListEdits(ctx, message.ID)
+	if err != nil {
+		writeChatError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, edits)
+}
+
+// RegenerateMessage queues a new answer; it is delivered to the connected
+// clients of the conversation when ready.
+func (api *conversationsApi) RegenerateMessage(c *gin.Context) {
+	job, err := api.chat.Regenerate(c.Request.Context(), c.Param("id"), c.Param("message_id"))
+	if err != nil {
+		writeChatError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, job)
+}
+
+// MessageContext shows the prompt that was sent to the agent to produce the
+// reply message_id.
+func (api *conversationsApi) MessageContext(c *gin.Context) {
+	snapshot, err := api.conversations.GetContextSnapshot(c.Request.Context(), c.Param("message_id"))
+	if err != nil {
+		writeChatError(c, err)
+		return
+	}
+	if snapshot.ConversationID != c.Param("id") {
+		writeChatError(c, repository.ErrNotFound)
+		return
+	}
+	c.JSON(http.StatusOK, snapshot)
+}
+
+func (api *conversationsApi) ReadStates(c *gin.Context) {
+	ctx := c.Request.Context()
+	conversation, err := api.conversations.GetConversation(ctx, c.Param("id"))
+	if err != nil {
+		writeChatError(c, err)
+		return
+	}
+	states, err := api.conversations.ListReadStates(ctx, conversation.ID)
+	if err != nil {
+		writeChatError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, states)
+}
+
+type escalatePayload struct {
+	Reason string `json:"reason"`
+}
+
+func (api *conversationsApi) Escalate(c *gin.Context) {
+	var payload escalatePayload
+	if err := c.ShouldBindJSON(&payload); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON: " + err.Error()})
+		return
+	}
+	conversation, err := api.chat.Escalate(c.Request.Context(), c.Param("id"), payload.Reason)
+	if err != nil {
+		writeChatError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, conversation)
+}
+
+type resolvePayload struct {
+	Resolution string `json:"resolution"`
+}
+
+func (api *conversationsApi) Resolve(c *gin.Context) {
+	var payload resolvePayload
+	if err := c.ShouldBindJSON(&payload); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON: " + err.Error()})
+		return
+	}
+	conversation, err := api.chat.Resolve(c.Request.Context(), c.Param("id"), payload.Resolution)
+	if err != nil {
+		writeChatError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, conversation)
+}
+
+func writeChatError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, chat.ErrForbidden), errors.Is(err, chat.ErrWorkspace), errors.Is(err, chat.ErrOperatorKey):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, chat.ErrInvalidRating), errors.Is(err, chat.ErrInboundRole), errors.Is(err, chat.ErrAgentRequired),
+		errors.Is(err, chat.ErrActorRequired), errors.Is(err, chat.ErrRaterRequired), errors.Is(err, chat.ErrInvalidRole):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, chat.ErrNotEditable), errors.Is(err, chat.ErrNoParent), errors.Is(err, chat.ErrNotRateable),
+		errors.Is(err, chat.ErrEscalated), errors.Is(err, chat.ErrResolved):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// ExportConversation writes one transcript as json, md or csv.
+func (api *conversationsApi) ExportConversation(c *gin.Context) {
+	format := c.DefaultQuery("format", transcript.FormatJSON)
+	if !transcript.ValidFormat(format) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be one of json, md, csv"})
+		return
+	}
+	ctx := c.Request.Context()
+	conversation, err := api.conversations.GetConversation(ctx, c.Param("id"))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "conversation not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	messages, err := api.conversations.ListMessages(ctx, conversation.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	t := transcript.New(*conversation, messages, c.Query("redact") == "true")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", transcript.FileName(conversation.ID, format)))
+	c.Header("Content-Type", transcript.ContentType(format))
+	c.Status(http.StatusOK)
+	if err := transcript.Write(c.Writer, format, t); err != nil {
+		log.Printf("Export of conversation %s failed: %v", conversation.ID, err)
+	}
+}
+
+// ExportConversations streams a zip archive holding one transcript per
+// conversation started in [from, to).
+func (api *conversationsApi) ExportConversations(c *gin.Context) {
+	req, ok := parseExportRequest(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	conversations, err := api.conversations.ListConversations(ctx, req.From, req.To)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", req.FileName()))
+	c.Header("Content-Type", "application/zip")
+	c.Status(http.StatusOK)
+
+	// headers are already sent, so failures past this point can only be logged
+	if err := export.Archive(ctx, c.Writer, api.conversations, conversations, req); err != nil {
+		log.Printf("Bulk export aborted at %v", err)
+	}
+}
+
+// QueueExport takes the parameters of ExportConversations and builds the
+// archive in the background; fetch it from DownloadExport.
+func (api *conversationsApi) QueueExport(c *gin.Context) {
+	req, ok := parseExportRequest(c)
+	if !ok {
+		return
+	}
+	job, err := api.queue.Enqueue(c.Request.Context(), export.KindExport, req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, job)
+}
+
+// DownloadExport serves the archive of a finished export job, or the job
+// itself while it is still queued. Archives are deleted after JOBS__EXPORT_TTL.
+func (api *conversationsApi) DownloadExport(c *gin.Context) {
+	job, err := api.jobs.GetJob(c.Request.Context(), c.Param("job_id"))
+	if err == nil && job.Kind != export.KindExport {
+		err = repository.ErrNotFound
+	}
+	if err != nil {
+		writeChatError(c, err)
+		return
+	}
+	switch job.Status {
+	case jobmodels.StatusSucceeded:
+		var req export.Request
+		if err := json.Unmarshal(job.Payload, &req); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid export job: " + err.Error()})
+			return
+		}
+		path := api.exporter.Path(job.ID)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			c.JSON(http.StatusGone, gin.H{"error": "export has expired, queue it again"})
+			return
+		}
+		c.FileAttachment(path, req.FileName())
+	case jobmodels.StatusDead:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "export failed: " + job.LastError, "job": job})
+	default:
+		c.JSON(http.StatusAccepted, job)
+	}
+}
+
+func parseExportRequest(c *gin.Context) (export.Request, bool) {
+	req := export.Request{
+		Format:   c.DefaultQuery("format", transcript.FormatJSON),
+		Redacted: c.Query("redact") == "true",
+	}
+	if !transcript.ValidFormat(req.Format) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be one of json, md, csv"})
+		return req, false
+	}
+	var err error
+	req.From, err = parseTime(c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from: " + err.Error()})
+		return req, false
+	}
+	req.To, err = parseTime(c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to: " + err.Error()})
+		return req, false
+	}
+	if req.To.IsZero() {
+		req.To = time.Now()
+	}
+	if !req.From.Before(req.To) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return req, false
+	}
+	return req, true
+}
+
+// parseTime accepts RFC3339 timestamps or plain dates; empty means zero time.
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
@@ -1,33 +1,117 @@
 package api
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	clients "github.com/sdutt/agentserver/clients/lyzr"
 	"github.com/sdutt/agentserver/configs"
 	lyzr "github.com/sdutt/agentserver/models/lyzr"
+	"github.com/sdutt/agentserver/pkg/cache"
 )
 
+// credentialsTag marks every cached credential. Only masked credentials
+// are cached, so no secret reaches a shared cache.
+const credentialsTag = "credentials"
+
 type credentialsApi struct {
 	config     *configs.AppConfig
 	lyzrClient *clients.LyzrClient
+	cache      *cache.Loader
+}
+
+func NewCredentialsApi(config *configs.AppConfig, lyzr_client *clients.LyzrClient, loader *cache.Loader) *credentialsApi {
+	return &credentialsApi{config, lyzr_client, loader}
 }
 
-func NewCredentialsApi(config *configs.AppConfig, lyzr_client *clients.LyzrClient) *credentialsApi {
-	return &credentialsApi{config, lyzr_client}
+type rotateCredentialPayload struct {
+	Credentials map[string]interface{} `json:"credentials" binding:"required"`
 }
 
+// CreateCredential stores a provider credential. Like every credential
+// response, the secrets come back masked.
 func (api *credentialsApi) CreateCredential(ctx *gin.Context) {
 	var payload lyzr.CredentialPayload
 	if err := ctx.ShouldBindJSON(&payload); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON: " + err.Error()})
 		return
 	}
-	resp, err := api.lyzrClient.CreateCredentials(ctx.Request.Context(), payload)
+	resp, err := api.lyzrClient.CreateCredentials(ctx.Request.Context(), payload, idempotencyOptions(ctx)...)
+	api.cache.Invalidate(ctx.Request.Context(), credentialsTag)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, err)
+		writeLyzrError(ctx, err, "credential")
 		return
 	}
+	resp.Mask()
 	ctx.JSON(http.StatusOK, resp)
 }
+
+func (api *credentialsApi) ListCredentials(ctx *gin.Context) {
+	creds, err := cache.Load(ctx.Request.Context(), api.cache, "credentials", api.config.Cache.CredentialsTTL, []string{credentialsTag},
+		func(c context.Context) ([]clients.CredentialResponse, error) {
+			creds, err := api.lyzrClient.ListCredentials(c)
+			if err != nil {
+				return nil, err
+			}
+			for i := range creds {
+				creds[i].Mask()
+			}
+			return creds, nil
+		})
+	if err != nil {
+		writeLyzrError(ctx, err, "credential")
+		return
+	}
+	ctx.JSON(http.StatusOK, creds)
+}
+
+func (api *credentialsApi) GetCredential(ctx *gin.Context) {
+	id := ctx.Param("id")
+	cred, err := cache.Load(ctx.Request.Context(), api.cache, "credential:"+id, api.config.Cache.CredentialsTTL, []string{credentialsTag},
+		func(c context.Context) (*clients.CredentialResponse, error) {
+			cred, err := api.lyzrClient.GetCredential(c, id)
+			if err != nil {
+				return nil, err
+			}
+			cred.Mask()
+			return cred, nil
+		})
+	if err != nil {
+		writeLyzrError(ctx, err, "credential")
+		return
+	}
+	ctx.JSON(http.StatusOK, cred)
+}
+
+// RotateCredential replaces the secrets of a credential. Its id stays the
+// same, so agents using it need no change.
+func (api *credentialsApi) RotateCredential(ctx *gin.Context) {
+	var payload rotateCredentialPayload
+	if err := ctx.ShouldBindJSON(&payload); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON: " + err.Error()})
+		return
+	}
+	if len(payload.Credentials) == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "credentials must not be empty"})
+		return
+	}
+	cred, err := api.lyzrClient.RotateCredential(ctx.Request.Context(), ctx.Param("id"), payload.Credentials)
+	api.cache.Invalidate(ctx.Request.Context(), credentialsTag)
+	if err != nil {
+		writeLyzrError(ctx, err, "credential")
+		return
+	}
+	cred.Mask()
+	ctx.JSON(http.StatusOK, cred)
+}
+
+func (api *credentialsApi) DeleteCredential(ctx *gin.Context) {
+	err := api.lyzrClient.DeleteCredential(ctx.Request.Context(), ctx.Param("id"))
+	api.cache.Invalidate(ctx.Request.Context(), credentialsTag)
+	if err != nil {
+		writeLyzrError(ctx, err, "credential")
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdutt/agentserver/configs"
+	"github.com/sdutt/agentserver/pkg/chat"
+	"github.com/sdutt/agentserver/repository"
+)
+
+type feedbackApi struct {
+	config   *configs.AppConfig
+	feedback repository.FeedbackRepository
+	chat     *chat.Service
+}
+
+func NewFeedbackApi(config *configs.AppConfig, feedback repository.FeedbackRepository, chatService *chat.Service) *feedbackApi {
+	return &feedbackApi{config, feedback, chatService}
+}
+
+type feedbackPayload struct {
+	chat.Rating
+	UserID string `json:"user_id" binding:"required"`
+}
+
+func (api *feedbackApi) RateMessage(c *gin.Context) {
+	var payload feedbackPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON: " + err.Error()})
+		return
+	}
+	feedback, err := api.chat.Rate(c.Request.Context(), c.Param("id"), c.Param("message_id"), payload.UserID, payload.Rating)
+	if err != nil {
+		writeChatError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, feedback)
+}
+
+// AgentFeedback returns rating counts of an agent, split by reason code and
+// agent revision.
+func (api *feedbackApi) AgentFeedback(c *gin.Context) {
+	from, err := parseTime(c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from: " + err.Error()})
+		return
+	}
+	to, err := parseTime(c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to: " + err.Error()})
+		return
+	}
+	aggregate, err := api.feedback.AggregateFeedback(c.Request.Context(), c.Param("id"), from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, aggregate)
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	clients "github.com/sdutt/agentserver/clients/lyzr"
+	"github.com/sdutt/agentserver/configs"
+	"github.com/sdutt/agentserver/pkg/providers"
+)
+
+type healthApi struct {
+	config    *configs.AppConfig
+	providers *providers.Registry
+}
+
+func NewHealthApi(config *configs.AppConfig, registry *providers.Registry) *healthApi {
+	return &healthApi{config, registry}
+}
+
+// Health reports the server as ok, or degraded while the circuit breaker
+// of an agent provider is not closed. The server itself still answers, so
+// the status code stays 200.
+func (api *healthApi) Health(c *gin.Context) {
+	upstreams := api.providers.Breakers()
+	status := "ok"
+	for _, breaker := range upstreams {
+		if breaker.State != clients.BreakerClosed {
+			status = "degraded"
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"status":    status,
+		"version":   api.config.Version,
+		"upstreams": upstreams,
+	})
+}
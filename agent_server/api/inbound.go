@@ -0,0 +1,87 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdutt/agentserver/configs"
+	"github.com/sdutt/agentserver/pkg/chat"
+	"github.com/sdutt/agentserver/pkg/webhooks"
+	"github.com/sdutt/agentserver/repository"
+)
+
+// maxInboundBody bounds the size of an inbound message request.
+const maxInboundBody = 1 << 20
+
+type inboundApi struct {
+	config   *configs.AppConfig
+	chat     *chat.Service
+	webhooks repository.WebhookRepository
+}
+
+func NewInboundApi(config *configs.AppConfig, chatService *chat.Service, webhookRepository repository.WebhookRepository) *inboundApi {
+	return &inboundApi{config, chatService, webhookRepository}
+}
+
+// PostMessage lets an external system drop a message into a conversation.
+// The body must be signed like outbound webhooks: X-Webhook-Timestamp and
+// X-Webhook-Signature computed with the inbound secret over a unique
+// X-Webhook-Delivery id and the body; a delivery id is only accepted once.
+func (api *inboundApi) PostMessage(c *gin.Context) {
+	secret := api.config.Webhooks.InboundSecret
+	if secret == "" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "inbound messages are not configured"})
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxInboundBody))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	deliveryID := c.GetHeader(webhooks.HeaderDelivery)
+	if deliveryID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": webhooks.HeaderDelivery + " is required"})
+		return
+	}
+	err = webhooks.Verify(secret, c.GetHeader(webhooks.HeaderSignature), c.GetHeader(webhooks.HeaderTimestamp), deliveryID, body, api.config.Webhooks.InboundTolerance)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	var payload chat.Inbound
+	if err := json.Unmarshal(body, &payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON: " + err.Error()})
+		return
+	}
+	if payload.Text == "" || payload.WorkspaceID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "text and workspace_id are required"})
+		return
+	}
+	ctx := c.Request.Context()
+	// a signature stays valid for the tolerance either side of its
+	// timestamp, so older ids can no longer be replayed
+	expired := time.Now().Add(-2 * api.config.Webhooks.InboundTolerance)
+	claimed, err := api.webhooks.ClaimInbound(ctx, deliveryID, expired)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !claimed {
+		c.JSON(http.StatusConflict, gin.H{"error": "delivery " + deliveryID + " was already received"})
+		return
+	}
+	conversation, message, err := api.chat.PostInbound(ctx, payload)
+	if err != nil {
+		if err := api.webhooks.ReleaseInbound(ctx, deliveryID); err != nil {
+			log.Printf("Unable to release inbound delivery %s: %v", deliveryID, err)
+		}
+		writeChatError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"conversation": conversation, "message": message})
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdutt/agentserver/configs"
+	models "github.com/sdutt/agentserver/models/jobs"
+	"github.com/sdutt/agentserver/repository"
+)
+
+type jobsApi struct {
+	config *configs.AppConfig
+	jobs   repository.JobRepository
+}
+
+func NewJobsApi(config *configs.AppConfig, jobs repository.JobRepository) *jobsApi {
+	return &jobsApi{config, jobs}
+}
+
+// ListJobs pages through the queue, newest first, filtered by status and
+// kind, with the number of jobs in each status.
+func (api *jobsApi) ListJobs(c *gin.Context) {
+	status := c.Query("status")
+	switch status {
+	case "", models.StatusPending, models.StatusRunning, models.StatusSucceeded, models.StatusDead:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be one of pending, running, succeeded, dead"})
+		return
+	}
+	page, pageSize, err := parsePage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx := c.Request.Context()
+	jobs, total, err := api.jobs.ListJobs(ctx, repository.JobFilter{
+		Status: status,
+		Kind:   c.Query("kind"),
+		Limit:  pageSize,
+		Offset: (page - 1) * pageSize,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	counts, err := api.jobs.CountJobs(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"results":   jobs,
+		"total":     total,
+		"counts":    counts,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+func (api *jobsApi) GetJob(c *gin.Context) {
+	job, err := api.jobs.GetJob(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		writeJobError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// RetryJob puts a dead-lettered or finished job back on the queue.
+func (api *jobsApi) RetryJob(c *gin.Context) {
+	job, err := api.jobs.Requeue(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		writeJobError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+func writeJobError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, repository.ErrNotRetryable):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdutt/agentserver/configs"
+	"github.com/sdutt/agentserver/pkg/metrics"
+	"github.com/sdutt/agentserver/repository"
+)
+
+const defaultMetricsWindow = 7 * 24 * time.Hour
+
+type metricsApi struct {
+	config  *configs.AppConfig
+	metrics repository.MetricsRepository
+}
+
+func NewMetricsApi(config *configs.AppConfig, metrics repository.MetricsRepository) *metricsApi {
+	return &metricsApi{config, metrics}
+}
+
+// AgentMetrics reports time bucketed KPIs of an agent computed from the
+// persisted chat data. Query parameters: from, to (default the last seven
+// days), bucket (hour, day, week) and group_by (model, revision).
+func (api *metricsApi) AgentMetrics(c *gin.Context) {
+	to, err := parseTime(c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to: " + err.Error()})
+		return
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+	from, err := parseTime(c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from: " + err.Error()})
+		return
+	}
+	if from.IsZero() {
+		from = to.Add(-defaultMetricsWindow)
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return
+	}
+	bucket := c.DefaultQuery("bucket", metrics.BucketDay)
+	size, err := metrics.BucketSize(bucket)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	groupBy := c.Query("group_by")
+	if !metrics.ValidGroupBy(groupBy) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "group_by must be model or revision"})
+		return
+	}
+
+	agentID := c.Param("id")
+	// load from the start of the first bucket so it is complete
+	activity, err := api.metrics.AgentActivity(c.Request.Context(), agentID, from.Truncate(size), to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	report, err := metrics.Build(agentID, activity, from, to, bucket, groupBy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdutt/agentserver/configs"
+	"github.com/sdutt/agentserver/pkg/presence"
+)
+
+type presenceApi struct {
+	config   *configs.AppConfig
+	presence *presence.Tracker
+}
+
+func NewPresenceApi(config *configs.AppConfig, tracker *presence.Tracker) *presenceApi {
+	return &presenceApi{config, tracker}
+}
+
+// ListPresence reports the status and last-seen time of users, operators
+// and agents, optionally restricted to one kind, with per-status counts.
+func (api *presenceApi) ListPresence(c *gin.Context) {
+	kind := c.Query("kind")
+	switch kind {
+	case "", presence.KindUser, presence.KindOperator, presence.KindAgent:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be user, operator or agent"})
+		return
+	}
+	entries := api.presence.List(kind)
+	counts := map[string]int{presence.StatusOnline: 0, presence.StatusAway: 0, presence.StatusOffline: 0}
+	for _, entry := range entries {
+		counts[entry.Status]++
+	}
+	c.JSON(http.StatusOK, gin.H{"results": entries, "counts": counts})
+}
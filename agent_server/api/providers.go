@@ -0,0 +1,29 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdutt/agentserver/configs"
+	"github.com/sdutt/agentserver/pkg/cache"
+	"github.com/sdutt/agentserver/pkg/providers"
+)
+
+type providersApi struct {
+	config    *configs.AppConfig
+	providers *providers.Registry
+}
+
+func NewProvidersApi(config *configs.AppConfig, registry *providers.Registry) *providersApi {
+	return &providersApi{config, registry}
+}
+
+// ListProviders describes the agent providers and their models. Model
+// lists are cached; ?refresh=true reads them again.
+func (api *providersApi) ListProviders(c *gin.Context) {
+	ctx := c.Request.Context()
+	if c.Query("refresh") == "true" {
+		ctx = cache.Refresh(ctx)
+	}
+	c.JSON(http.StatusOK, api.providers.Catalog(ctx))
+}
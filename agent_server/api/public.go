@@ -0,0 +1,344 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdutt/agentserver/configs"
+	chatmodels "github.com/sdutt/agentserver/models/chat"
+	models "github.com/sdutt/agentserver/models/widgets"
+	"github.com/sdutt/agentserver/pkg/chat"
+	"github.com/sdutt/agentserver/pkg/ids"
+	"github.com/sdutt/agentserver/pkg/widgets"
+	"github.com/sdutt/agentserver/repository"
+)
+
+// maxVisitorMessage bounds the text of one visitor message.
+const maxVisitorMessage = 4000
+
+var (
+	errOriginNotAllowed = errors.New("origin is not allowed for this widget")
+	errRateLimited      = errors.New("rate limit exceeded, try again later")
+)
+
+// publicApi is the only surface embedded widgets talk to. Everything is
+// scoped to the widget of the publishable key or visitor session, and
+// browsers must call from one of the widget's allowed domains.
+type publicApi struct {
+	config        *configs.AppConfig
+	widgets       repository.WidgetRepository
+	conversations repository.ConversationRepository
+	chat          *chat.Service
+	limiter       *widgets.Limiter
+}
+
+func NewPublicApi(config *configs.AppConfig, widgetRepository repository.WidgetRepository, conversations repository.ConversationRepository, chatService *chat.Service, limiter *widgets.Limiter) *publicApi {
+	return &publicApi{config, widgetRepository, conversations, chatService, limiter}
+}
+
+type visitorSessionPayload struct {
+	Key string `json:"key" binding:"required"`
+}
+
+type visitorMessagePayload struct {
+	Text string `json:"text" binding:"required"`
+}
+
+// visitorMessage is what visitors see of a message; agent metadata stays
+// internal.
+type visitorMessage struct {
+	ID          string                  `json:"id"`
+	Seq         int64                   `json:"seq"`
+	Role        string                  `json:"role"`
+	Text        string                  `json:"text"`
+	ParentID    string                  `json:"parent_id,omitempty"`
+	Attachments []chatmodels.Attachment `json:"attachments,omitempty"`
+	EditedAt    *time.Time              `json:"edited_at,omitempty"`
+	CreatedAt   time.Time               `json:"created_at"`
+}
+
+func newVisitorMessage(message *chatmodels.Message) visitorMessage {
+	return visitorMessage{
+		ID:          message.ID,
+		Seq:         message.Seq,
+		Role:        message.Role,
+		Text:        message.Text,
+		ParentID:    message.ParentID,
+		Attachments: message.Attachments,
+		EditedAt:    message.EditedAt,
+		CreatedAt:   message.CreatedAt,
+	}
+}
+
+// GetWidget returns the public configuration of a widget so the embed
+// script can render before a session exists.
+func (api *publicApi) GetWidget(c *gin.Context) {
+	widget, err := api.widget(c, c.Param("key"))
+	if err != nil {
+		writePublicError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, widget.Public())
+}
+
+// CreateSession starts an anonymous visitor session and its conversation
+// with the widget's agent. The returned token is only shown once.
+func (api *publicApi) CreateSession(c *gin.Context) {
+	var payload visitorSessionPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON: " + err.Error()})
+		return
+	}
+	widget, err := api.widget(c, payload.Key)
+	if err != nil {
+		writePublicError(c, err)
+		return
+	}
+	limit := widget.SessionsPerHour
+	if limit == 0 {
+		limit = api.config.Widgets.SessionsPerHour
+	}
+	if !api.limiter.Allow(c.Request.Context(), "session:"+widget.ID+":"+c.ClientIP(), limit, time.Hour) {
+		writePublicError(c, errRateLimited)
+		return
+	}
+
+	ctx := c.Request.Context()
+	visitorID := "visitor_" + ids.New()
+	conversation, err := api.chat.Open(ctx, chat.Handshake{
+		AgentID:     widget.AgentID,
+		UserID:      visitorID,
+		WorkspaceID: widget.WorkspaceID,
+	})
+	if err != nil {
+		writeChatError(c, err)
+		return
+	}
+	token := widgets.NewSessionToken()
+	now := time.Now()
+	session := &models.VisitorSession{
+		WidgetID:       widget.ID,
+		VisitorID:      visitorID,
+		ConversationID: conversation.ID,
+		TokenHash:      widgets.HashToken(token),
+		Origin:         c.GetHeader("Origin"),
+		ExpiresAt:      now.Add(api.config.Widgets.SessionTTL),
+		LastSeenAt:     now,
+	}
+	if err := api.widgets.CreateSession(ctx, session); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"token":           token,
+		"visitor_id":      visitorID,
+		"conversation_id": conversation.ID,
+		"expires_at":      session.ExpiresAt,
+		"widget":          widget.Public(),
+	})
+}
+
+// ListMessages returns the visitor's conversation, after the after_seq
+// query parameter when polling.
+func (api *publicApi) ListMessages(c *gin.Context) {
+	_, session, err := api.visitor(c, bearerToken(c))
+	if err != nil {
+		writePublicError(c, err)
+		return
+	}
+	afterSeq, _ := strconv.ParseInt(c.Query("after_seq"), 10, 64)
+	messages, err := api.conversations.ListMessages(c.Request.Context(), session.ConversationID)
+	if err != nil {
+		writeChatError(c, err)
+		return
+	}
+	results := []visitorMessage{}
+	for i := range messages {
+		if messages[i].Seq > afterSeq {
+			results = append(results, newVisitorMessage(&messages[i]))
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
+
+// PostMessage adds a visitor message and queues the agent's answer, which
+// arrives over the chat socket or the next poll.
+func (api *publicApi) PostMessage(c *gin.Context) {
+	widget, session, err := api.visitor(c, bearerToken(c))
+	if err != nil {
+		writePublicError(c, err)
+		return
+	}
+	var payload visitorMessagePayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON: " + err.Error()})
+		return
+	}
+	if len(payload.Text) > maxVisitorMessage {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "text is too long"})
+		return
+	}
+	if !api.allowMessage(c.Request.Context(), widget, session) {
+		writePublicError(c, errRateLimited)
+		return
+	}
+	ctx := c.Request.Context()
+	conversation, err := api.conversations.GetConversation(ctx, session.ConversationID)
+	if err != nil {
+		writeChatError(c, err)
+		return
+	}
+	participant := chat.Participant{ID: session.VisitorID, Role: chatmodels.RoleUser}
+	message, err := api.chat.Post(ctx, conversation, participant, chat.Message{Text: payload.Text}, nil)
+	if err != nil {
+		writeChatError(c, err)
+		return
+	}
+	if _, err := api.chat.RequestReply(ctx, message); err != nil {
+		writeChatError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, newVisitorMessage(message))
+}
+
+// Chat speaks the chat protocol over a websocket for the visitor's
+// conversation. Browsers cannot set headers on websockets, so the session
+// token comes in the token query parameter.
+func (api *publicApi) Chat(c *gin.Context) {
+	widget, session, err := api.visitor(c, c.Query("token"))
+	if err != nil {
+		writePublicError(c, err)
+		return
+	}
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer conn.Close()
+	api.chat.Serve(c.Request.Context(), &visitorConn{
+		Conn:    &wsClient{conn: conn},
+		api:     api,
+		widget:  widget,
+		session: session,
+	})
+}
+
+// widget finds the active widget of a publishable key and checks the
+// calling page may use it.
+func (api *publicApi) widget(c *gin.Context, key string) (*models.Widget, error) {
+	widget, err := api.widgets.GetWidgetByKey(c.Request.Context(), key)
+	if err != nil {
+		return nil, err
+	}
+	if !widget.Active {
+		return nil, repository.ErrNotFound
+	}
+	if !widget.AllowsOrigin(c.GetHeader("Origin")) {
+		return nil, errOriginNotAllowed
+	}
+	return widget, nil
+}
+
+// visitor resolves a session token to the session and its widget.
+func (api *publicApi) visitor(c *gin.Context, token string) (*models.Widget, *models.VisitorSession, error) {
+	ctx := c.Request.Context()
+	session, err := api.widgets.GetSession(ctx, widgets.HashToken(token))
+	if err != nil {
+		return nil, nil, err
+	}
+	widget, err := api.widgets.GetWidget(ctx, session.WidgetID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !widget.Active {
+		return nil, nil, repository.ErrNotFound
+	}
+	if !widget.AllowsOrigin(c.GetHeader("Origin")) {
+		return nil, nil, errOriginNotAllowed
+	}
+	if err := api.widgets.TouchSession(ctx, session.ID); err != nil {
+		return nil, nil, err
+	}
+	return widget, session, nil
+}
+
+func (api *publicApi) allowMessage(ctx context.Context, widget *models.Widget, session *models.VisitorSession) bool {
+	limit := widget.MessagesPerMinute
+	if limit == 0 {
+		limit = api.config.Widgets.MessagesPerMinute
+	}
+	return api.limiter.Allow(ctx, "message:"+session.ID, limit, time.Minute)
+}
+
+func bearerToken(c *gin.Context) string {
+	token, _ := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	return token
+}
+
+// writePublicError answers visitors without revealing why a key or token
+// did not match.
+func writePublicError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid widget key or session"})
+	case errors.Is(err, errOriginNotAllowed):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, errRateLimited):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// visitorConn pins a visitor socket to its session: the handshake is made
+// up from the session, and only chat, read and feedback frames get through,
+// rate limited like the HTTP endpoint.
+type visitorConn struct {
+	chat.Conn
+	api        *publicApi
+	widget     *models.Widget
+	session    *models.VisitorSession
+	handshaken bool
+}
+
+func (conn *visitorConn) Read() ([]byte, error) {
+	if !conn.handshaken {
+		conn.handshaken = true
+		return json.Marshal(chat.Handshake{ConversationID: conn.session.ConversationID, UserID: conn.session.VisitorID})
+	}
+	for {
+		data, err := conn.Conn.Read()
+		if err != nil {
+			return nil, err
+		}
+		var frame chat.Frame
+		if err := json.Unmarshal(data, &frame); err != nil {
+			return data, nil
+		}
+		var reject error
+		switch frame.Type {
+		case "", chat.FrameMessage:
+			if len(frame.Text) > maxVisitorMessage {
+				reject = errors.New("text is too long")
+			} else if !conn.api.allowMessage(context.Background(), conn.widget, conn.session) {
+				reject = errRateLimited
+			}
+		case chat.FrameRead, chat.FrameFeedback:
+		default:
+			reject = errors.New("frame type " + frame.Type + " is not available to visitors")
+		}
+		if reject == nil {
+			return data, nil
+		}
+		if err := conn.Send(chat.ErrorFrame{Type: chat.FrameError, Error: reject.Error()}); err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdutt/agentserver/configs"
+	"github.com/sdutt/agentserver/repository"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+type searchApi struct {
+	config *configs.AppConfig
+	search repository.SearchRepository
+}
+
+func NewSearchApi(config *configs.AppConfig, search repository.SearchRepository) *searchApi {
+	return &searchApi{config, search}
+}
+
+// SearchMessages runs a full text query over message content. q accepts the
+// FTS5 query syntax: phrases in quotes, AND/OR/NOT and prefix* terms.
+func (api *searchApi) SearchMessages(c *gin.Context) {
+	q := c.Query("q")
+	if q == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+		return
+	}
+	from, err := parseTime(c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from: " + err.Error()})
+		return
+	}
+	to, err := parseTime(c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to: " + err.Error()})
+		return
+	}
+	page, pageSize, err := parsePage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := api.search.SearchMessages(c.Request.Context(), repository.SearchQuery{
+		Query:       q,
+		AgentID:     c.Query("agent_id"),
+		UserID:      c.Query("user_id"),
+		WorkspaceID: c.Query("workspace_id"),
+		From:        from,
+		To:          to,
+		Limit:       pageSize,
+		Offset:      (page - 1) * pageSize,
+	})
+	if errors.Is(err, repository.ErrInvalidQuery) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if result.Hits == nil {
+		result.Hits = []repository.SearchHit{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"results":   result.Hits,
+		"total":     result.Total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+func parsePage(c *gin.Context) (int, int, error) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		return 0, 0, errors.New("page must be a positive integer")
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", strconv.Itoa(defaultPageSize)))
+	if err != nil || pageSize < 1 || pageSize > maxPageSize {
+		return 0, 0, errors.New("page_size must be between 1 and 100")
+	}
+	return page, pageSize, nil
+}
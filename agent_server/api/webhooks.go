@@ -0,0 +1,222 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdutt/agentserver/configs"
+	models "github.com/sdutt/agentserver/models/webhooks"
+	"github.com/sdutt/agentserver/pkg/webhooks"
+	"github.com/sdutt/agentserver/repository"
+)
+
+type webhooksApi struct {
+	config     *configs.AppConfig
+	webhooks   repository.WebhookRepository
+	dispatcher *webhooks.Dispatcher
+}
+
+func NewWebhooksApi(config *configs.AppConfig, webhookRepository repository.WebhookRepository, dispatcher *webhooks.Dispatcher) *webhooksApi {
+	return &webhooksApi{config, webhookRepository, dispatcher}
+}
+
+type subscriptionPayload struct {
+	WorkspaceID string   `json:"workspace_id"`
+	URL         string   `json:"url"`
+	Events      []string `json:"events"`
+	Secret      string   `json:"secret"`
+	Active      *bool    `json:"active"`
+}
+
+func (payload *subscriptionPayload) validate() error {
+	if payload.URL != "" {
+		u, err := url.Parse(payload.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("url must be an absolute http or https URL")
+		}
+	}
+	for _, event := range payload.Events {
+		if !slices.Contains(models.Events, event) {
+			return errors.New("unknown event " + event)
+		}
+	}
+	return nil
+}
+
+// validate checks the payload and that its url does not point into the
+// server's own network.
+func (api *webhooksApi) validate(c *gin.Context, payload *subscriptionPayload) error {
+	if err := payload.validate(); err != nil {
+		return err
+	}
+	if payload.URL == "" {
+		return nil
+	}
+	return api.dispatcher.CheckURL(c.Request.Context(), payload.URL)
+}
+
+// CreateSubscription registers a webhook. Without a workspace_id it
+// receives the events of every workspace. The secret is generated unless
+// given and is only returned by this call.
+func (api *webhooksApi) CreateSubscription(c *gin.Context) {
+	var payload subscriptionPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON: " + err.Error()})
+		return
+	}
+	if payload.URL == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "url is required"})
+		return
+	}
+	if err := api.validate(c, &payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sub := &models.Subscription{
+		WorkspaceID: payload.WorkspaceID,
+		URL:         payload.URL,
+		Events:      payload.Events,
+		Secret:      payload.Secret,
+		Active:      payload.Active == nil || *payload.Active,
+	}
+	if sub.Secret == "" {
+		sub.Secret = webhooks.NewSecret()
+	}
+	if err := api.webhooks.CreateSubscription(c.Request.Context(), sub); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, sub)
+}
+
+func (api *webhooksApi) ListSubscriptions(c *gin.Context) {
+	subs, err := api.webhooks.ListSubscriptions(c.Request.Context(), c.Query("workspace_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for i := range subs {
+		subs[i].Secret = ""
+	}
+	c.JSON(http.StatusOK, subs)
+}
+
+func (api *webhooksApi) GetSubscription(c *gin.Context) {
+	sub, err := api.webhooks.GetSubscription(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		writeWebhookError(c, err)
+		return
+	}
+	sub.Secret = ""
+	c.JSON(http.StatusOK, sub)
+}
+
+// UpdateSubscription changes the url, event filter, secret or active flag;
+// omitted fields are kept.
+func (api *webhooksApi) UpdateSubscription(c *gin.Context) {
+	var payload subscriptionPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON: " + err.Error()})
+		return
+	}
+	if err := api.validate(c, &payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx := c.Request.Context()
+	sub, err := api.webhooks.GetSubscription(ctx, c.Param("id"))
+	if err != nil {
+		writeWebhookError(c, err)
+		return
+	}
+	if payload.URL != "" {
+		sub.URL = payload.URL
+	}
+	if payload.Events != nil {
+		sub.Events = payload.Events
+	}
+	if payload.Secret != "" {
+		sub.Secret = payload.Secret
+	}
+	if payload.Active != nil {
+		sub.Active = *payload.Active
+	}
+	if err := api.webhooks.UpdateSubscription(ctx, sub); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	sub.Secret = ""
+	c.JSON(http.StatusOK, sub)
+}
+
+func (api *webhooksApi) DeleteSubscription(c *gin.Context) {
+	if err := api.webhooks.DeleteSubscription(c.Request.Context(), c.Param("id")); err != nil {
+		writeWebhookError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ListDeliveries is the delivery log of a subscription, newest first.
+func (api *webhooksApi) ListDeliveries(c *gin.Context) {
+	page, pageSize, err := parsePage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx := c.Request.Context()
+	sub, err := api.webhooks.GetSubscription(ctx, c.Param("id"))
+	if err != nil {
+		writeWebhookError(c, err)
+		return
+	}
+	deliveries, total, err := api.webhooks.ListDeliveries(ctx, sub.ID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"results":   deliveries,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// GetDelivery returns a delivery with every attempt made.
+func (api *webhooksApi) GetDelivery(c *gin.Context) {
+	ctx := c.Request.Context()
+	delivery, err := api.webhooks.GetDelivery(ctx, c.Param("delivery_id"))
+	if err != nil {
+		writeWebhookError(c, err)
+		return
+	}
+	delivery.Log, err = api.webhooks.ListAttempts(ctx, delivery.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, delivery)
+}
+
+// Redeliver queues the payload of a delivery again, e.g. after the
+// receiver was fixed.
+func (api *webhooksApi) Redeliver(c *gin.Context) {
+	delivery, err := api.dispatcher.Redeliver(c.Request.Context(), c.Param("delivery_id"))
+	if err != nil {
+		writeWebhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, delivery)
+}
+
+func writeWebhookError(c *gin.Context, err error) {
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,195 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdutt/agentserver/configs"
+	models "github.com/sdutt/agentserver/models/widgets"
+	"github.com/sdutt/agentserver/pkg/widgets"
+	"github.com/sdutt/agentserver/repository"
+)
+
+type widgetsApi struct {
+	config  *configs.AppConfig
+	widgets repository.WidgetRepository
+}
+
+func NewWidgetsApi(config *configs.AppConfig, widgetRepository repository.WidgetRepository) *widgetsApi {
+	return &widgetsApi{config, widgetRepository}
+}
+
+type widgetPayload struct {
+	AgentID           string          `json:"agent_id"`
+	WorkspaceID       string          `json:"workspace_id"`
+	Name              string          `json:"name"`
+	AllowedDomains    []string        `json:"allowed_domains"`
+	Greeting          *string         `json:"greeting"`
+	Theme             json.RawMessage `json:"theme"`
+	MessagesPerMinute *int            `json:"messages_per_minute"`
+	SessionsPerHour   *int            `json:"sessions_per_hour"`
+	Active            *bool           `json:"active"`
+}
+
+func (payload *widgetPayload) validate() error {
+	for i, domain := range payload.AllowedDomains {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if domain == "" || strings.ContainsAny(domain, "/: ") || strings.Contains(domain[1:], "*") ||
+			(strings.HasPrefix(domain, "*") && !strings.HasPrefix(domain, "*.")) {
+			return errors.New("allowed_domains must be host names such as example.com or *.example.com")
+		}
+		payload.AllowedDomains[i] = domain
+	}
+	if len(payload.Theme) > 0 && !json.Valid(payload.Theme) {
+		return errors.New("theme must be valid JSON")
+	}
+	if (payload.MessagesPerMinute != nil && *payload.MessagesPerMinute < 0) ||
+		(payload.SessionsPerHour != nil && *payload.SessionsPerHour < 0) {
+		return errors.New("rate limits must not be negative")
+	}
+	return nil
+}
+
+// apply copies the optional settings shared by create and update.
+func (payload *widgetPayload) apply(widget *models.Widget) {
+	if payload.AllowedDomains != nil {
+		widget.AllowedDomains = payload.AllowedDomains
+	}
+	if payload.Greeting != nil {
+		widget.Greeting = *payload.Greeting
+	}
+	if payload.Theme != nil {
+		widget.Theme = payload.Theme
+	}
+	if payload.MessagesPerMinute != nil {
+		widget.MessagesPerMinute = *payload.MessagesPerMinute
+	}
+	if payload.SessionsPerHour != nil {
+		widget.SessionsPerHour = *payload.SessionsPerHour
+	}
+}
+
+// CreateWidget configures a widget for an agent and issues its publishable
+// key.
+func (api *widgetsApi) CreateWidget(c *gin.Context) {
+	var payload widgetPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON: " + err.Error()})
+		return
+	}
+	if payload.AgentID == "" || len(payload.AllowedDomains) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "agent_id and allowed_domains are required"})
+		return
+	}
+	if err := payload.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	widget := &models.Widget{
+		AgentID:        payload.AgentID,
+		WorkspaceID:    payload.WorkspaceID,
+		Name:           payload.Name,
+		PublishableKey: widgets.NewPublishableKey(),
+		Active:         payload.Active == nil || *payload.Active,
+	}
+	payload.apply(widget)
+	if err := api.widgets.CreateWidget(c.Request.Context(), widget); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, widget)
+}
+
+func (api *widgetsApi) ListWidgets(c *gin.Context) {
+	list, err := api.widgets.ListWidgets(c.Request.Context(), c.Query("agent_id"), c.Query("workspace_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+func (api *widgetsApi) GetWidget(c *gin.Context) {
+	widget, err := api.widgets.GetWidget(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		writeWidgetError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, widget)
+}
+
+// UpdateWidget changes the configuration of a widget; omitted fields are
+// kept. The agent a widget is bound to cannot change.
+func (api *widgetsApi) UpdateWidget(c *gin.Context) {
+	var payload widgetPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON: " + err.Error()})
+		return
+	}
+	if payload.AllowedDomains != nil && len(payload.AllowedDomains) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "allowed_domains must not be empty"})
+		return
+	}
+	if err := payload.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ctx := c.Request.Context()
+	widget, err := api.widgets.GetWidget(ctx, c.Param("id"))
+	if err != nil {
+		writeWidgetError(c, err)
+		return
+	}
+	if payload.AgentID != "" && payload.AgentID != widget.AgentID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "agent_id cannot be changed"})
+		return
+	}
+	if payload.Name != "" {
+		widget.Name = payload.Name
+	}
+	if payload.Active != nil {
+		widget.Active = *payload.Active
+	}
+	payload.apply(widget)
+	if err := api.widgets.UpdateWidget(ctx, widget); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, widget)
+}
+
+// RotateKey issues a new publishable key; pages embedding the old one stop
+// working while sessions already open keep going.
+func (api *widgetsApi) RotateKey(c *gin.Context) {
+	ctx := c.Request.Context()
+	widget, err := api.widgets.GetWidget(ctx, c.Param("id"))
+	if err != nil {
+		writeWidgetError(c, err)
+		return
+	}
+	widget.PublishableKey = widgets.NewPublishableKey()
+	if err := api.widgets.UpdateWidget(ctx, widget); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, widget)
+}
+
+func (api *widgetsApi) DeleteWidget(c *gin.Context) {
+	if err := api.widgets.DeleteWidget(c.Request.Context(), c.Param("id")); err != nil {
+		writeWidgetError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func writeWidgetError(c *gin.Context, err error) {
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
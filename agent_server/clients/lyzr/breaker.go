@@ -0,0 +1,177 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sdutt/agentserver/configs"
+)
+
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half_open"
+)
+
+// UpstreamUnavailableError is returned without calling the upstream while
+// its breaker is open.
+type UpstreamUnavailableError struct {
+	Upstream string
+	RetryIn  time.Duration
+}
+
+func (e *UpstreamUnavailableError) Error() string {
+	return fmt.Sprintf("%s upstream unavailable, retry in %s", e.Upstream, e.RetryIn.Round(time.Second))
+}
+
+func IsUpstreamUnavailable(err error) bool {
+	var unavailable *UpstreamUnavailableError
+	return errors.As(err, &unavailable)
+}
+
+// BreakerStatus is a snapshot of a breaker for health checks.
+type BreakerStatus struct {
+	State       BreakerState `json:"state"`
+	Requests    int          `json:"requests"`
+	Failures    int          `json:"failures"`
+	FailureRate float64      `json:"failure_rate"`
+	OpenedAt    *time.Time   `json:"opened_at,omitempty"`
+	RetryAt     *time.Time   `json:"retry_at,omitempty"`
+}
+
+// Breaker stops calls to an upstream that keeps failing. Closed, it counts
+// failures per window and opens past the failure rate. Open, calls fail
+// fast until OpenFor has passed. Half open, a few probe calls go through:
+// if all succeed it closes, any failure opens it again.
+type Breaker struct {
+	mu          sync.Mutex
+	name        string
+	config      configs.BreakerConfig
+	state       BreakerState
+	generation  int
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probes      int
+	successes   int
+}
+
+// NewBreaker guards the upstream called name in logs and errors.
+func NewBreaker(name string, config configs.BreakerConfig) *Breaker {
+	return &Breaker{name: name, config: config, state: BreakerClosed, windowStart: time.Now()}
+}
+
+// Allow asks to make a call. The returned func must be called with the
+// outcome of the call.
+func (b *Breaker) Allow() (func(err error), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	switch b.state {
+	case BreakerOpen:
+		if retryAt := b.openedAt.Add(b.config.OpenFor); now.Before(retryAt) {
+			return nil, &UpstreamUnavailableError{Upstream: b.name, RetryIn: retryAt.Sub(now)}
+		}
+		b.transition(BreakerHalfOpen, now)
+		fallthrough
+	case BreakerHalfOpen:
+		if b.probes >= b.config.HalfOpenProbes {
+			return nil, &UpstreamUnavailableError{Upstream: b.name, RetryIn: b.config.OpenFor}
+		}
+		b.probes++
+	default:
+		if now.Sub(b.windowStart) >= b.config.Window {
+			b.windowStart, b.requests, b.failures = now, 0, 0
+		}
+	}
+	generation := b.generation
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() { b.record(generation, err) })
+	}, nil
+}
+
+func (b *Breaker) record(generation int, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// outcomes of calls started before the last transition are stale
+	if generation != b.generation {
+		return
+	}
+	now := time.Now()
+	if errors.Is(err, context.Canceled) {
+		// the caller gave up, which says nothing about the upstream
+		if b.state == BreakerHalfOpen {
+			b.probes--
+		}
+		return
+	}
+	failed := countsAsFailure(err)
+	switch b.state {
+	case BreakerHalfOpen:
+		if failed {
+			b.transition(BreakerOpen, now)
+			return
+		}
+		b.successes++
+		if b.successes >= b.config.HalfOpenProbes {
+			b.transition(BreakerClosed, now)
+		}
+	case BreakerClosed:
+		b.requests++
+		if failed {
+			b.failures++
+		}
+		if b.requests >= b.config.MinRequests && float64(b.failures)/float64(b.requests) >= b.config.FailureRate {
+			b.transition(BreakerOpen, now)
+		}
+	}
+}
+
+func (b *Breaker) transition(state BreakerState, now time.Time) {
+	log.Printf("%s circuit breaker %s -> %s", b.name, b.state, state)
+	b.state = state
+	b.generation++
+	b.probes, b.successes = 0, 0
+	switch state {
+	case BreakerOpen:
+		b.openedAt = now
+	case BreakerClosed:
+		b.windowStart, b.requests, b.failures = now, 0, 0
+	}
+}
+
+func (b *Breaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	status := BreakerStatus{State: b.state, Requests: b.requests, Failures: b.failures}
+	if b.requests > 0 {
+		status.FailureRate = float64(b.failures) / float64(b.requests)
+	}
+	if b.state != BreakerClosed {
+		openedAt, retryAt := b.openedAt, b.openedAt.Add(b.config.OpenFor)
+		status.OpenedAt, status.RetryAt = &openedAt, &retryAt
+	}
+	return status
+}
+
+// countsAsFailure tells upstream trouble from answers about the request:
+// a 404 or 409 means the upstream is up.
+func countsAsFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= 500 || apiErr.StatusCode == http.StatusTooManyRequests
+	}
+	return true
+}
@@ -3,14 +3,15 @@ package clients
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
-	"sync"
 	"time"
+
+	models "github.com/sdutt/agentserver/models/lyzr"
 )
 
 // APIError as before...
@@ -23,84 +24,71 @@ func (e *APIError) Error() string {
 	return fmt.Sprintf("API error: %s (status %d)", e.Message, e.StatusCode)
 }
 
-type AgentResponse struct {
-	ID      string `json:"id"`
-	Name    string `json:"name"`
-	Status  string `json:"status"`
-	Message string `json:"message"`
-	AgentId string `json:"agent_id"`
+// CredentialResponse is a stored provider credential. Lyzr names its id
+// differently across endpoints, so every spelling is accepted.
+type CredentialResponse struct {
+	ID          string                 `json:"id"`
+	Name        string                 `json:"name"`
+	ProviderID  string                 `json:"provider_id"`
+	Type        string                 `json:"type,omitempty"`
+	Credentials map[string]interface{} `json:"credentials"`
+	MetaData    map[string]interface{} `json:"meta_data"`
+	CreatedAt   string                 `json:"created_at,omitempty"`
+	UpdatedAt   string                 `json:"updated_at,omitempty"`
 }
 
-type Agent struct {
-	ID                   string                 `json:"_id"`
-	ApiKey               string                 `json:"api_key"`
-	Name                 string                 `json:"name"`
-	Description          string                 `json:"description"`
-	AgentRole            *string                `json:"agent_role"`             // nullable
-	AgentInstructions    *string                `json:"agent_instructions"`     // nullable
-	AgentGoal            *string                `json:"agent_goal"`             // nullable
-	AgentContext         interface{}            `json:"agent_context"`          // could be null/any
-	AgentOutput          interface{}            `json:"agent_output"`           // could be null/any
-	Examples             interface{}            `json:"examples"`               // could be null/any
-	Features             []interface{}          `json:"features"`               // empty slice on some, can contain values
-	Tool                 string                 `json:"tool,omitempty"`         // sometimes present, sometimes absent
-	Tools                []interface{}          `json:"tools,omitempty"`        // sometimes present, sometimes absent
-	ToolUsageDescription interface{}            `json:"tool_usage_description"` // can be string, object or null
-	ResponseFormat       map[string]interface{} `json:"response_format"`        // sometimes "type":"text", sometimes empty object
-	ProviderID           string                 `json:"provider_id"`
-	Model                string                 `json:"model"`
-	TopP                 float64                `json:"top_p"`
-	Temperature          float64                `json:"temperature"`
-	ManagedAgents        interface{}            `json:"managed_agents"` // could be []interface{}, null, or absent
-	Version              string                 `json:"version"`
-	CreatedAt            string                 `json:"created_at"`
-	UpdatedAt            string                 `json:"updated_at"`
-	LLM_CredentialID     string                 `json:"llm_credential_id"`
-	TemplateType         string                 `json:"template_type,omitempty"` // sometimes present
+func (cred *CredentialResponse) UnmarshalJSON(data []byte) error {
+	type plain CredentialResponse
+	var raw struct {
+		plain
+		MongoID      string `json:"_id"`
+		CredentialID string `json:"credential_id"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*cred = CredentialResponse(raw.plain)
+	for _, id := range []string{raw.CredentialID, raw.MongoID} {
+		if cred.ID == "" {
+			cred.ID = id
+		}
+	}
+	return nil
 }
 
-type ListAgentResponse struct {
-	Agents []Agent `json:"agents"`
+// Mask hides every secret but its last four characters, and short secrets
+// entirely. Values that are not strings, such as nested objects, are
+// replaced whole.
+func (cred *CredentialResponse) Mask() {
+	for key, value := range cred.Credentials {
+		secret, ok := value.(string)
+		if !ok || len(secret) < 12 {
+			cred.Credentials[key] = "****"
+		} else {
+			cred.Credentials[key] = "****" + secret[len(secret)-4:]
+		}
+	}
 }
 
-var (
-	transport = &http.Transport{
-		MaxIdleConns:        100,
-		MaxIdleConnsPerHost: 100,
-		IdleConnTimeout:     90 * time.Second,
-		TLSHandshakeTimeout: 10 * time.Second,
-		// Optionally, you can tune TLS settings if desired:
-		TLSClientConfig: &tls.Config{
-			MinVersion: tls.VersionTLS12,
-			// InsecureSkipVerify: true, // Not recommended for production!
-		},
-		// For HTTPS, no need for DialContext/Nagle. Go handles this.
-	}
-	sharedClient *http.Client
-	once         sync.Once
-)
-
-func getHTTPClient() *http.Client {
-	once.Do(func() {
-		sharedClient = &http.Client{
-			Transport: transport,
-			Timeout:   15 * time.Second,
-		}
-	})
-	return sharedClient
+type ListAgentResponse struct {
+	Agents []models.Agent `json:"agents"`
 }
 
+// defaultHTTPClient serves MakeAPICall callers that bring no client.
+var defaultHTTPClient = &http.Client{Transport: newTransport()}
+
 func CallAndUnmarshal[T any](
 	ctx context.Context,
 	method, url string,
 	payload interface{},
 	headers map[string]string,
+	opts ...CallOption,
 ) (*T, error) {
-	respBody, err := MakeAPICall(ctx, method, url, payload, headers)
+	respBody, err := MakeAPICall(ctx, method, url, payload, headers, opts...)
 	if err != nil {
 		var apiErr *APIError
 		if errors.As(err, &apiErr) {
-			fmt.Printf("API error: status %d\nFull response body:\n%s\n", apiErr.StatusCode, apiErr.Message)
+			fmt.Printf("API error: status %d, %d byte body\n", apiErr.StatusCode, len(apiErr.Message))
 		} else {
 			fmt.Printf("Network/request failure: %v\n", err)
 		}
@@ -108,53 +96,122 @@ func CallAndUnmarshal[T any](
 	}
 	var out T
 	if err := json.Unmarshal(respBody, &out); err != nil {
-		fmt.Printf("Failed to unmarshal response. Raw body:\n%s\n", string(respBody))
+		// the body is not printed, as it may hold credentials
+		fmt.Printf("Failed to unmarshal %d byte response of %s %s: %v\n", len(respBody), method, url, err)
 		return nil, fmt.Errorf("failed to unmarshal: %w", err)
 	}
 	return &out, nil
 }
 
+// MakeAPICall sends one request, retrying transient failures according to
+// the call's retry policy when the request is safe to repeat. With a
+// breaker, every attempt is subject to it.
 func MakeAPICall(
 	ctx context.Context,
 	method, url string,
 	payload interface{},
 	headers map[string]string,
+	opts ...CallOption,
 ) ([]byte, error) {
-	var body io.Reader
+	options := newCallOptions(opts)
+	var jsonData []byte
 	if payload != nil {
-		jsonData, err := json.Marshal(payload)
+		var err error
+		jsonData, err = json.Marshal(payload)
 		if err != nil {
 			return nil, fmt.Errorf("failed to marshal payload: %w", err)
 		}
-		body = bytes.NewReader(jsonData)
 	}
 
+	started := time.Now()
+	for attempt := 1; ; attempt++ {
+		req, err := newRequest(ctx, method, url, jsonData, headers, options)
+		if err != nil {
+			return nil, err
+		}
+
+		var done func(error)
+		if options.breaker != nil {
+			if done, err = options.breaker.Allow(); err != nil {
+				return nil, err
+			}
+		}
+		respBody, wait, err := doAPICall(options.httpClient, req, options.timeout)
+		if done != nil {
+			done(err)
+		}
+		if err == nil {
+			return respBody, nil
+		}
+		if wait < 0 || !retryable(req) || attempt >= options.retry.MaxAttempts || ctx.Err() != nil {
+			return nil, err
+		}
+		if wait == 0 {
+			wait = options.retry.backoff(attempt + 1)
+		}
+		if options.retry.MaxElapsed > 0 && time.Since(started)+wait > options.retry.MaxElapsed {
+			return nil, err
+		}
+		log.Printf("%s %s failed (attempt %d), retrying in %s: %v", method, req.URL.Path, attempt, wait, err)
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(wait):
+		}
+	}
+}
+
+func newRequest(ctx context.Context, method, url string, jsonData []byte, headers map[string]string, options *callOptions) (*http.Request, error) {
+	var body io.Reader
+	if jsonData != nil {
+		body = bytes.NewReader(jsonData)
+	}
 	req, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
-
 	req.Header.Set("Content-Type", "application/json")
 	for k, v := range headers {
 		req.Header.Set(k, v)
 	}
+	if options.idempotencyKey != "" {
+		req.Header.Set(HeaderIdempotencyKey, options.idempotencyKey)
+	}
+	if options.userAgent != "" {
+		req.Header.Set("User-Agent", options.userAgent)
+	}
+	return req, nil
+}
 
-	client := getHTTPClient()
+// doAPICall makes one attempt within timeout, if set. On failure, wait is
+// negative when the error is final, or how long the API asked to wait
+// before retrying, if it did.
+func doAPICall(client *http.Client, req *http.Request, timeout time.Duration) (respBody []byte, wait time.Duration, err error) {
+	if timeout > 0 {
+		ctx, cancel := context.WithTimeout(req.Context(), timeout)
+		defer cancel()
+		req = req.WithContext(ctx)
+	}
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
+		return nil, 0, fmt.Errorf("request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
-	respBody, err := io.ReadAll(resp.Body)
+	respBody, err = io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return nil, 0, fmt.Errorf("failed to read response body: %w", err)
 	}
 
 	if resp.StatusCode >= 300 {
-		return nil, &APIError{StatusCode: resp.StatusCode, Message: string(respBody)}
+		err = &APIError{StatusCode: resp.StatusCode, Message: string(respBody)}
+		if !transientStatus(resp.StatusCode) {
+			return nil, -1, err
+		}
+		wait, _ = retryAfter(resp.Header.Get("Retry-After"))
+		return nil, wait, err
 	}
 
-	return respBody, nil
+	return respBody, 0, nil
 }
@@ -3,48 +3,205 @@ package clients
 import (
 	"context"
 	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/sdutt/agentserver/configs"
 	models "github.com/sdutt/agentserver/models/lyzr"
 )
 
+// ProviderName is the agent provider name of the Lyzr backend.
+const ProviderName = "lyzr"
+
 type LyzrClient struct {
-	config *configs.AppConfig
+	config  *configs.AppConfig
+	breaker *Breaker
+
+	httpClient *http.Client
+	transport  http.RoundTripper
+	middleware []Middleware
+	timeout    time.Duration
+	timeouts   map[Operation]time.Duration
+	userAgent  string
+}
+
+// NewLyzrClient takes its timeouts from config; opts override them and
+// plug in a custom client, transport or middleware.
+func NewLyzrClient(config *configs.AppConfig, opts ...Option) *LyzrClient {
+	client := &LyzrClient{
+		config:    config,
+		breaker:   NewBreaker(ProviderName, config.LyzrBreaker),
+		timeout:   config.LyzrTimeout.Default,
+		timeouts:  map[Operation]time.Duration{OpChat: config.LyzrTimeout.Chat},
+		userAgent: config.Name + "/" + config.Version,
+	}
+	for _, opt := range opts {
+		opt(client)
+	}
+	client.httpClient = client.buildHTTPClient()
+	return client
+}
+
+func (client *LyzrClient) Name() string {
+	return ProviderName
+}
+
+// BreakerStatus reports the circuit breaker guarding the Lyzr API.
+func (client *LyzrClient) BreakerStatus() BreakerStatus {
+	return client.breaker.Status()
 }
 
-func NewLyzrClient(config *configs.AppConfig) *LyzrClient {
-	return &LyzrClient{config}
+// options puts the client's settings for op in front of the caller's
+// options.
+func (client *LyzrClient) options(op Operation, opts []CallOption) []CallOption {
+	timeout, ok := client.timeouts[op]
+	if !ok {
+		timeout = client.timeout
+	}
+	return append([]CallOption{
+		WithCallBreaker(client.breaker),
+		WithCallHTTPClient(client.httpClient),
+		WithCallUserAgent(client.userAgent),
+		WithCallTimeout(timeout),
+	}, opts...)
 }
 
-func (client *LyzrClient) CreateAgent(ctx context.Context, payload models.AgentPayload) (*AgentResponse, error) {
+func (client *LyzrClient) CreateAgent(ctx context.Context, payload models.AgentPayload, opts ...CallOption) (*models.AgentResponse, error) {
 	url := client.config.LyzrAPIURL + "/v3/agents/"
 	headers := map[string]string{
 		"x-api-key": client.config.LyzrAPIKey,
 	}
-	return CallAndUnmarshal[AgentResponse](
-		ctx, http.MethodPost, url, payload, headers,
+	return CallAndUnmarshal[models.AgentResponse](
+		ctx, http.MethodPost, url, payload, headers, client.options(OpCreateAgent, opts)...,
 	)
 }
 
-func (client *LyzrClient) ListAgents(ctx context.Context) ([]Agent, error) {
+func (client *LyzrClient) ListAgents(ctx context.Context, opts ...CallOption) ([]models.Agent, error) {
 	url := client.config.LyzrAPIURL + "/v3/agents/"
 	headers := map[string]string{
 		"x-api-key": client.config.LyzrAPIKey,
 		"accept":    "application/json",
 	}
-	resp, err := CallAndUnmarshal[[]Agent](
-		ctx, http.MethodGet, url, nil, headers,
+	resp, err := CallAndUnmarshal[[]models.Agent](
+		ctx, http.MethodGet, url, nil, headers, client.options(OpListAgents, opts)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return *resp, nil
+}
+
+func (client *LyzrClient) GetAgent(ctx context.Context, agentID string, opts ...CallOption) (*models.Agent, error) {
+	url := client.config.LyzrAPIURL + "/v3/agents/" + url.PathEscape(agentID)
+	headers := map[string]string{
+		"x-api-key": client.config.LyzrAPIKey,
+		"accept":    "application/json",
+	}
+	return CallAndUnmarshal[models.Agent](
+		ctx, http.MethodGet, url, nil, headers, client.options(OpGetAgent, opts)...,
+	)
+}
+
+// UpdateAgent replaces the configuration of an agent.
+func (client *LyzrClient) UpdateAgent(ctx context.Context, agentID string, payload models.AgentPayload, opts ...CallOption) (*models.AgentResponse, error) {
+	url := client.config.LyzrAPIURL + "/v3/agents/" + url.PathEscape(agentID)
+	headers := map[string]string{
+		"x-api-key": client.config.LyzrAPIKey,
+		"accept":    "application/json",
+	}
+	return CallAndUnmarshal[models.AgentResponse](
+		ctx, http.MethodPut, url, payload, headers, client.options(OpUpdateAgent, opts)...,
+	)
+}
+
+func (client *LyzrClient) DeleteAgent(ctx context.Context, agentID string, opts ...CallOption) error {
+	url := client.config.LyzrAPIURL + "/v3/agents/" + url.PathEscape(agentID)
+	headers := map[string]string{
+		"x-api-key": client.config.LyzrAPIKey,
+		"accept":    "application/json",
+	}
+	_, err := MakeAPICall(ctx, http.MethodDelete, url, nil, headers, client.options(OpDeleteAgent, opts)...)
+	return err
+}
+
+func (client *LyzrClient) CreateCredentials(ctx context.Context, payload models.CredentialPayload, opts ...CallOption) (*CredentialResponse, error) {
+	url := client.config.LyzrAPIURL + "/v3/tools/credentials"
+	headers := map[string]string{
+		"x-api-key": client.config.LyzrAPIKey,
+		"accept":    "application/json",
+	}
+	return CallAndUnmarshal[CredentialResponse](
+		ctx, http.MethodPost, url, payload, headers, client.options(OpCreateCredential, opts)...,
 	)
-	return *resp, err
 }
 
-func (client *LyzrClient) CreateCredentials(ctx context.Context, payload models.CredentialPayload) (*AgentResponse, error) {
+func (client *LyzrClient) ListCredentials(ctx context.Context, opts ...CallOption) ([]CredentialResponse, error) {
 	url := client.config.LyzrAPIURL + "/v3/tools/credentials"
 	headers := map[string]string{
 		"x-api-key": client.config.LyzrAPIKey,
 		"accept":    "application/json",
 	}
-	return CallAndUnmarshal[AgentResponse](
-		ctx, http.MethodPost, url, payload, headers,
+	resp, err := CallAndUnmarshal[[]CredentialResponse](
+		ctx, http.MethodGet, url, nil, headers, client.options(OpListCredentials, opts)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return *resp, nil
+}
+
+func (client *LyzrClient) GetCredential(ctx context.Context, credentialID string, opts ...CallOption) (*CredentialResponse, error) {
+	url := client.config.LyzrAPIURL + "/v3/tools/credentials/" + url.PathEscape(credentialID)
+	headers := map[string]string{
+		"x-api-key": client.config.LyzrAPIKey,
+		"accept":    "application/json",
+	}
+	return CallAndUnmarshal[CredentialResponse](
+		ctx, http.MethodGet, url, nil, headers, client.options(OpGetCredential, opts)...,
+	)
+}
+
+// RotateCredential swaps the secrets of a credential in place, keeping its
+// id so agents referencing it pick the new secrets up.
+func (client *LyzrClient) RotateCredential(ctx context.Context, credentialID string, secrets map[string]interface{}, opts ...CallOption) (*CredentialResponse, error) {
+	current, err := client.GetCredential(ctx, credentialID, opts...)
+	if err != nil {
+		return nil, err
+	}
+	payload := models.CredentialPayload{
+		Name:        current.Name,
+		ProviderID:  current.ProviderID,
+		Credentials: secrets,
+		MetaData:    current.MetaData,
+	}
+	url := client.config.LyzrAPIURL + "/v3/tools/credentials/" + url.PathEscape(credentialID)
+	headers := map[string]string{
+		"x-api-key": client.config.LyzrAPIKey,
+		"accept":    "application/json",
+	}
+	if _, err := MakeAPICall(ctx, http.MethodPut, url, payload, headers, client.options(OpRotateCredential, opts)...); err != nil {
+		return nil, err
+	}
+	return client.GetCredential(ctx, credentialID, opts...)
+}
+
+func (client *LyzrClient) DeleteCredential(ctx context.Context, credentialID string, opts ...CallOption) error {
+	url := client.config.LyzrAPIURL + "/v3/tools/credentials/" + url.PathEscape(credentialID)
+	headers := map[string]string{
+		"x-api-key": client.config.LyzrAPIKey,
+		"accept":    "application/json",
+	}
+	_, err := MakeAPICall(ctx, http.MethodDelete, url, nil, headers, client.options(OpDeleteCredential, opts)...)
+	return err
+}
+
+func (client *LyzrClient) Chat(ctx context.Context, payload models.ChatPayload, opts ...CallOption) (*models.ChatResponse, error) {
+	url := client.config.LyzrAPIURL + "/v3/inference/chat/"
+	headers := map[string]string{
+		"x-api-key": client.config.LyzrAPIKey,
+		"accept":    "application/json",
+	}
+	return CallAndUnmarshal[models.ChatResponse](
+		ctx, http.MethodPost, url, payload, headers, client.options(OpChat, opts)...,
 	)
 }
@@ -0,0 +1,130 @@
+package clients
+
+import (
+	"crypto/tls"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Operation names a LyzrClient call for per-operation settings.
+type Operation string
+
+const (
+	OpCreateAgent      Operation = "create_agent"
+	OpListAgents       Operation = "list_agents"
+	OpGetAgent         Operation = "get_agent"
+	OpUpdateAgent      Operation = "update_agent"
+	OpDeleteAgent      Operation = "delete_agent"
+	OpCreateCredential Operation = "create_credential"
+	OpListCredentials  Operation = "list_credentials"
+	OpGetCredential    Operation = "get_credential"
+	OpRotateCredential Operation = "rotate_credential"
+	OpDeleteCredential Operation = "delete_credential"
+	OpChat             Operation = "chat"
+)
+
+// Option configures a LyzrClient.
+type Option func(*LyzrClient)
+
+// Middleware wraps the transport of every request, e.g. to log or measure
+// calls.
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc lets a function serve as an http.RoundTripper.
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// WithHTTPClient sends requests through client, e.g. one trusting a test
+// server's certificate.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(client *LyzrClient) {
+		client.httpClient = httpClient
+	}
+}
+
+// WithTransport keeps the default client but swaps its transport.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(client *LyzrClient) {
+		client.transport = transport
+	}
+}
+
+// WithTimeout bounds each attempt of every operation without its own
+// timeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(client *LyzrClient) {
+		client.timeout = timeout
+	}
+}
+
+// WithOperationTimeout bounds each attempt of one operation.
+func WithOperationTimeout(op Operation, timeout time.Duration) Option {
+	return func(client *LyzrClient) {
+		client.timeouts[op] = timeout
+	}
+}
+
+func WithUserAgent(userAgent string) Option {
+	return func(client *LyzrClient) {
+		client.userAgent = userAgent
+	}
+}
+
+// WithMiddleware adds transport middleware; the first one added sees the
+// request first.
+func WithMiddleware(middleware ...Middleware) Option {
+	return func(client *LyzrClient) {
+		client.middleware = append(client.middleware, middleware...)
+	}
+}
+
+// LogRequests logs every request with its status and duration. API keys
+// are never logged.
+func LogRequests(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		started := time.Now()
+		resp, err := next.RoundTrip(req)
+		if err != nil {
+			log.Printf("Lyzr %s %s failed after %s: %v", req.Method, req.URL.Path, time.Since(started).Round(time.Millisecond), err)
+			return nil, err
+		}
+		log.Printf("Lyzr %s %s %d in %s", req.Method, req.URL.Path, resp.StatusCode, time.Since(started).Round(time.Millisecond))
+		return resp, nil
+	})
+}
+
+func newTransport() *http.Transport {
+	return &http.Transport{
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 100,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+		TLSClientConfig: &tls.Config{
+			MinVersion: tls.VersionTLS12,
+		},
+	}
+}
+
+// buildHTTPClient wraps the configured client or transport in the
+// middleware.
+func (client *LyzrClient) buildHTTPClient() *http.Client {
+	httpClient := &http.Client{}
+	if client.httpClient != nil {
+		copied := *client.httpClient
+		httpClient = &copied
+	}
+	if client.transport != nil {
+		httpClient.Transport = client.transport
+	}
+	if httpClient.Transport == nil {
+		httpClient.Transport = newTransport()
+	}
+	for i := len(client.middleware) - 1; i >= 0; i-- {
+		httpClient.Transport = client.middleware[i](httpClient.Transport)
+	}
+	return httpClient
+}
@@ -0,0 +1,140 @@
+package clients
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HeaderIdempotencyKey marks a POST as safe to repeat.
+const HeaderIdempotencyKey = "Idempotency-Key"
+
+// RetryPolicy decides how often a failed call is repeated. Only idempotent
+// methods and POSTs carrying an idempotency key are ever retried.
+type RetryPolicy struct {
+	// MaxAttempts counts the first try; 1 disables retries.
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	// MaxElapsed bounds the time spent on all attempts and waits; a
+	// Retry-After beyond it ends the call.
+	MaxElapsed time.Duration
+}
+
+// DefaultRetryPolicy is used by calls that do not set their own.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   250 * time.Millisecond,
+	MaxDelay:    5 * time.Second,
+	MaxElapsed:  20 * time.Second,
+}
+
+// NoRetry makes a single attempt.
+var NoRetry = RetryPolicy{MaxAttempts: 1}
+
+type callOptions struct {
+	retry          RetryPolicy
+	idempotencyKey string
+	breaker        *Breaker
+	httpClient     *http.Client
+	timeout        time.Duration
+	userAgent      string
+}
+
+// CallOption configures one MakeAPICall.
+type CallOption func(*callOptions)
+
+func WithRetryPolicy(policy RetryPolicy) CallOption {
+	return func(opts *callOptions) {
+		opts.retry = policy
+	}
+}
+
+// WithIdempotencyKey sends key so the API can drop repeated requests, which
+// makes a POST retryable.
+func WithIdempotencyKey(key string) CallOption {
+	return func(opts *callOptions) {
+		opts.idempotencyKey = key
+	}
+}
+
+// WithCallTimeout bounds each attempt of this call.
+func WithCallTimeout(timeout time.Duration) CallOption {
+	return func(opts *callOptions) {
+		opts.timeout = timeout
+	}
+}
+
+func WithCallHTTPClient(httpClient *http.Client) CallOption {
+	return func(opts *callOptions) {
+		opts.httpClient = httpClient
+	}
+}
+
+func WithCallUserAgent(userAgent string) CallOption {
+	return func(opts *callOptions) {
+		opts.userAgent = userAgent
+	}
+}
+
+// WithCallBreaker guards the call with a client's circuit breaker.
+func WithCallBreaker(breaker *Breaker) CallOption {
+	return func(opts *callOptions) {
+		opts.breaker = breaker
+	}
+}
+
+func newCallOptions(opts []CallOption) *callOptions {
+	options := &callOptions{retry: DefaultRetryPolicy, httpClient: defaultHTTPClient}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// retryable reports whether a request may be sent again at all.
+func retryable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	case http.MethodPost, http.MethodPatch:
+		return req.Header.Get(HeaderIdempotencyKey) != ""
+	}
+	return false
+}
+
+// transientStatus lists the answers that may go away on their own.
+func transientStatus(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusTooEarly, http.StatusTooManyRequests,
+		http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// backoff is the wait before attempt (2 for the first retry), doubled each
+// time and jittered down by up to half so clients spread out.
+func (policy RetryPolicy) backoff(attempt int) time.Duration {
+	delay := policy.BaseDelay
+	for i := 2; i < attempt && delay < policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, policy.MaxDelay)
+	return delay - time.Duration(rand.Int63n(int64(delay)/2+1))
+}
+
+// retryAfter parses a Retry-After header given in seconds or as a date.
+func retryAfter(header string) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(header); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
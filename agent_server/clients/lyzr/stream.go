@@ -0,0 +1,144 @@
+package clients
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	models "github.com/sdutt/agentserver/models/lyzr"
+)
+
+// endOfStream is the data of the last server-sent event of a stream.
+const endOfStream = "[DONE]"
+
+// OpenStream sends a request whose answer is read as it arrives. Partial
+// output cannot be taken back, so it is never retried; the timeout of the
+// call bounds the whole stream. The caller closes the returned body.
+func OpenStream(
+	ctx context.Context,
+	method, url string,
+	payload interface{},
+	headers map[string]string,
+	opts ...CallOption,
+) (io.ReadCloser, error) {
+	options := newCallOptions(opts)
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+	cancel := context.CancelFunc(func() {})
+	if options.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, options.timeout)
+	}
+	req, err := newRequest(ctx, method, url, jsonData, headers, options)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	var done func(error)
+	if options.breaker != nil {
+		if done, err = options.breaker.Allow(); err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+	resp, err := options.httpClient.Do(req)
+	if err == nil && resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		err = &APIError{StatusCode: resp.StatusCode, Message: string(respBody)}
+	} else if err != nil {
+		err = fmt.Errorf("request failed: %w", err)
+	}
+	if done != nil {
+		done(err)
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &streamBody{resp.Body, cancel}, nil
+}
+
+// streamBody releases the stream's timeout once it is closed.
+type streamBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (body *streamBody) Close() error {
+	defer body.cancel()
+	return body.ReadCloser.Close()
+}
+
+// ReadEvents calls handle with the data of every server-sent event in body
+// until the stream ends.
+func ReadEvents(body io.Reader, handle func(data string) error) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var data []string
+	flush := func() error {
+		if len(data) == 0 {
+			return nil
+		}
+		event := strings.Join(data, "\n")
+		data = data[:0]
+		if event == endOfStream {
+			return io.EOF
+		}
+		return handle(event)
+	}
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if err := flush(); err != nil {
+				return ignoreEOF(err)
+			}
+			continue
+		}
+		if value, ok := strings.CutPrefix(line, "data:"); ok {
+			data = append(data, strings.TrimPrefix(value, " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return ignoreEOF(flush())
+}
+
+func ignoreEOF(err error) error {
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// Stream is Chat with the reply passed to onDelta piece by piece as Lyzr
+// produces it. The returned response holds the whole reply.
+func (client *LyzrClient) Stream(ctx context.Context, payload models.ChatPayload, onDelta func(delta string) error, opts ...CallOption) (*models.ChatResponse, error) {
+	url := client.config.LyzrAPIURL + "/v3/inference/stream/"
+	headers := map[string]string{
+		"x-api-key": client.config.LyzrAPIKey,
+	}
+	body, err := OpenStream(ctx, http.MethodPost, url, payload, headers, client.options(OpChat, opts)...)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var reply strings.Builder
+	err = ReadEvents(body, func(data string) error {
+		reply.WriteString(data)
+		return onDelta(data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &models.ChatResponse{Response: reply.String()}, nil
+}
@@ -0,0 +1,303 @@
+// Package openai runs agents against an OpenAI-compatible chat completions
+// API. Such APIs have no notion of agents, so their definitions are kept
+// in the local agent store.
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	clients "github.com/sdutt/agentserver/clients/lyzr"
+	"github.com/sdutt/agentserver/configs"
+	agents "github.com/sdutt/agentserver/models/agents"
+	models "github.com/sdutt/agentserver/models/lyzr"
+	"github.com/sdutt/agentserver/repository"
+)
+
+type Client struct {
+	config     *configs.OpenAIConfig
+	agents     repository.LocalAgentRepository
+	breaker    *clients.Breaker
+	httpClient *http.Client
+	userAgent  string
+}
+
+type Option func(*Client)
+
+// WithHTTPClient sends requests through httpClient, e.g. one trusting a
+// test server's certificate.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(client *Client) {
+		client.httpClient = httpClient
+	}
+}
+
+func WithUserAgent(userAgent string) Option {
+	return func(client *Client) {
+		client.userAgent = userAgent
+	}
+}
+
+func NewClient(config *configs.OpenAIConfig, agents repository.LocalAgentRepository, opts ...Option) *Client {
+	client := &Client{
+		config:     config,
+		agents:     agents,
+		breaker:    clients.NewBreaker(config.Name, config.Breaker),
+		httpClient: &http.Client{},
+	}
+	for _, opt := range opts {
+		opt(client)
+	}
+	return client
+}
+
+func (client *Client) Name() string {
+	return client.config.Name
+}
+
+func (client *Client) BreakerStatus() clients.BreakerStatus {
+	return client.breaker.Status()
+}
+
+// errAgentNotFound reads like the answer of an API that stores agents, so
+// callers handle both providers alike.
+var errAgentNotFound = &clients.APIError{StatusCode: http.StatusNotFound, Message: "agent not found"}
+
+func (client *Client) CreateAgent(ctx context.Context, payload models.AgentPayload, opts ...clients.CallOption) (*models.AgentResponse, error) {
+	payload.Provider = ""
+	agent := &agents.LocalAgent{Provider: client.Name(), Payload: payload}
+	if err := client.agents.CreateAgent(ctx, agent); err != nil {
+		return nil, err
+	}
+	return &models.AgentResponse{ID: agent.ID, AgentId: agent.ID, Name: payload.Name, Message: "agent created"}, nil
+}
+
+func (client *Client) ListAgents(ctx context.Context, opts ...clients.CallOption) ([]models.Agent, error) {
+	stored, err := client.agents.ListAgents(ctx, client.Name())
+	if err != nil {
+		return nil, err
+	}
+	out := make([]models.Agent, 0, len(stored))
+	for i := range stored {
+		out = append(out, toAgent(&stored[i]))
+	}
+	return out, nil
+}
+
+func (client *Client) GetAgent(ctx context.Context, agentID string, opts ...clients.CallOption) (*models.Agent, error) {
+	stored, err := client.getAgent(ctx, agentID)
+	if err != nil {
+		return nil, err
+	}
+	agent := toAgent(stored)
+	return &agent, nil
+}
+
+func (client *Client) UpdateAgent(ctx context.Context, agentID string, payload models.AgentPayload, opts ...clients.CallOption) (*models.AgentResponse, error) {
+	stored, err := client.getAgent(ctx, agentID)
+	if err != nil {
+		return nil, err
+	}
+	payload.Provider = ""
+	stored.Payload = payload
+	if err := client.agents.UpdateAgent(ctx, stored); err != nil {
+		return nil, err
+	}
+	return &models.AgentResponse{ID: agentID, AgentId: agentID, Name: payload.Name, Message: "agent updated"}, nil
+}
+
+func (client *Client) DeleteAgent(ctx context.Context, agentID string, opts ...clients.CallOption) error {
+	if _, err := client.getAgent(ctx, agentID); err != nil {
+		return err
+	}
+	return client.agents.DeleteAgent(ctx, agentID)
+}
+
+func (client *Client) getAgent(ctx context.Context, agentID string) (*agents.LocalAgent, error) {
+	agent, err := client.agents.GetAgent(ctx, agentID)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && agent.Provider != client.Name()) {
+		return nil, errAgentNotFound
+	}
+	return agent, err
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatRequest struct {
+	Model          string                 `json:"model"`
+	Messages       []chatMessage          `json:"messages"`
+	Temperature    float64                `json:"temperature"`
+	TopP           float64                `json:"top_p"`
+	ResponseFormat map[string]interface{} `json:"response_format,omitempty"`
+	User           string                 `json:"user,omitempty"`
+	Stream         bool                   `json:"stream,omitempty"`
+	StreamOptions  *streamOptions         `json:"stream_options,omitempty"`
+}
+
+type streamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type chatCompletion struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+		Delta   chatMessage `json:"delta"`
+	} `json:"choices"`
+	Usage *models.Usage `json:"usage"`
+}
+
+// Chat answers payload.Message with the agent's instructions as the system
+// prompt. The API keeps no session memory: the message is expected to
+// carry the context of the conversation, as the chat service's prompts do.
+func (client *Client) Chat(ctx context.Context, payload models.ChatPayload, opts ...clients.CallOption) (*models.ChatResponse, error) {
+	request, err := client.chatRequest(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+	completion, err := clients.CallAndUnmarshal[chatCompletion](
+		ctx, http.MethodPost, client.url("/chat/completions"), request, client.headers(), client.options(opts)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(completion.Choices) == 0 {
+		return nil, &clients.APIError{StatusCode: http.StatusBadGateway, Message: "completion has no choices"}
+	}
+	return &models.ChatResponse{Response: completion.Choices[0].Message.Content, Usage: completion.Usage}, nil
+}
+
+// Stream is Chat with the reply passed to onDelta piece by piece.
+func (client *Client) Stream(ctx context.Context, payload models.ChatPayload, onDelta func(delta string) error, opts ...clients.CallOption) (*models.ChatResponse, error) {
+	request, err := client.chatRequest(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+	request.Stream = true
+	// the last chunk then carries the usage of the whole reply
+	request.StreamOptions = &streamOptions{IncludeUsage: true}
+	body, err := clients.OpenStream(
+		ctx, http.MethodPost, client.url("/chat/completions"), request, client.headers(), client.options(opts)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var reply strings.Builder
+	var usage *models.Usage
+	err = clients.ReadEvents(body, func(data string) error {
+		var chunk chatCompletion
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return err
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			return nil
+		}
+		reply.WriteString(chunk.Choices[0].Delta.Content)
+		return onDelta(chunk.Choices[0].Delta.Content)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &models.ChatResponse{Response: reply.String(), Usage: usage}, nil
+}
+
+type modelList struct {
+	Data []struct {
+		ID string `json:"id"`
+	} `json:"data"`
+}
+
+// ListModels returns the ids of the models the server offers.
+func (client *Client) ListModels(ctx context.Context, opts ...clients.CallOption) ([]string, error) {
+	list, err := clients.CallAndUnmarshal[modelList](
+		ctx, http.MethodGet, client.url("/models"), nil, client.headers(), client.options(opts)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(list.Data))
+	for _, model := range list.Data {
+		ids = append(ids, model.ID)
+	}
+	return ids, nil
+}
+
+func (client *Client) chatRequest(ctx context.Context, payload models.ChatPayload) (*chatRequest, error) {
+	agent, err := client.getAgent(ctx, payload.AgentID)
+	if err != nil {
+		return nil, err
+	}
+	request := &chatRequest{
+		Model:       agent.Payload.Model,
+		Temperature: agent.Payload.GetTemperature(),
+		TopP:        agent.Payload.GetTopP(),
+		User:        payload.UserID,
+	}
+	// text is what the API answers anyway, and not every server accepts it
+	if format, _ := agent.Payload.ResponseFormat["type"].(string); format != "" && format != "text" {
+		request.ResponseFormat = agent.Payload.ResponseFormat
+	}
+	if agent.Payload.SystemPrompt != "" {
+		request.Messages = append(request.Messages, chatMessage{Role: "system", Content: agent.Payload.SystemPrompt})
+	}
+	request.Messages = append(request.Messages, chatMessage{Role: "user", Content: payload.Message})
+	return request, nil
+}
+
+func (client *Client) url(path string) string {
+	return strings.TrimSuffix(client.config.BaseURL, "/") + path
+}
+
+func (client *Client) headers() map[string]string {
+	headers := map[string]string{"accept": "application/json"}
+	if client.config.APIKey != "" {
+		headers["Authorization"] = "Bearer " + client.config.APIKey
+	}
+	return headers
+}
+
+func (client *Client) options(opts []clients.CallOption) []clients.CallOption {
+	return append([]clients.CallOption{
+		clients.WithCallBreaker(client.breaker),
+		clients.WithCallHTTPClient(client.httpClient),
+		clients.WithCallUserAgent(client.userAgent),
+		clients.WithCallTimeout(client.config.Timeout),
+	}, opts...)
+}
+
+func toAgent(stored *agents.LocalAgent) models.Agent {
+	payload := stored.Payload
+	agent := models.Agent{
+		ID:                stored.ID,
+		Provider:          stored.Provider,
+		Name:              payload.Name,
+		Description:       payload.Description,
+		AgentInstructions: &payload.SystemPrompt,
+		ResponseFormat:    payload.ResponseFormat,
+		ProviderID:        payload.ProviderID,
+		Model:             payload.Model,
+		TopP:              payload.GetTopP(),
+		Temperature:       payload.GetTemperature(),
+		LLM_CredentialID:  payload.LLMCredentialID,
+		CreatedAt:         stored.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:         stored.UpdatedAt.Format(time.RFC3339),
+	}
+	for _, feature := range payload.Features {
+		agent.Features = append(agent.Features, feature)
+	}
+	for _, tool := range payload.Tools {
+		agent.Tools = append(agent.Tools, tool)
+	}
+	return agent
+}
@@ -0,0 +1,11 @@
+package configs
+
+import "time"
+
+type AgentSyncConfig struct {
+	// Interval is how often the agent mirror is reconciled with the
+	// providers.
+	Interval time.Duration `mapstructure:"interval" validate:"gt=0"`
+	// KeepReports bounds the sync reports kept for drift reporting.
+	KeepReports int `mapstructure:"keep_reports" validate:"gt=0"`
+}
@@ -0,0 +1,16 @@
+package configs
+
+import "time"
+
+type BreakerConfig struct {
+	// Window is the period failures are counted over while closed.
+	Window time.Duration `mapstructure:"window" validate:"gt=0"`
+	// The breaker opens once MinRequests calls in a window failed at
+	// FailureRate or more.
+	MinRequests int     `mapstructure:"min_requests" validate:"gt=0"`
+	FailureRate float64 `mapstructure:"failure_rate" validate:"gt=0,lte=1"`
+	// OpenFor is how long calls fail fast before probes are let through.
+	OpenFor time.Duration `mapstructure:"open_for" validate:"gt=0"`
+	// HalfOpenProbes calls must all succeed to close the breaker again.
+	HalfOpenProbes int `mapstructure:"half_open_probes" validate:"gt=0"`
+}
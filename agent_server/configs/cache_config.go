@@ -0,0 +1,27 @@
+package configs
+
+import (
+	"fmt"
+	"time"
+)
+
+type CacheConfig struct {
+	// Driver selects the cache: memory for an LRU local to the instance,
+	// redis to share entries between instances.
+	Driver        string `mapstructure:"driver" validate:"oneof=memory redis"`
+	Host          string `mapstructure:"host"`
+	Port          int    `mapstructure:"port"`
+	Password      string `mapstructure:"password"`
+	MaxConnection int    `mapstructure:"max_connection" validate:"gt=0"`
+	// Prefix namespaces the keys written to a shared cache.
+	Prefix string `mapstructure:"prefix"`
+	// Size bounds the entries held by the memory cache.
+	Size           int           `mapstructure:"size" validate:"gt=0"`
+	AgentsTTL      time.Duration `mapstructure:"agents_ttl" validate:"gt=0"`
+	CredentialsTTL time.Duration `mapstructure:"credentials_ttl" validate:"gt=0"`
+	CatalogTTL     time.Duration `mapstructure:"catalog_ttl" validate:"gt=0"`
+}
+
+func (c CacheConfig) URL() string {
+	return fmt.Sprintf("%s:%d", c.Host, c.Port)
+}
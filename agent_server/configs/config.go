@@ -4,27 +4,59 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/go-playground/validator"
 	"github.com/spf13/viper"
 )
 
 type AppConfig struct {
-	Name             string   `mapstructure:"service_name" validate:"required"`
-	DBSource         string   `mapstructure:"db_source" validate:"required"`
-	DbConfig         DBConfig `mapstructure:"db" validate:"required"`
-	MigrationUrl     string   `mapstructure:"migration_url" validate:"required"`
-	Version          string   `mapstructure:"version" validate:"required"`
-	Host             string   `mapstructure:"host" validate:"required"`
-	Secret           string   `mapstructure:"secret" validate:"required"`
-	Port             int      `mapstructure:"port" validate:"required"`
-	WebTransportPort int      `mapstructure:"webtransport_port" validate:"required"`
-	HttpPort         int      `mapstructure:"http_port" validate:"required"`
-	LogLevel         string   `mapstructure:"log_level" validate:"required"`
-	CertPath         string   `mapstructure:"cert_path" validate:"required"`
-	KeyPath          string   `mapstructure:"key_path" validate:"required"`
-	LyzrAPIURL       string   `mapstructure:"lyzr_api_url" validate:"required"`
-	LyzrAPIKey       string   `mapstructure:"lyzr_api_key" validate:"required"`
+	Name             string            `mapstructure:"service_name" validate:"required"`
+	DBSource         string            `mapstructure:"db_source" validate:"required"`
+	DbConfig         DBConfig          `mapstructure:"db" validate:"required"`
+	MigrationUrl     string            `mapstructure:"migration_url" validate:"required"`
+	Version          string            `mapstructure:"version" validate:"required"`
+	Host             string            `mapstructure:"host" validate:"required"`
+	Secret           string            `mapstructure:"secret" validate:"required"`
+	Port             int               `mapstructure:"port" validate:"required"`
+	WebTransportPort int               `mapstructure:"webtransport_port" validate:"required"`
+	HttpPort         int               `mapstructure:"http_port" validate:"required"`
+	LogLevel         string            `mapstructure:"log_level" validate:"required"`
+	CertPath         string            `mapstructure:"cert_path" validate:"required"`
+	KeyPath          string            `mapstructure:"key_path" validate:"required"`
+	LyzrAPIURL       string            `mapstructure:"lyzr_api_url" validate:"required"`
+	LyzrAPIKey       string            `mapstructure:"lyzr_api_key" validate:"required"`
+	LyzrBreaker      BreakerConfig     `mapstructure:"lyzr_breaker"`
+	LyzrTimeout      LyzrTimeoutConfig `mapstructure:"lyzr_timeout"`
+	OpenAI           OpenAIConfig      `mapstructure:"openai"`
+	Context          ContextConfig     `mapstructure:"context"`
+	// PresenceAwayAfter is how long a connected participant may stay idle
+	// before it is reported away.
+	PresenceAwayAfter time.Duration `mapstructure:"presence_away_after"`
+	// PresenceRetention is how long offline participants stay listed with
+	// their last-seen time.
+	PresenceRetention time.Duration `mapstructure:"presence_retention"`
+	// QueueDriver selects the pub/sub broker: memory for a single
+	// instance, redis to fan chat events out across instances.
+	QueueDriver   string          `mapstructure:"queue_driver" validate:"oneof=memory redis"`
+	QueueHost     string          `mapstructure:"queue_host"`
+	QueuePort     int             `mapstructure:"queue_port"`
+	QueuePassword string          `mapstructure:"queue_password"`
+	Jobs          JobsConfig      `mapstructure:"jobs"`
+	Webhooks      WebhooksConfig  `mapstructure:"webhooks"`
+	Email         EmailConfig     `mapstructure:"email"`
+	Widgets       WidgetsConfig   `mapstructure:"widgets"`
+	AgentSync     AgentSyncConfig `mapstructure:"agent_sync"`
+	Cache         CacheConfig     `mapstructure:"cache"`
+	Pricing       PricingConfig   `mapstructure:"pricing"`
+	// OperatorKey authenticates operators: sockets send it as operator_key
+	// in the handshake, HTTP requests as a bearer token. Nobody can act as
+	// an operator while it is empty.
+	OperatorKey string `mapstructure:"operator_key"`
+	// TrustedProxies lists, comma separated, the addresses or CIDRs of the
+	// proxies whose X-Forwarded-For is believed; with none, the client IP
+	// is the peer address.
+	TrustedProxies string `mapstructure:"trusted_proxies"`
 }
 
 func (app *AppConfig) GetWebTransportURL() string {
@@ -39,6 +71,10 @@ func (app *AppConfig) GetHttpUrl() string {
 	return fmt.Sprintf("%s:%d", app.Host, app.HttpPort)
 }
 
+func (app *AppConfig) GetQueueURL() string {
+	return fmt.Sprintf("%s:%d", app.QueueHost, app.QueuePort)
+}
+
 func InitConfig() (*viper.Viper, error) {
 	vConfig := viper.NewWithOptions(viper.KeyDelimiter("__"))
 
@@ -71,6 +107,8 @@ func setDefault(v *viper.Viper) {
 	v.SetDefault("HOST", "agent.chat.app")
 	v.SetDefault("PORT", "")
 	v.SetDefault("LOG_LEVEL", "debug")
+	v.SetDefault("TRUSTED_PROXIES", "")
+	v.SetDefault("OPERATOR_KEY", "")
 	//
 
 	v.SetDefault("DB__HOST", "")
@@ -81,6 +119,88 @@ func setDefault(v *viper.Viper) {
 	v.SetDefault("DB__MAX_OPEN_CONNECTION", 10)
 	v.SetDefault("DB__MAX_IDEAL_CONNECTION", 10)
 	v.SetDefault("DB__SSL_MODE", "disable")
+	v.SetDefault("DB__PATH", "agentchat.db")
+	v.SetDefault("DB__LIKE_SEARCH", false)
+
+	v.SetDefault("LYZR_BREAKER__WINDOW", "1m")
+	v.SetDefault("LYZR_BREAKER__MIN_REQUESTS", 5)
+	v.SetDefault("LYZR_BREAKER__FAILURE_RATE", 0.5)
+	v.SetDefault("LYZR_BREAKER__OPEN_FOR", "30s")
+	v.SetDefault("LYZR_BREAKER__HALF_OPEN_PROBES", 1)
+
+	v.SetDefault("LYZR_TIMEOUT__DEFAULT", "15s")
+	v.SetDefault("LYZR_TIMEOUT__CHAT", "60s")
+
+	v.SetDefault("PRICING__MODEL_PRICES", "")
+
+	v.SetDefault("AGENT_SYNC__INTERVAL", "5m")
+	v.SetDefault("AGENT_SYNC__KEEP_REPORTS", 100)
+
+	v.SetDefault("CACHE__DRIVER", "memory")
+	v.SetDefault("CACHE__HOST", "localhost")
+	v.SetDefault("CACHE__PORT", 6379)
+	v.SetDefault("CACHE__PASSWORD", "")
+	v.SetDefault("CACHE__MAX_CONNECTION", 10)
+	v.SetDefault("CACHE__PREFIX", "agentserver:")
+	v.SetDefault("CACHE__SIZE", 10000)
+	v.SetDefault("CACHE__AGENTS_TTL", "30s")
+	v.SetDefault("CACHE__CREDENTIALS_TTL", "5m")
+	v.SetDefault("CACHE__CATALOG_TTL", "1h")
+
+	v.SetDefault("OPENAI__NAME", "openai")
+	v.SetDefault("OPENAI__BASE_URL", "")
+	v.SetDefault("OPENAI__API_KEY", "")
+	v.SetDefault("OPENAI__TIMEOUT", "60s")
+	v.SetDefault("OPENAI__BREAKER__WINDOW", "1m")
+	v.SetDefault("OPENAI__BREAKER__MIN_REQUESTS", 5)
+	v.SetDefault("OPENAI__BREAKER__FAILURE_RATE", 0.5)
+	v.SetDefault("OPENAI__BREAKER__OPEN_FOR", "30s")
+	v.SetDefault("OPENAI__BREAKER__HALF_OPEN_PROBES", 1)
+
+	v.SetDefault("CONTEXT__TOKEN_BUDGET", 8000)
+	v.SetDefault("CONTEXT__MODEL_BUDGETS", "gpt-4o=64000,gpt-4o-mini=64000,gpt-4.1=64000")
+	v.SetDefault("CONTEXT__RECENT_TURNS", 6)
+	v.SetDefault("CONTEXT__SUMMARIZER_AGENT_ID", "")
+
+	v.SetDefault("PRESENCE_AWAY_AFTER", "5m")
+	v.SetDefault("PRESENCE_RETENTION", "24h")
+
+	v.SetDefault("QUEUE_DRIVER", "memory")
+	v.SetDefault("QUEUE_HOST", "localhost")
+	v.SetDefault("QUEUE_PORT", 6379)
+	v.SetDefault("QUEUE_PASSWORD", "")
+
+	v.SetDefault("JOBS__WORKERS", 4)
+	v.SetDefault("JOBS__POLL_INTERVAL", "1s")
+	v.SetDefault("JOBS__VISIBILITY_TIMEOUT", "2m")
+	v.SetDefault("JOBS__MAX_ATTEMPTS", 5)
+	v.SetDefault("JOBS__BACKOFF_BASE", "5s")
+	v.SetDefault("JOBS__BACKOFF_MAX", "10m")
+	v.SetDefault("JOBS__EXPORT_DIR", "exports")
+	v.SetDefault("JOBS__EXPORT_TTL", "24h")
+
+	v.SetDefault("WEBHOOKS__TIMEOUT", "10s")
+	v.SetDefault("WEBHOOKS__INBOUND_SECRET", "")
+	v.SetDefault("WEBHOOKS__INBOUND_TOLERANCE", "5m")
+	v.SetDefault("WEBHOOKS__ALLOW_PRIVATE", false)
+
+	v.SetDefault("EMAIL__ENABLED", false)
+	v.SetDefault("EMAIL__SOURCE", "smtp")
+	v.SetDefault("EMAIL__LISTEN_ADDR", "127.0.0.1:2525")
+	v.SetDefault("EMAIL__MAILDIR", "maildir")
+	v.SetDefault("EMAIL__POLL_INTERVAL", "10s")
+	v.SetDefault("EMAIL__MAX_BYTES", 10<<20)
+	v.SetDefault("EMAIL__AGENT_ID", "")
+	v.SetDefault("EMAIL__WORKSPACE_ID", "")
+	v.SetDefault("EMAIL__ADDRESS", "support@agent.chat.app")
+	v.SetDefault("EMAIL__RELAY_HOST", "localhost")
+	v.SetDefault("EMAIL__RELAY_PORT", 25)
+	v.SetDefault("EMAIL__RELAY_USER", "")
+	v.SetDefault("EMAIL__RELAY_PASSWORD", "")
+
+	v.SetDefault("WIDGETS__SESSION_TTL", "24h")
+	v.SetDefault("WIDGETS__MESSAGES_PER_MINUTE", 20)
+	v.SetDefault("WIDGETS__SESSIONS_PER_HOUR", 30)
 }
 
 // Getting application config from viper
@@ -0,0 +1,31 @@
+package configs
+
+import (
+	"strconv"
+	"strings"
+)
+
+type ContextConfig struct {
+	// TokenBudget applies to models without an entry in ModelBudgets.
+	TokenBudget int `mapstructure:"token_budget" validate:"required,gt=0"`
+	// ModelBudgets overrides the budget per model as "model=tokens,..."
+	ModelBudgets string `mapstructure:"model_budgets"`
+	RecentTurns  int    `mapstructure:"recent_turns" validate:"gte=0"`
+	// SummarizerAgentID folds turns older than RecentTurns into a running
+	// summary. Without it those turns are sent verbatim until they exceed
+	// the token budget, and then dropped oldest first.
+	SummarizerAgentID string `mapstructure:"summarizer_agent_id"`
+}
+
+func (cfg *ContextConfig) BudgetFor(model string) int {
+	for _, entry := range strings.Split(cfg.ModelBudgets, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || !strings.EqualFold(name, model) {
+			continue
+		}
+		if budget, err := strconv.Atoi(value); err == nil && budget > 0 {
+			return budget
+		}
+	}
+	return cfg.TokenBudget
+}
@@ -8,4 +8,9 @@ type DBConfig struct {
 	MaxIdealConnection int       `mapstructure:"max_ideal_connection" validate:"required"`
 	MaxOpenConnection  int       `mapstructure:"max_open_connection" validate:"required"`
 	SslMode            string    `mapstructure:"ssl_mode" validate:"required"`
+	// Path is the sqlite database file.
+	Path string `mapstructure:"path"`
+	// LikeSearch lets the server start on a sqlite build without FTS5
+	// (the sqlite_fts5 build tag), searching messages with LIKE instead.
+	LikeSearch bool `mapstructure:"like_search"`
 }
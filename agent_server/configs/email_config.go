@@ -0,0 +1,30 @@
+package configs
+
+import (
+	"fmt"
+	"time"
+)
+
+type EmailConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Source is where inbound mail comes from: smtp to listen on
+	// ListenAddr, maildir to poll the new/ folder of Maildir.
+	Source       string        `mapstructure:"source" validate:"oneof=smtp maildir"`
+	ListenAddr   string        `mapstructure:"listen_addr"`
+	Maildir      string        `mapstructure:"maildir"`
+	PollInterval time.Duration `mapstructure:"poll_interval" validate:"gt=0"`
+	MaxBytes     int64         `mapstructure:"max_bytes" validate:"gt=0"`
+	// AgentID answers conversations opened by email in WorkspaceID.
+	AgentID     string `mapstructure:"agent_id"`
+	WorkspaceID string `mapstructure:"workspace_id"`
+	// Address is the sender of replies.
+	Address       string `mapstructure:"address"`
+	RelayHost     string `mapstructure:"relay_host"`
+	RelayPort     int    `mapstructure:"relay_port"`
+	RelayUser     string `mapstructure:"relay_user"`
+	RelayPassword string `mapstructure:"relay_password"`
+}
+
+func (cfg *EmailConfig) GetRelayURL() string {
+	return fmt.Sprintf("%s:%d", cfg.RelayHost, cfg.RelayPort)
+}
@@ -0,0 +1,18 @@
+package configs
+
+import "time"
+
+type JobsConfig struct {
+	Workers      int           `mapstructure:"workers" validate:"gt=0"`
+	PollInterval time.Duration `mapstructure:"poll_interval" validate:"gt=0"`
+	// VisibilityTimeout bounds one attempt; a job whose worker has not
+	// finished by then is handed to another worker.
+	VisibilityTimeout time.Duration `mapstructure:"visibility_timeout" validate:"gt=0"`
+	MaxAttempts       int           `mapstructure:"max_attempts" validate:"gt=0"`
+	BackoffBase       time.Duration `mapstructure:"backoff_base" validate:"gt=0"`
+	BackoffMax        time.Duration `mapstructure:"backoff_max" validate:"gt=0"`
+	// ExportDir holds the archives written by export jobs.
+	ExportDir string `mapstructure:"export_dir" validate:"required"`
+	// ExportTTL is how long a finished archive stays downloadable.
+	ExportTTL time.Duration `mapstructure:"export_ttl" validate:"gt=0"`
+}
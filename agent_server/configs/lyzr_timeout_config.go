@@ -0,0 +1,10 @@
+package configs
+
+import "time"
+
+// LyzrTimeoutConfig bounds each attempt of a Lyzr API call.
+type LyzrTimeoutConfig struct {
+	Default time.Duration `mapstructure:"default" validate:"gt=0"`
+	// Chat is separate since inference runs far longer than CRUD calls.
+	Chat time.Duration `mapstructure:"chat" validate:"gt=0"`
+}
@@ -0,0 +1,17 @@
+package configs
+
+import "time"
+
+// OpenAIConfig points the OpenAI-compatible agent provider at a chat
+// completions API, such as a self-hosted model server.
+type OpenAIConfig struct {
+	// Name is what agents select the provider by.
+	Name string `mapstructure:"name" validate:"required"`
+	// BaseURL is the API root, e.g. https://api.openai.com/v1. The
+	// provider is off while it is empty.
+	BaseURL string `mapstructure:"base_url"`
+	APIKey  string `mapstructure:"api_key"`
+	// Timeout bounds a chat call, or a whole streamed reply.
+	Timeout time.Duration `mapstructure:"timeout" validate:"gt=0"`
+	Breaker BreakerConfig `mapstructure:"breaker"`
+}
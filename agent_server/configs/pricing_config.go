@@ -0,0 +1,8 @@
+package configs
+
+type PricingConfig struct {
+	// ModelPrices overrides or extends the built-in price list as
+	// "model=prompt:completion,..." in USD per thousand tokens. Models are
+	// matched by name prefix.
+	ModelPrices string `mapstructure:"model_prices"`
+}
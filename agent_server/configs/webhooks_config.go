@@ -0,0 +1,16 @@
+package configs
+
+import "time"
+
+type WebhooksConfig struct {
+	// Timeout bounds one outbound delivery attempt.
+	Timeout time.Duration `mapstructure:"timeout" validate:"gt=0"`
+	// InboundSecret signs requests to the inbound message endpoint, which
+	// is disabled while it is empty.
+	InboundSecret string `mapstructure:"inbound_secret"`
+	// InboundTolerance is how far an inbound timestamp may be from now.
+	InboundTolerance time.Duration `mapstructure:"inbound_tolerance" validate:"gt=0"`
+	// AllowPrivate lets subscriptions target loopback and private
+	// addresses, for local development only.
+	AllowPrivate bool `mapstructure:"allow_private"`
+}
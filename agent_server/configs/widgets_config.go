@@ -0,0 +1,12 @@
+package configs
+
+import "time"
+
+type WidgetsConfig struct {
+	// SessionTTL is how long an anonymous visitor session stays valid.
+	SessionTTL time.Duration `mapstructure:"session_ttl" validate:"gt=0"`
+	// MessagesPerMinute and SessionsPerHour apply to widgets that do not
+	// set their own limits.
+	MessagesPerMinute int `mapstructure:"messages_per_minute" validate:"gt=0"`
+	SessionsPerHour   int `mapstructure:"sessions_per_hour" validate:"gt=0"`
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+
+	lyzr "github.com/sdutt/agentserver/models/lyzr"
+	"github.com/sdutt/agentserver/pkg/lyzrfake"
+)
+
+// runFakeLyzr serves the fake Lyzr API for offline development. Point
+// LYZR_API_URL at it:
+//
+//	go run . fake-lyzr -addr 127.0.0.1:8099 -agents agents.json -replies replies.json
+func runFakeLyzr(args []string) error {
+	flags := flag.NewFlagSet("fake-lyzr", flag.ExitOnError)
+	addr := flags.String("addr", "127.0.0.1:8099", "address to listen on")
+	apiKey := flags.String("api-key", "", "x-api-key to require, any if empty")
+	agentsFile := flags.String("agents", "", "JSON file with an array of agents to start with")
+	repliesFile := flags.String("replies", "", "JSON file with an array of scripted replies")
+	flags.Parse(args)
+
+	opts := []lyzrfake.Option{lyzrfake.WithAPIKey(*apiKey)}
+	if *agentsFile != "" {
+		var agents []lyzr.Agent
+		if err := readJSONFile(*agentsFile, &agents); err != nil {
+			return err
+		}
+		opts = append(opts, lyzrfake.WithAgents(agents...))
+	}
+	if *repliesFile != "" {
+		var replies []lyzrfake.Reply
+		if err := readJSONFile(*repliesFile, &replies); err != nil {
+			return err
+		}
+		opts = append(opts, lyzrfake.WithReplies(replies...))
+	}
+	log.Printf("Fake Lyzr API listening on http://%s", *addr)
+	return http.ListenAndServe(*addr, lyzrfake.New(opts...))
+}
+
+func readJSONFile(path string, out interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	clients "github.com/sdutt/agentserver/clients/lyzr"
+	lyzr "github.com/sdutt/agentserver/models/lyzr"
+	"github.com/sdutt/agentserver/pkg/cassette"
+)
+
+// TestLyzrCassetteDecodes replays the recorded Lyzr answers through the
+// decoding the client uses. Re-record the cassette with the lyzr-cassette
+// command when the API changes.
+func TestLyzrCassetteDecodes(t *testing.T) {
+	rec, err := cassette.New("testdata/cassettes/lyzr.json", cassette.Replay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	opts := []clients.CallOption{
+		clients.WithCallHTTPClient(&http.Client{Transport: rec}),
+		clients.WithRetryPolicy(clients.NoRetry),
+	}
+	// the cassette matches on paths only
+	const api = "http://lyzr.replay"
+
+	listed, err := clients.CallAndUnmarshal[[]lyzr.Agent](ctx, http.MethodGet, api+"/v3/agents/", nil, nil, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	agents := *listed
+	if len(agents) != 1 {
+		t.Fatalf("got %d agents, want 1", len(agents))
+	}
+	agent, err := clients.CallAndUnmarshal[lyzr.Agent](ctx, http.MethodGet, api+"/v3/agents/"+agents[0].ID, nil, nil, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if agent.ApiKey != cassette.Scrubbed {
+		t.Errorf("got api key %q, want it scrubbed", agent.ApiKey)
+	}
+	payload := agent.Payload()
+	if err := payload.Validate(); err != nil {
+		t.Errorf("the agent does not round trip to a valid payload: %v", err)
+	}
+	if len(payload.Tools) != 2 || len(payload.Features) != 1 || payload.GetTemperature() != 0.2 {
+		t.Errorf("got payload %+v", payload)
+	}
+
+	listedCredentials, err := clients.CallAndUnmarshal[[]clients.CredentialResponse](ctx, http.MethodGet, api+"/v3/tools/credentials", nil, nil, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentials := *listedCredentials
+	if len(credentials) != 1 || credentials[0].ID == "" {
+		t.Fatalf("got credentials %+v, want one with an id", credentials)
+	}
+	credential, err := clients.CallAndUnmarshal[clients.CredentialResponse](ctx, http.MethodGet, api+"/v3/tools/credentials/"+credentials[0].ID, nil, nil, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credential.Credentials["OPENAI_API_KEY"] != cassette.Scrubbed {
+		t.Errorf("got credentials %v, want them scrubbed", credential.Credentials)
+	}
+
+	if unused := rec.Unused(); len(unused) > 0 {
+		t.Errorf("nothing asked for %d recordings, first %s %s", len(unused), unused[0].Method, unused[0].URL)
+	}
+}
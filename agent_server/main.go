@@ -5,9 +5,11 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sdutt/agentserver/configs"
+	"github.com/sdutt/agentserver/repository"
 )
 
 type AppRunner struct {
@@ -16,6 +18,17 @@ type AppRunner struct {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "fake-lyzr":
+			log.Fatal(runFakeLyzr(os.Args[2:]))
+		case "lyzr-cassette":
+			if err := runLyzrCassette(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
 	ctx := context.Background()
 	appRunner := AppRunner{}
 	// resolving configuration
@@ -28,7 +41,9 @@ func main() {
 		panic(err)
 	}
 	appRunner.server = s
-	appRunner.Init(ctx)
+	if err := appRunner.Init(ctx); err != nil {
+		panic(err)
+	}
 	defer appRunner.close(ctx)
 	go appRunner.RunHttpTLSServer()
 	go appRunner.RunHttpServer()
@@ -82,6 +97,58 @@ func (app *AppRunner) Init(ctx context.Context) error {
 	}
 	app.Closeable = append(app.Closeable, app.server.DB.Disconnect)
 
+	if err := repository.Migrate(ctx, app.server.DB, app.server.config.DbConfig.LikeSearch); err != nil {
+		fmt.Println("error while migrating sqlite tables.", err)
+		return err
+	}
+
+	if err := app.server.Broker.Connect(ctx); err != nil {
+		fmt.Println("error while connecting to broker.", app.server.Broker.Name(), err)
+		return err
+	}
+	app.Closeable = append(app.Closeable, app.server.Broker.Disconnect)
+
+	if err := app.server.Cache.Connect(ctx); err != nil {
+		fmt.Println("error while connecting to cache.", app.server.Cache.Name(), err)
+		return err
+	}
+	app.Closeable = append(app.Closeable, app.server.Cache.Disconnect)
+
+	presenceCtx, stopPresence := context.WithCancel(ctx)
+	go app.server.Presence.Run(presenceCtx)
+	app.Closeable = append(app.Closeable, func(context.Context) error {
+		stopPresence()
+		return nil
+	})
+
+	channelsCtx, stopChannels := context.WithCancel(ctx)
+	go app.server.Channels.Run(channelsCtx)
+	app.Closeable = append(app.Closeable, func(context.Context) error {
+		stopChannels()
+		return nil
+	})
+
+	mirrorCtx, stopMirror := context.WithCancel(ctx)
+	go app.server.Mirror.Run(mirrorCtx)
+	app.Closeable = append(app.Closeable, func(context.Context) error {
+		stopMirror()
+		return nil
+	})
+
+	exportsCtx, stopExports := context.WithCancel(ctx)
+	go app.server.Exports.Run(exportsCtx)
+	app.Closeable = append(app.Closeable, func(context.Context) error {
+		stopExports()
+		return nil
+	})
+
+	jobsCtx, stopJobs := context.WithCancel(ctx)
+	go app.server.Jobs.Run(jobsCtx)
+	app.Closeable = append(app.Closeable, func(context.Context) error {
+		stopJobs()
+		return nil
+	})
+
 	return nil
 }
 
@@ -91,7 +158,7 @@ func (app *AppRunner) close(ctx context.Context) {
 		for _, closeable := range app.Closeable {
 			err := closeable(ctx)
 			if err != nil {
-				fmt.Println("error while closing %v", err)
+				fmt.Printf("error while closing %v\n", err)
 			}
 		}
 	}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	lyzr "github.com/sdutt/agentserver/models/lyzr"
+	"gorm.io/gorm"
+)
+
+// LocalAgent is an agent defined on this server for a provider without an
+// agent store of its own, such as an OpenAI-compatible endpoint.
+type LocalAgent struct {
+	ID        string            `gorm:"primaryKey" json:"id"`
+	Provider  string            `gorm:"index" json:"provider"`
+	Payload   lyzr.AgentPayload `gorm:"serializer:json" json:"payload"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+	DeletedAt gorm.DeletedAt    `gorm:"index" json:"-"`
+}
+
+// MirroredAgent is the local copy of an agent of any provider, with the
+// metadata providers have no place for. Agents deleted at their provider
+// are soft deleted so their metadata is kept.
+//
+// Name, Description and Model are copied out of Data so listings can
+// filter on them. CreatedAt is when the provider created the agent, or
+// when it was first mirrored if the provider does not say.
+type MirroredAgent struct {
+	ID          string `gorm:"primaryKey" json:"id"`
+	Provider    string `gorm:"index" json:"provider"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Model       string `gorm:"index" json:"model"`
+	// Data is the agent as its provider returned it and Hash tells when
+	// that changes.
+	Data        json.RawMessage `json:"data"`
+	Hash        string          `json:"-"`
+	Owner       string          `json:"owner"`
+	WorkspaceID string          `gorm:"index" json:"workspace_id"`
+	Tags        []string        `gorm:"serializer:json" json:"tags"`
+	SyncedAt    time.Time       `json:"synced_at"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt  `gorm:"index" json:"-"`
+}
+
+// Sync triggers.
+const (
+	SyncScheduled = "scheduled"
+	SyncManual    = "manual"
+	// SyncOnDemand fills the mirror when it is read before any sync.
+	SyncOnDemand = "on_demand"
+)
+
+// AgentSync reports one reconciliation of the mirror. The agents it
+// created, updated or deleted were changed outside the app, except on the
+// baseline sync filling an empty mirror.
+type AgentSync struct {
+	ID         string    `gorm:"primaryKey" json:"id"`
+	Trigger    string    `json:"trigger"`
+	Baseline   bool      `json:"baseline"`
+	StartedAt  time.Time `gorm:"index" json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Total      int       `json:"total"`
+	Created    []string  `gorm:"serializer:json" json:"created"`
+	Updated    []string  `gorm:"serializer:json" json:"updated"`
+	Deleted    []string  `gorm:"serializer:json" json:"deleted"`
+	Error      string    `json:"error,omitempty"`
+}
+
+func (sync *AgentSync) Drifted() bool {
+	return !sync.Baseline && len(sync.Created)+len(sync.Updated)+len(sync.Deleted) > 0
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// AgentCall records one upstream agent invocation for analytics.
+type AgentCall struct {
+	ID             string `gorm:"primaryKey" json:"id"`
+	ConversationID string `gorm:"index" json:"conversation_id"`
+	MessageID      string `gorm:"index" json:"message_id"`
+	AgentID        string `gorm:"index:idx_agent_calls_agent_created" json:"agent_id"`
+	AgentModel     string `json:"agent_model"`
+	AgentRevision  string `json:"agent_revision"`
+	// StatusCode is the upstream HTTP status, 0 when no response arrived.
+	StatusCode       int     `json:"status_code"`
+	LatencyMs        int64   `json:"latency_ms"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	Cost             float64 `json:"cost"`
+	// UsageEstimated is set when the provider reported no token usage and
+	// the counts were estimated from the text.
+	UsageEstimated bool      `json:"usage_estimated"`
+	CreatedAt      time.Time `gorm:"index:idx_agent_calls_agent_created" json:"created_at"`
+}
+
+func (call *AgentCall) Failed() bool {
+	return call.StatusCode == 0 || call.StatusCode >= 300
+}
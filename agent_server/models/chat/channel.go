@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+const (
+	DirectionInbound  = "inbound"
+	DirectionOutbound = "outbound"
+)
+
+// ChannelThread maps a message on an external channel, e.g. an email by
+// its Message-ID, to the conversation it belongs to.
+type ChannelThread struct {
+	ID             string `gorm:"primaryKey" json:"id"`
+	Channel        string `gorm:"uniqueIndex:idx_channel_external" json:"channel"`
+	ExternalID     string `gorm:"uniqueIndex:idx_channel_external" json:"external_id"`
+	ConversationID string `gorm:"index" json:"conversation_id"`
+	// MessageID is the chat message an outbound thread entry delivered.
+	MessageID string `json:"message_id,omitempty"`
+	Direction string `json:"direction"`
+	// Address is the customer's address on the channel.
+	Address   string    `json:"address"`
+	Subject   string    `json:"subject,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
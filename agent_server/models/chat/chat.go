@@ -0,0 +1,105 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	RoleUser     = "user"
+	RoleAgent    = "agent"
+	RoleSystem   = "system"
+	RoleOperator = "operator"
+)
+
+type Conversation struct {
+	ID          string `gorm:"primaryKey" json:"id"`
+	AgentID     string `gorm:"index" json:"agent_id"`
+	UserID      string `gorm:"index" json:"user_id"`
+	WorkspaceID string `gorm:"index" json:"workspace_id"`
+	// Channel names the adapter the conversation arrived through, empty for
+	// the web chat.
+	Channel string `json:"channel,omitempty"`
+	// EscalatedAt is set once the conversation is handed to a human.
+	EscalatedAt      *time.Time `json:"escalated_at,omitempty"`
+	EscalationReason string     `json:"escalation_reason,omitempty"`
+	// ResolvedAt is set once the ticket the conversation raised is closed.
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	Resolution string     `json:"resolution,omitempty"`
+	// Summary condenses every message up to SummaryUpToSeq; later messages
+	// are sent to the agent verbatim.
+	Summary        string    `json:"summary,omitempty"`
+	SummaryUpToSeq int64     `json:"summary_up_to_seq,omitempty"`
+	CreatedAt      time.Time `gorm:"index" json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type Attachment struct {
+	Name        string `json:"name"`
+	URL         string `json:"url"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+}
+
+type Message struct {
+	ID             string `gorm:"primaryKey" json:"id"`
+	ConversationID string `gorm:"index;uniqueIndex:idx_conversation_seq" json:"conversation_id"`
+	Seq            int64  `gorm:"uniqueIndex:idx_conversation_seq" json:"seq"`
+	Role           string `json:"role"`
+	SenderID       string `json:"sender_id"`
+	Text           string `json:"text"`
+	// ParentID links an agent reply to the message it answers. Regenerated
+	// replies share the parent of the reply they replace.
+	ParentID string     `gorm:"index" json:"parent_id,omitempty"`
+	EditedAt *time.Time `json:"edited_at,omitempty"`
+	// agent metadata as it was when the reply was produced
+	AgentName        string         `json:"agent_name,omitempty"`
+	AgentModel       string         `json:"agent_model,omitempty"`
+	AgentTemperature float64        `json:"agent_temperature,omitempty"`
+	AgentRevision    string         `json:"agent_revision,omitempty"`
+	Attachments      []Attachment   `gorm:"serializer:json" json:"attachments"`
+	ModerationFlags  []string       `gorm:"serializer:json" json:"moderation_flags"`
+	CreatedAt        time.Time      `gorm:"index" json:"created_at"`
+	DeletedAt        gorm.DeletedAt `gorm:"index" json:"-"`
+	// SearchRowID keys the message in the full-text index. It is assigned by
+	// the index triggers and never written by the application.
+	SearchRowID *int64 `gorm:"column:search_rowid;->;uniqueIndex" json:"-"`
+}
+
+// MessageEdit keeps the text a message had before an edit.
+type MessageEdit struct {
+	ID           string    `gorm:"primaryKey" json:"id"`
+	MessageID    string    `gorm:"index" json:"message_id"`
+	EditorID     string    `json:"editor_id"`
+	PreviousText string    `json:"previous_text"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// ContextSnapshot is the exact prompt that was sent to the agent for a reply.
+type ContextSnapshot struct {
+	ID             string   `gorm:"primaryKey" json:"id"`
+	MessageID      string   `gorm:"uniqueIndex" json:"message_id"`
+	ConversationID string   `gorm:"index" json:"conversation_id"`
+	Model          string   `json:"model"`
+	TokenBudget    int      `json:"token_budget"`
+	Tokens         int      `json:"tokens"`
+	Summary        string   `json:"summary,omitempty"`
+	SummaryUpToSeq int64    `json:"summary_up_to_seq"`
+	MessageIDs     []string `gorm:"serializer:json" json:"message_ids"`
+	// Truncated is set when the budget forced dropping turns that are not
+	// covered by the summary.
+	Truncated bool      `json:"truncated"`
+	Prompt    string    `json:"prompt"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ReadState is how far one participant has read a conversation.
+type ReadState struct {
+	ConversationID    string    `gorm:"primaryKey" json:"conversation_id"`
+	ParticipantID     string    `gorm:"primaryKey" json:"participant_id"`
+	ParticipantRole   string    `json:"participant_role"`
+	LastReadMessageID string    `json:"last_read_message_id"`
+	LastReadSeq       int64     `json:"last_read_seq"`
+	ReadAt            time.Time `json:"read_at"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+const (
+	RatingUp   = "up"
+	RatingDown = "down"
+)
+
+// FeedbackReasons lists the reason codes accepted for each rating.
+var FeedbackReasons = map[string][]string{
+	RatingUp:   {"helpful", "accurate", "fast", "other"},
+	RatingDown: {"inaccurate", "unhelpful", "off_topic", "unsafe", "too_slow", "other"},
+}
+
+// Feedback is one user's rating of an agent reply. A user rating the same
+// message again replaces the earlier rating.
+type Feedback struct {
+	ID             string    `gorm:"primaryKey" json:"id"`
+	MessageID      string    `gorm:"uniqueIndex:idx_feedback_message_user" json:"message_id"`
+	UserID         string    `gorm:"uniqueIndex:idx_feedback_message_user" json:"user_id"`
+	ConversationID string    `gorm:"index" json:"conversation_id"`
+	AgentID        string    `gorm:"index" json:"agent_id"`
+	AgentRevision  string    `json:"agent_revision"`
+	Rating         string    `json:"rating"`
+	Reason         string    `json:"reason,omitempty"`
+	Comment        string    `json:"comment,omitempty"`
+	CreatedAt      time.Time `gorm:"index" json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+func ValidFeedbackReason(rating, reason string) bool {
+	if reason == "" {
+		return true
+	}
+	for _, r := range FeedbackReasons[rating] {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	// StatusDead marks a job that ran out of attempts or failed permanently.
+	StatusDead = "dead"
+)
+
+// Job is one unit of background work. A running job is hidden from other
+// workers until LockedUntil; if its worker dies it becomes visible again.
+type Job struct {
+	ID          string          `gorm:"primaryKey" json:"id"`
+	Kind        string          `gorm:"index" json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `gorm:"index:idx_jobs_status_run_at" json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	RunAt       time.Time       `gorm:"index:idx_jobs_status_run_at" json:"run_at"`
+	LockedBy    string          `gorm:"index" json:"locked_by,omitempty"`
+	LockedUntil *time.Time      `json:"locked_until,omitempty"`
+	LastError   string          `json:"last_error,omitempty"`
+	// Result is set by the handler on success, e.g. the file an export wrote.
+	Result     string     `json:"result,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// LastAttempt reports whether a failure of the running attempt dead-letters
+// the job.
+func (job *Job) LastAttempt() bool {
+	return job.Attempts >= job.MaxAttempts
+}
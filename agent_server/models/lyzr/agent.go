@@ -0,0 +1,122 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+type AgentResponse struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	AgentId string `json:"agent_id"`
+}
+
+type Agent struct {
+	ID                   string                 `json:"_id"`
+	Provider             string                 `json:"provider,omitempty"` // set by the provider registry
+	ApiKey               string                 `json:"api_key"`
+	Name                 string                 `json:"name"`
+	Description          string                 `json:"description"`
+	AgentRole            *string                `json:"agent_role"`             // nullable
+	AgentInstructions    *string                `json:"agent_instructions"`     // nullable
+	AgentGoal            *string                `json:"agent_goal"`             // nullable
+	AgentContext         interface{}            `json:"agent_context"`          // could be null/any
+	AgentOutput          interface{}            `json:"agent_output"`           // could be null/any
+	Examples             interface{}            `json:"examples"`               // could be null/any
+	Features             []interface{}          `json:"features"`               // empty slice on some, can contain values
+	Tool                 string                 `json:"tool,omitempty"`         // sometimes present, sometimes absent
+	Tools                []interface{}          `json:"tools,omitempty"`        // sometimes present, sometimes absent
+	ToolUsageDescription interface{}            `json:"tool_usage_description"` // can be string, object or null
+	ResponseFormat       map[string]interface{} `json:"response_format"`        // sometimes "type":"text", sometimes empty object
+	ProviderID           string                 `json:"provider_id"`
+	Model                string                 `json:"model"`
+	TopP                 float64                `json:"top_p"`
+	Temperature          float64                `json:"temperature"`
+	ManagedAgents        interface{}            `json:"managed_agents"` // could be []interface{}, null, or absent
+	Version              string                 `json:"version"`
+	CreatedAt            string                 `json:"created_at"`
+	UpdatedAt            string                 `json:"updated_at"`
+	LLM_CredentialID     string                 `json:"llm_credential_id"`
+	TemplateType         string                 `json:"template_type,omitempty"` // sometimes present
+}
+
+// Payload returns the agent as the payload that would recreate it, so partial
+// updates can be applied on top.
+func (agent *Agent) Payload() AgentPayload {
+	topP, temperature := agent.TopP, agent.Temperature
+	payload := AgentPayload{
+		Provider:        agent.Provider,
+		Name:            agent.Name,
+		Description:     agent.Description,
+		LLMCredentialID: agent.LLM_CredentialID,
+		ProviderID:      agent.ProviderID,
+		Model:           agent.Model,
+		Tools:           append([]interface{}(nil), agent.Tools...),
+		TopP:            &topP,
+		Temperature:     &temperature,
+		ResponseFormat:  agent.ResponseFormat,
+	}
+	if agent.AgentInstructions != nil {
+		payload.SystemPrompt = *agent.AgentInstructions
+	}
+	// features come back untyped; a round trip gives them their shape
+	if data, err := json.Marshal(agent.Features); err == nil {
+		json.Unmarshal(data, &payload.Features)
+	}
+	return payload
+}
+
+// Revision fingerprints the configuration that shapes the agent's replies,
+// so replies and feedback can be grouped by the configuration that produced
+// them. It changes whenever that configuration does, whether or not Lyzr
+// bumps Version.
+func (agent *Agent) Revision() string {
+	config := struct {
+		Version              string                 `json:"version"`
+		AgentRole            *string                `json:"agent_role"`
+		AgentInstructions    *string                `json:"agent_instructions"`
+		AgentGoal            *string                `json:"agent_goal"`
+		AgentContext         interface{}            `json:"agent_context"`
+		AgentOutput          interface{}            `json:"agent_output"`
+		Examples             interface{}            `json:"examples"`
+		Features             []interface{}          `json:"features"`
+		Tool                 string                 `json:"tool"`
+		Tools                []interface{}          `json:"tools"`
+		ToolUsageDescription interface{}            `json:"tool_usage_description"`
+		ResponseFormat       map[string]interface{} `json:"response_format"`
+		ProviderID           string                 `json:"provider_id"`
+		Model                string                 `json:"model"`
+		TopP                 float64                `json:"top_p"`
+		Temperature          float64                `json:"temperature"`
+		ManagedAgents        interface{}            `json:"managed_agents"`
+		LLMCredentialID      string                 `json:"llm_credential_id"`
+	}{
+		agent.Version, agent.AgentRole, agent.AgentInstructions, agent.AgentGoal,
+		agent.AgentContext, agent.AgentOutput, agent.Examples, agent.Features,
+		agent.Tool, agent.Tools, agent.ToolUsageDescription, agent.ResponseFormat,
+		agent.ProviderID, agent.Model, agent.TopP, agent.Temperature,
+		agent.ManagedAgents, agent.LLM_CredentialID,
+	}
+	// maps marshal with sorted keys, so equal configurations hash alike
+	data, err := json.Marshal(config)
+	if err != nil {
+		return agent.UpdatedAt
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+type ChatResponse struct {
+	Response string `json:"response"`
+	// Usage is the token usage reported by the provider, if any.
+	Usage *Usage `json:"usage,omitempty"`
+}
+
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
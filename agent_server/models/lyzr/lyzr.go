@@ -5,7 +5,7 @@ import "github.com/go-playground/validator"
 type CredentialPayload struct {
 	Name        string                 `json:"name"`
 	ProviderID  string                 `json:"provider_id"`
-	Credentials map[string]string      `json:"credentials"`
+	Credentials map[string]interface{} `json:"credentials"`
 	MetaData    map[string]interface{} `json:"meta_data"`
 }
 
@@ -15,21 +15,58 @@ type Feature struct {
 	Priority int                    `json:"priority" validate:"gte=0"`  // non-negative
 }
 
+// DefaultProvider runs agents that do not name a provider.
+const DefaultProvider = "lyzr"
+
+// AgentPayload creates or updates an agent. Tools are kept as the provider
+// returns them, names or tool objects; TopP and Temperature are pointers so
+// a 0 is told apart from a missing value.
 type AgentPayload struct {
+	// Provider selects the backend the agent runs on; it cannot change once
+	// the agent exists.
+	Provider        string                 `json:"provider,omitempty"`
 	Name            string                 `json:"name" validate:"required"`
 	SystemPrompt    string                 `json:"system_prompt" validate:"required"`
 	Description     string                 `json:"description"`
 	Features        []Feature              `json:"features"`
-	Tools           []string               `json:"tools"`
+	Tools           []interface{}          `json:"tools"`
 	LLMCredentialID string                 `json:"llm_credential_id" validate:"required"`
 	ProviderID      string                 `json:"provider_id" validate:"required"`
 	Model           string                 `json:"model" validate:"required"`
-	TopP            float64                `json:"top_p" validate:"required,gte=0,lte=1"`
-	Temperature     float64                `json:"temperature" validate:"required,gte=0,lte=2"`
+	TopP            *float64               `json:"top_p" validate:"required,gte=0,lte=1"`
+	Temperature     *float64               `json:"temperature" validate:"required,gte=0,lte=2"`
 	ResponseFormat  map[string]interface{} `json:"response_format" validate:"required"`
 }
 
+// GetTopP returns TopP, 0 when it is not set.
+func (req *AgentPayload) GetTopP() float64 {
+	if req.TopP == nil {
+		return 0
+	}
+	return *req.TopP
+}
+
+// GetTemperature returns Temperature, 0 when it is not set.
+func (req *AgentPayload) GetTemperature() float64 {
+	if req.Temperature == nil {
+		return 0
+	}
+	return *req.Temperature
+}
+
+// Validate checks the payload. Lyzr credentials and LLM providers only
+// apply to agents run on Lyzr.
 func (req *AgentPayload) Validate() error {
 	validate := validator.New()
+	if req.Provider != "" && req.Provider != DefaultProvider {
+		return validate.StructExcept(req, "LLMCredentialID", "ProviderID")
+	}
 	return validate.Struct(req)
 }
+
+type ChatPayload struct {
+	UserID    string `json:"user_id"`
+	AgentID   string `json:"agent_id"`
+	SessionID string `json:"session_id"`
+	Message   string `json:"message"`
+}
@@ -0,0 +1,97 @@
+package models
+
+import (
+	"encoding/json"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	EventConversationCreated   = "conversation.created"
+	EventConversationEscalated = "conversation.escalated"
+	EventTicketResolved        = "ticket.resolved"
+	EventAgentCreated          = "agent.created"
+	EventAgentUpdated          = "agent.updated"
+	EventAgentDeleted          = "agent.deleted"
+	// EventAgentsDrifted reports agents changed outside the app, to each
+	// workspace the agents it owns.
+	EventAgentsDrifted = "agents.drifted"
+)
+
+var Events = []string{
+	EventConversationCreated,
+	EventConversationEscalated,
+	EventTicketResolved,
+	EventAgentCreated,
+	EventAgentUpdated,
+	EventAgentDeleted,
+	EventAgentsDrifted,
+}
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryRetrying  = "retrying"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// Subscription asks for the events of a workspace to be posted to URL,
+// signed with Secret. An empty WorkspaceID subscribes to every workspace,
+// including events that belong to none, and an empty Events list means
+// every event.
+type Subscription struct {
+	ID          string         `gorm:"primaryKey" json:"id"`
+	WorkspaceID string         `gorm:"index" json:"workspace_id"`
+	URL         string         `json:"url"`
+	Events      []string       `gorm:"serializer:json" json:"events"`
+	Secret      string         `json:"secret,omitempty"`
+	Active      bool           `json:"active"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+func (sub *Subscription) Wants(event string) bool {
+	return len(sub.Events) == 0 || slices.Contains(sub.Events, event)
+}
+
+// Delivery is one event sent to one subscription, across all its attempts.
+type Delivery struct {
+	ID             string          `gorm:"primaryKey" json:"id"`
+	SubscriptionID string          `gorm:"index" json:"subscription_id"`
+	EventID        string          `gorm:"index" json:"event_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	// RedeliveryOf points at the delivery this one was manually repeated from.
+	RedeliveryOf string            `json:"redelivery_of,omitempty"`
+	JobID        string            `json:"job_id,omitempty"`
+	LastError    string            `json:"last_error,omitempty"`
+	DeliveredAt  *time.Time        `json:"delivered_at,omitempty"`
+	CreatedAt    time.Time         `gorm:"index" json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+	Log          []DeliveryAttempt `gorm:"-" json:"attempts_log,omitempty"`
+}
+
+// DeliveryAttempt records one POST of a delivery.
+type DeliveryAttempt struct {
+	ID         string `gorm:"primaryKey" json:"id"`
+	DeliveryID string `gorm:"index" json:"delivery_id"`
+	Attempt    int    `json:"attempt"`
+	// StatusCode is the HTTP status of the response, 0 when none arrived.
+	StatusCode   int       `json:"status_code"`
+	ResponseBody string    `json:"response_body,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	DurationMs   int64     `json:"duration_ms"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// InboundDelivery remembers the delivery id of an inbound message, so a
+// replayed request is not posted twice.
+type InboundDelivery struct {
+	ID        string    `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Widget lets one agent be embedded on the sites in AllowedDomains. Its
+// PublishableKey is meant to be public: it only opens visitor sessions with
+// that agent.
+type Widget struct {
+	ID             string   `gorm:"primaryKey" json:"id"`
+	AgentID        string   `gorm:"index" json:"agent_id"`
+	WorkspaceID    string   `gorm:"index" json:"workspace_id"`
+	Name           string   `json:"name"`
+	PublishableKey string   `gorm:"uniqueIndex" json:"publishable_key"`
+	AllowedDomains []string `gorm:"serializer:json" json:"allowed_domains"`
+	Greeting       string   `json:"greeting"`
+	// Theme is opaque to the server and handed to the widget as is.
+	Theme json.RawMessage `json:"theme,omitempty"`
+	// MessagesPerMinute limits each visitor session and SessionsPerHour
+	// each client address; zero uses the server defaults.
+	MessagesPerMinute int            `json:"messages_per_minute"`
+	SessionsPerHour   int            `json:"sessions_per_hour"`
+	Active            bool           `json:"active"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	DeletedAt         gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// AllowsOrigin reports whether a page served from origin may use the
+// widget. "example.com" allows that host only, "*.example.com" its
+// subdomains.
+func (w *Widget) AllowsOrigin(origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || u.Hostname() == "" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, domain := range w.AllowedDomains {
+		domain = strings.ToLower(domain)
+		if suffix, ok := strings.CutPrefix(domain, "*"); ok {
+			if strings.HasSuffix(host, suffix) && len(host) > len(suffix) {
+				return true
+			}
+		} else if host == domain {
+			return true
+		}
+	}
+	return false
+}
+
+// PublicWidget is what visitors may see of a widget.
+type PublicWidget struct {
+	ID       string          `json:"id"`
+	AgentID  string          `json:"agent_id"`
+	Name     string          `json:"name"`
+	Greeting string          `json:"greeting"`
+	Theme    json.RawMessage `json:"theme,omitempty"`
+}
+
+func (w *Widget) Public() PublicWidget {
+	return PublicWidget{w.ID, w.AgentID, w.Name, w.Greeting, w.Theme}
+}
+
+// VisitorSession is an anonymous visitor chatting through a widget. Only
+// the hash of its bearer token is stored.
+type VisitorSession struct {
+	ID             string    `gorm:"primaryKey" json:"id"`
+	WidgetID       string    `gorm:"index" json:"widget_id"`
+	VisitorID      string    `json:"visitor_id"`
+	ConversationID string    `json:"conversation_id"`
+	TokenHash      string    `gorm:"uniqueIndex" json:"-"`
+	Origin         string    `json:"origin"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	LastSeenAt     time.Time `json:"last_seen_at"`
+	CreatedAt      time.Time `json:"created_at"`
+}
@@ -0,0 +1,92 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sdutt/agentserver/configs"
+	"github.com/sdutt/agentserver/pkg/connectors"
+)
+
+const (
+	DriverMemory = "memory"
+	DriverRedis  = "redis"
+)
+
+// Handler receives the payload of a message published on a topic. Handlers
+// run on the broker's delivery goroutine and should not block.
+type Handler func(payload []byte)
+
+// Broker moves messages between server instances. Every handler subscribed
+// to a topic, on any instance sharing the broker, receives each message
+// published on it.
+type Broker interface {
+	connectors.Connector
+	Publish(ctx context.Context, topic string, payload []byte) error
+	// Subscribe registers handler for topic until the returned cancel
+	// function is called.
+	Subscribe(topic string, handler Handler) (func(), error)
+}
+
+// New returns the broker selected by QUEUE_DRIVER.
+func New(config *configs.AppConfig) (Broker, error) {
+	switch config.QueueDriver {
+	case "", DriverMemory:
+		return NewMemoryBroker(), nil
+	case DriverRedis:
+		return NewRedisBroker(config.GetQueueURL(), config.QueuePassword), nil
+	}
+	return nil, fmt.Errorf("unknown queue driver %q", config.QueueDriver)
+}
+
+// subscriptions is the handler registry shared by the implementations.
+type subscriptions struct {
+	next     int
+	handlers map[string]map[int]Handler
+}
+
+func newSubscriptions() subscriptions {
+	return subscriptions{handlers: make(map[string]map[int]Handler)}
+}
+
+// add registers handler and reports whether it is the first for topic.
+func (s *subscriptions) add(topic string, handler Handler) (int, bool) {
+	s.next++
+	topicHandlers, ok := s.handlers[topic]
+	if !ok {
+		topicHandlers = make(map[int]Handler)
+		s.handlers[topic] = topicHandlers
+	}
+	topicHandlers[s.next] = handler
+	return s.next, !ok
+}
+
+// remove drops a handler and reports whether topic has none left.
+func (s *subscriptions) remove(topic string, id int) bool {
+	topicHandlers, ok := s.handlers[topic]
+	if !ok {
+		return false
+	}
+	delete(topicHandlers, id)
+	if len(topicHandlers) > 0 {
+		return false
+	}
+	delete(s.handlers, topic)
+	return true
+}
+
+func (s *subscriptions) list(topic string) []Handler {
+	handlers := make([]Handler, 0, len(s.handlers[topic]))
+	for _, handler := range s.handlers[topic] {
+		handlers = append(handlers, handler)
+	}
+	return handlers
+}
+
+func (s *subscriptions) topics() []string {
+	topics := make([]string, 0, len(s.handlers))
+	for topic := range s.handlers {
+		topics = append(topics, topic)
+	}
+	return topics
+}
@@ -0,0 +1,53 @@
+package broker
+
+import (
+	"context"
+	"sync"
+)
+
+// memoryBroker delivers messages within the process. It is the default for
+// a single instance deployment.
+type memoryBroker struct {
+	mu   sync.Mutex
+	subs subscriptions
+}
+
+func NewMemoryBroker() Broker {
+	return &memoryBroker{subs: newSubscriptions()}
+}
+
+func (b *memoryBroker) Connect(ctx context.Context) error {
+	return nil
+}
+
+func (b *memoryBroker) Name() string {
+	return "memory broker"
+}
+
+func (b *memoryBroker) Disconnect(ctx context.Context) error {
+	return nil
+}
+
+func (b *memoryBroker) Publish(ctx context.Context, topic string, payload []byte) error {
+	b.mu.Lock()
+	handlers := b.subs.list(topic)
+	b.mu.Unlock()
+	for _, handler := range handlers {
+		handler(payload)
+	}
+	return nil
+}
+
+func (b *memoryBroker) Subscribe(topic string, handler Handler) (func(), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id, _ := b.subs.add(topic, handler)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			b.subs.remove(topic, id)
+		})
+	}, nil
+}
@@ -0,0 +1,226 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/sdutt/agentserver/pkg/resp"
+)
+
+const (
+	publishTimeout   = 5 * time.Second
+	reconnectInitial = time.Second
+	reconnectMax     = 30 * time.Second
+)
+
+var errClosed = errors.New("broker is disconnected")
+
+// redisBroker fans messages out through Redis pub/sub so every instance
+// connected to the same server receives them. Publishing uses one
+// connection and subscriptions another, which is re-established with
+// backoff when it drops.
+type redisBroker struct {
+	addr     string
+	password string
+
+	pubMu sync.Mutex
+	pub   *resp.Conn
+
+	mu     sync.Mutex
+	sub    *resp.Conn
+	subs   subscriptions
+	closed bool
+	done   chan struct{}
+}
+
+func NewRedisBroker(addr, password string) Broker {
+	return &redisBroker{addr: addr, password: password, subs: newSubscriptions(), done: make(chan struct{})}
+}
+
+func (b *redisBroker) Name() string {
+	return fmt.Sprintf("REDIS redis://%s", b.addr)
+}
+
+func (b *redisBroker) Connect(ctx context.Context) error {
+	sub, err := resp.Dial(b.addr, b.password)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.sub = sub
+	b.mu.Unlock()
+	go b.receive(sub)
+	return nil
+}
+
+func (b *redisBroker) Disconnect(ctx context.Context) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	close(b.done)
+	if b.sub != nil {
+		b.sub.Close()
+		b.sub = nil
+	}
+	b.mu.Unlock()
+
+	b.pubMu.Lock()
+	defer b.pubMu.Unlock()
+	if b.pub != nil {
+		b.pub.Close()
+		b.pub = nil
+	}
+	return nil
+}
+
+func (b *redisBroker) Publish(ctx context.Context, topic string, payload []byte) error {
+	b.pubMu.Lock()
+	defer b.pubMu.Unlock()
+	select {
+	case <-b.done:
+		return errClosed
+	default:
+	}
+	if b.pub == nil {
+		pub, err := resp.Dial(b.addr, b.password)
+		if err != nil {
+			return err
+		}
+		b.pub = pub
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(publishTimeout)
+	}
+	b.pub.SetDeadline(deadline)
+	err := b.pub.Write("PUBLISH", topic, string(payload))
+	if err == nil {
+		_, err = b.pub.Read()
+	}
+	if err != nil {
+		var replyErr resp.Error
+		if !errors.As(err, &replyErr) {
+			// the connection is in an unknown state, dial again next time
+			b.pub.Close()
+			b.pub = nil
+		}
+		return err
+	}
+	return nil
+}
+
+func (b *redisBroker) Subscribe(topic string, handler Handler) (func(), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, errClosed
+	}
+	id, first := b.subs.add(topic, handler)
+	if first && b.sub != nil {
+		if err := b.sub.Write("SUBSCRIBE", topic); err != nil {
+			// the receive loop notices the broken connection and
+			// subscribes again once reconnected
+			log.Printf("Subscribe to %s failed: %v", topic, err)
+		}
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if b.subs.remove(topic, id) && b.sub != nil {
+				if err := b.sub.Write("UNSUBSCRIBE", topic); err != nil {
+					log.Printf("Unsubscribe from %s failed: %v", topic, err)
+				}
+			}
+		})
+	}, nil
+}
+
+// receive dispatches pushed messages until the broker is disconnected,
+// reconnecting whenever the subscription connection fails.
+func (b *redisBroker) receive(sub *resp.Conn) {
+	backoff := reconnectInitial
+	for {
+		err := b.dispatch(sub)
+		sub.Close()
+		b.mu.Lock()
+		if b.sub == sub {
+			b.sub = nil
+		}
+		b.mu.Unlock()
+		select {
+		case <-b.done:
+			return
+		default:
+		}
+		log.Printf("Broker subscription connection lost: %v", err)
+
+		for {
+			select {
+			case <-b.done:
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, reconnectMax)
+			if sub, err = b.resubscribe(); err == nil {
+				break
+			}
+			log.Printf("Broker reconnect failed: %v", err)
+		}
+		backoff = reconnectInitial
+	}
+}
+
+func (b *redisBroker) dispatch(sub *resp.Conn) error {
+	for {
+		reply, err := sub.Read()
+		if err != nil {
+			return err
+		}
+		items, ok := reply.([]interface{})
+		if !ok || len(items) != 3 {
+			continue
+		}
+		kind, _ := items[0].([]byte)
+		if string(kind) != "message" {
+			continue
+		}
+		topic, _ := items[1].([]byte)
+		payload, _ := items[2].([]byte)
+		b.mu.Lock()
+		handlers := b.subs.list(string(topic))
+		b.mu.Unlock()
+		for _, handler := range handlers {
+			handler(payload)
+		}
+	}
+}
+
+func (b *redisBroker) resubscribe() (*resp.Conn, error) {
+	sub, err := resp.Dial(b.addr, b.password)
+	if err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		sub.Close()
+		return nil, errClosed
+	}
+	if topics := b.subs.topics(); len(topics) > 0 {
+		if err := sub.Write(append([]string{"SUBSCRIBE"}, topics...)...); err != nil {
+			sub.Close()
+			return nil, err
+		}
+	}
+	b.sub = sub
+	return sub, nil
+}
@@ -0,0 +1,56 @@
+// Package cache keeps values for a limited time, in memory or in a Redis
+// server shared by every instance. Entries carry tags so everything derived
+// from one resource can be dropped together when it changes.
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sdutt/agentserver/configs"
+	"github.com/sdutt/agentserver/pkg/connectors"
+)
+
+const (
+	DriverMemory = "memory"
+	DriverRedis  = "redis"
+)
+
+type Cache interface {
+	connectors.Connector
+	// Get returns the value stored under key and whether there was one.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores value under key for ttl, replacing any previous entry.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration, tags ...string) error
+	Delete(ctx context.Context, keys ...string) error
+	// Invalidate drops every entry stored with any of tags.
+	Invalidate(ctx context.Context, tags ...string) error
+	// Incr adds one to the counter under key and returns the new count.
+	// The counter expires ttl after its last increment.
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+}
+
+// New returns the cache selected by CACHE__DRIVER.
+func New(config *configs.CacheConfig) (Cache, error) {
+	switch config.Driver {
+	case "", DriverMemory:
+		return NewMemoryCache(config.Size), nil
+	case DriverRedis:
+		return NewRedisCache(config.URL(), config.Password, config.Prefix, config.MaxConnection), nil
+	}
+	return nil, fmt.Errorf("unknown cache driver %q", config.Driver)
+}
+
+type refreshKey struct{}
+
+// Refresh marks ctx so loads skip the cached value and store a fresh one.
+func Refresh(ctx context.Context) context.Context {
+	return context.WithValue(ctx, refreshKey{}, true)
+}
+
+// IsRefresh reports whether ctx was marked by Refresh.
+func IsRefresh(ctx context.Context) bool {
+	refresh, _ := ctx.Value(refreshKey{}).(bool)
+	return refresh
+}
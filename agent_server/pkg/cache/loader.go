@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Loader reads JSON values through a cache. Concurrent loads of the same
+// key share one call to the source, and cache failures fall back to it.
+type Loader struct {
+	cache Cache
+	group singleflight.Group
+	// generation changes on every invalidation, so a load that started
+	// before one does not store what it read
+	generation atomic.Uint64
+}
+
+func NewLoader(cache Cache) *Loader {
+	return &Loader{cache: cache}
+}
+
+// Invalidate drops the entries stored with any of tags.
+func (l *Loader) Invalidate(ctx context.Context, tags ...string) {
+	l.generation.Add(1)
+	if err := l.cache.Invalidate(ctx, tags...); err != nil {
+		log.Printf("Unable to invalidate cache tags %v: %v", tags, err)
+	}
+}
+
+// Load returns the value cached under key, or calls load and caches its
+// result for ttl. Errors are not cached. The shared call to load is not
+// cancelled when ctx is, as other callers may be waiting for it. Values
+// round-trip through JSON, so T must survive encoding.
+func Load[T any](ctx context.Context, l *Loader, key string, ttl time.Duration, tags []string, load func(ctx context.Context) (T, error)) (T, error) {
+	var value T
+	if !IsRefresh(ctx) {
+		data, ok, err := l.cache.Get(ctx, key)
+		if err != nil {
+			log.Printf("Unable to read cache key %s: %v", key, err)
+		} else if ok && json.Unmarshal(data, &value) == nil {
+			return value, nil
+		}
+	}
+
+	generation := l.generation.Load()
+	result := l.group.DoChan(key, func() (interface{}, error) {
+		loadCtx := context.WithoutCancel(ctx)
+		loaded, err := load(loadCtx)
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(loaded)
+		if err != nil {
+			return nil, err
+		}
+		if l.generation.Load() == generation {
+			if err := l.cache.Set(loadCtx, key, data, ttl, tags...); err != nil {
+				log.Printf("Unable to write cache key %s: %v", key, err)
+			}
+		}
+		return data, nil
+	})
+	select {
+	case <-ctx.Done():
+		return value, ctx.Err()
+	case res := <-result:
+		if res.Err != nil {
+			return value, res.Err
+		}
+		// every caller decodes its own copy of the shared result
+		err := json.Unmarshal(res.Val.([]byte), &value)
+		return value, err
+	}
+}
@@ -0,0 +1,159 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// memoryCache is an LRU cache local to the instance. Once it holds size
+// entries, storing another evicts the least recently used one.
+type memoryCache struct {
+	size int
+
+	mu    sync.Mutex
+	order *list.List
+	items map[string]*list.Element
+	tags  map[string]map[string]struct{}
+}
+
+type memoryEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+	tags    []string
+}
+
+func NewMemoryCache(size int) Cache {
+	return &memoryCache{
+		size:  size,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+		tags:  make(map[string]map[string]struct{}),
+	}
+}
+
+func (c *memoryCache) Name() string {
+	return "MEMORY"
+}
+
+func (c *memoryCache) Connect(ctx context.Context) error {
+	return nil
+}
+
+func (c *memoryCache) Disconnect(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	c.items = make(map[string]*list.Element)
+	c.tags = make(map[string]map[string]struct{})
+	return nil
+}
+
+func (c *memoryCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := elem.Value.(*memoryEntry)
+	if time.Now().After(entry.expires) {
+		c.remove(elem)
+		return nil, false, nil
+	}
+	c.order.MoveToFront(elem)
+	return entry.value, true, nil
+}
+
+func (c *memoryCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration, tags ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.items[key]; ok {
+		c.remove(elem)
+	}
+	entry := &memoryEntry{
+		key:     key,
+		value:   append([]byte(nil), value...),
+		expires: time.Now().Add(ttl),
+		tags:    tags,
+	}
+	c.items[key] = c.order.PushFront(entry)
+	for _, tag := range tags {
+		keys, ok := c.tags[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			c.tags[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+	return nil
+}
+
+func (c *memoryCache) Delete(ctx context.Context, keys ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range keys {
+		if elem, ok := c.items[key]; ok {
+			c.remove(elem)
+		}
+	}
+	return nil
+}
+
+func (c *memoryCache) Invalidate(ctx context.Context, tags ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, tag := range tags {
+		for key := range c.tags[tag] {
+			if elem, ok := c.items[key]; ok {
+				c.remove(elem)
+			}
+		}
+		delete(c.tags, tag)
+	}
+	return nil
+}
+
+func (c *memoryCache) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var count int64
+	if elem, ok := c.items[key]; ok {
+		entry := elem.Value.(*memoryEntry)
+		if time.Now().Before(entry.expires) {
+			count, _ = strconv.ParseInt(string(entry.value), 10, 64)
+		}
+		c.remove(elem)
+	}
+	count++
+	entry := &memoryEntry{
+		key:     key,
+		value:   []byte(strconv.FormatInt(count, 10)),
+		expires: time.Now().Add(ttl),
+	}
+	c.items[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+	return count, nil
+}
+
+// remove drops elem from the list, the index and its tags. Callers hold mu.
+func (c *memoryCache) remove(elem *list.Element) {
+	entry := c.order.Remove(elem).(*memoryEntry)
+	delete(c.items, entry.key)
+	for _, tag := range entry.tags {
+		if keys, ok := c.tags[tag]; ok {
+			delete(keys, entry.key)
+			if len(keys) == 0 {
+				delete(c.tags, tag)
+			}
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sdutt/agentserver/pkg/resp"
+)
+
+const commandTimeout = 2 * time.Second
+
+var errClosed = errors.New("cache is disconnected")
+
+// invalidateScript deletes the members of the tag sets in KEYS and the sets
+// themselves. Scripts run atomically, so no key can be added to a tag
+// between reading and deleting it. Members are deleted in chunks to stay
+// within the limits of unpack.
+const invalidateScript = `
+for _, tag in ipairs(KEYS) do
+	local members = redis.call('SMEMBERS', tag)
+	for i = 1, #members, 1000 do
+		redis.call('DEL', unpack(members, i, math.min(i + 999, #members)))
+	end
+	redis.call('DEL', tag)
+end
+return 0
+`
+
+// redisCache keeps entries in a Redis server so every instance sees the
+// same values. Each tag is a set of the keys stored with it; invalidating
+// the tag deletes its members and the set in one script. Keys that expired
+// on their own stay in their tag sets until the tag is invalidated, which
+// is harmless.
+type redisCache struct {
+	addr     string
+	password string
+	prefix   string
+
+	// slots bounds the open connections, idle holds those not in use
+	slots chan struct{}
+	idle  chan *resp.Conn
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func NewRedisCache(addr, password, prefix string, maxConnections int) Cache {
+	return &redisCache{
+		addr:     addr,
+		password: password,
+		prefix:   prefix,
+		slots:    make(chan struct{}, maxConnections),
+		idle:     make(chan *resp.Conn, maxConnections),
+	}
+}
+
+func (c *redisCache) Name() string {
+	return fmt.Sprintf("REDIS redis://%s", c.addr)
+}
+
+func (c *redisCache) Connect(ctx context.Context) error {
+	_, err := c.do(ctx, []string{"PING"})
+	return err
+}
+
+func (c *redisCache) Disconnect(ctx context.Context) error {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	for {
+		select {
+		case conn := <-c.idle:
+			conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+func (c *redisCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	replies, err := c.do(ctx, []string{"GET", c.prefix + key})
+	if err != nil {
+		return nil, false, err
+	}
+	value, ok := replies[0].([]byte)
+	return value, ok, nil
+}
+
+func (c *redisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration, tags ...string) error {
+	key = c.prefix + key
+	// in one transaction, so an invalidation cannot fall between storing
+	// the key and adding it to its tags
+	commands := [][]string{{"MULTI"}, {"SET", key, string(value), "PX", strconv.FormatInt(ttl.Milliseconds(), 10)}}
+	for _, tag := range tags {
+		commands = append(commands, []string{"SADD", c.tagKey(tag), key})
+	}
+	commands = append(commands, []string{"EXEC"})
+	_, err := c.do(ctx, commands...)
+	return err
+}
+
+func (c *redisCache) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	command := []string{"DEL"}
+	for _, key := range keys {
+		command = append(command, c.prefix+key)
+	}
+	_, err := c.do(ctx, command)
+	return err
+}
+
+func (c *redisCache) Invalidate(ctx context.Context, tags ...string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	command := []string{"EVAL", invalidateScript, strconv.Itoa(len(tags))}
+	for _, tag := range tags {
+		command = append(command, c.tagKey(tag))
+	}
+	_, err := c.do(ctx, command)
+	return err
+}
+
+func (c *redisCache) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	key = c.prefix + key
+	replies, err := c.do(ctx,
+		[]string{"INCR", key},
+		[]string{"PEXPIRE", key, strconv.FormatInt(ttl.Milliseconds(), 10)},
+	)
+	if err != nil {
+		return 0, err
+	}
+	count, ok := replies[0].(int64)
+	if !ok {
+		return 0, fmt.Errorf("unexpected INCR reply %v", replies[0])
+	}
+	return count, nil
+}
+
+func (c *redisCache) tagKey(tag string) string {
+	return c.prefix + "tag:" + tag
+}
+
+// do sends commands in one round trip on a pooled connection and returns
+// their replies. The first error reply is returned as the error.
+func (c *redisCache) do(ctx context.Context, commands ...[]string) ([]interface{}, error) {
+	conn, err := c.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok || time.Until(deadline) > commandTimeout {
+		deadline = time.Now().Add(commandTimeout)
+	}
+	conn.SetDeadline(deadline)
+
+	replies, err := pipeline(conn, commands)
+	var replyErr resp.Error
+	if err != nil && !errors.As(err, &replyErr) {
+		// the connection is in an unknown state, do not reuse it
+		conn.Close()
+		conn = nil
+	}
+	c.release(conn)
+	return replies, err
+}
+
+func pipeline(conn *resp.Conn, commands [][]string) ([]interface{}, error) {
+	for _, command := range commands {
+		if err := conn.Write(command...); err != nil {
+			return nil, err
+		}
+	}
+	replies := make([]interface{}, len(commands))
+	var firstErr error
+	for i := range commands {
+		reply, err := conn.Read()
+		var replyErr resp.Error
+		if err != nil && !errors.As(err, &replyErr) {
+			return nil, err
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		replies[i] = reply
+	}
+	return replies, firstErr
+}
+
+// acquire returns an idle connection, or dials one if fewer than the
+// maximum are open, waiting for one to be released otherwise.
+func (c *redisCache) acquire(ctx context.Context) (*resp.Conn, error) {
+	select {
+	case c.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		<-c.slots
+		return nil, errClosed
+	}
+	select {
+	case conn := <-c.idle:
+		return conn, nil
+	default:
+	}
+	conn, err := resp.Dial(c.addr, c.password)
+	if err != nil {
+		<-c.slots
+		return nil, err
+	}
+	return conn, nil
+}
+
+// release returns conn, if still usable, to the idle connections.
+func (c *redisCache) release(conn *resp.Conn) {
+	if conn != nil {
+		c.mu.Lock()
+		closed := c.closed
+		c.mu.Unlock()
+		if closed {
+			conn.Close()
+		} else {
+			conn.SetDeadline(time.Time{})
+			c.idle <- conn
+		}
+	}
+	<-c.slots
+}
@@ -0,0 +1,357 @@
+// Package cassette records HTTP traffic to a file and replays it, so
+// decoding can be checked against real API payloads without the API.
+// Secrets are scrubbed before anything is written.
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+type Mode int
+
+const (
+	// Record sends requests on and appends every exchange to the cassette.
+	Record Mode = iota
+	// Replay answers from the cassette and fails requests it has no
+	// recording of.
+	Replay
+)
+
+// Scrubbed replaces secrets in recordings.
+const Scrubbed = "[scrubbed]"
+
+// DefaultHeaders, DefaultFields and DefaultObjects are always scrubbed.
+// Fields match every JSON key containing one of them, in any case, so
+// OPENAI_API_KEY and client_secret are caught; their strings and every
+// value in objects or arrays under them are scrubbed, while numbers and
+// booleans, such as total_tokens, are kept. Every value under an object key
+// is scrubbed, whatever its name.
+var (
+	DefaultHeaders = []string{"x-api-key", "Authorization", "Cookie", "Set-Cookie"}
+	DefaultFields  = []string{"api_key", "apikey", "secret", "token", "password"}
+	DefaultObjects = []string{"credentials"}
+)
+
+type Request struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body,omitempty"`
+}
+
+type Response struct {
+	Status  int         `json:"status"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body,omitempty"`
+}
+
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Recorder is an http.RoundTripper recording to or replaying from the
+// cassette at path.
+type Recorder struct {
+	mu      sync.Mutex
+	path    string
+	mode    Mode
+	next    http.RoundTripper
+	headers []string
+	fields  []string
+	objects []string
+
+	cassette Cassette
+	used     []bool
+}
+
+type Option func(*Recorder)
+
+// WithTransport sends recorded requests through next instead of
+// http.DefaultTransport.
+func WithTransport(next http.RoundTripper) Option {
+	return func(r *Recorder) {
+		r.next = next
+	}
+}
+
+// WithScrubHeaders scrubs more headers.
+func WithScrubHeaders(headers ...string) Option {
+	return func(r *Recorder) {
+		r.headers = append(r.headers, headers...)
+	}
+}
+
+// WithScrubFields scrubs more JSON body fields, at any depth.
+func WithScrubFields(fields ...string) Option {
+	return func(r *Recorder) {
+		r.fields = append(r.fields, fields...)
+	}
+}
+
+// WithScrubObjects scrubs everything under more JSON body keys, at any
+// depth.
+func WithScrubObjects(keys ...string) Option {
+	return func(r *Recorder) {
+		r.objects = append(r.objects, keys...)
+	}
+}
+
+// New opens the cassette at path. Replaying needs the file; recording
+// starts a new one.
+func New(path string, mode Mode, opts ...Option) (*Recorder, error) {
+	r := &Recorder{
+		path:    path,
+		mode:    mode,
+		next:    http.DefaultTransport,
+		headers: append([]string(nil), DefaultHeaders...),
+		fields:  append([]string(nil), DefaultFields...),
+		objects: append([]string(nil), DefaultObjects...),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if mode == Replay {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("cassette %s: %w", path, err)
+		}
+		if err := json.Unmarshal(data, &r.cassette); err != nil {
+			return nil, fmt.Errorf("cassette %s: %w", path, err)
+		}
+		r.used = make([]bool, len(r.cassette.Interactions))
+	}
+	return r, nil
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	recorded := Request{
+		Method:  req.Method,
+		URL:     req.URL.RequestURI(),
+		Headers: r.scrubHeaders(req.Header),
+		Body:    r.scrubBody(body),
+	}
+	if r.mode == Replay {
+		return r.replay(req, recorded)
+	}
+	return r.record(req, recorded)
+}
+
+func (r *Recorder) record(req *http.Request, recorded Request) (*http.Response, error) {
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, Interaction{
+		Request: recorded,
+		Response: Response{
+			Status:  resp.StatusCode,
+			Headers: r.scrubHeaders(resp.Header),
+			Body:    r.scrubBody(body),
+		},
+	})
+	return resp, r.save()
+}
+
+// replay answers with the first unused recording of the same method, URL
+// and body. Anything else is an error naming the request, so a test
+// cannot pass against traffic nobody recorded.
+func (r *Recorder) replay(req *http.Request, recorded Request) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, interaction := range r.cassette.Interactions {
+		if r.used[i] || !matches(interaction.Request, recorded) {
+			continue
+		}
+		r.used[i] = true
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", interaction.Response.Status, http.StatusText(interaction.Response.Status)),
+			StatusCode:    interaction.Response.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        interaction.Response.Headers.Clone(),
+			Body:          io.NopCloser(strings.NewReader(interaction.Response.Body)),
+			ContentLength: int64(len(interaction.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+	err := fmt.Errorf("cassette %s has no unused recording of %s %s with body %q", r.path, recorded.Method, recorded.URL, recorded.Body)
+	log.Print(err)
+	return nil, err
+}
+
+// Unused lists the recordings a replay has not asked for.
+func (r *Recorder) Unused() []Request {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []Request
+	for i, used := range r.used {
+		if !used {
+			out = append(out, r.cassette.Interactions[i].Request)
+		}
+	}
+	return out
+}
+
+// save writes the whole cassette after every recording, so an aborted run
+// still leaves a usable file.
+func (r *Recorder) save() error {
+	data, err := json.MarshalIndent(r.cassette, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(r.path, append(data, '\n'), 0o644)
+}
+
+func matches(recorded, req Request) bool {
+	return recorded.Method == req.Method && recorded.URL == req.URL && sameBody(recorded.Body, req.Body)
+}
+
+// sameBody compares JSON bodies by value so key order does not matter.
+func sameBody(a, b string) bool {
+	if a == b {
+		return true
+	}
+	var va, vb interface{}
+	if json.Unmarshal([]byte(a), &va) != nil || json.Unmarshal([]byte(b), &vb) != nil {
+		return false
+	}
+	ja, _ := json.Marshal(va)
+	jb, _ := json.Marshal(vb)
+	return bytes.Equal(ja, jb)
+}
+
+func (r *Recorder) scrubHeaders(header http.Header) http.Header {
+	out := header.Clone()
+	for _, name := range r.headers {
+		if out.Get(name) != "" {
+			out.Set(name, Scrubbed)
+		}
+	}
+	return out
+}
+
+// scrubBody scrubs the secret fields of a JSON body. Other bodies are kept
+// as they are.
+func (r *Recorder) scrubBody(body []byte) string {
+	var value interface{}
+	if len(body) == 0 || json.Unmarshal(body, &value) != nil {
+		return string(body)
+	}
+	if !r.scrubValue(value) {
+		return string(body)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return string(body)
+	}
+	return string(data)
+}
+
+// scrubValue reports whether it changed anything.
+func (r *Recorder) scrubValue(value interface{}) bool {
+	changed := false
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			switch {
+			case r.secretObject(key):
+				v[key] = scrubAll(field)
+				changed = true
+			case r.secretField(key):
+				switch f := field.(type) {
+				case string:
+					if f != "" {
+						v[key] = Scrubbed
+						changed = true
+					}
+				case map[string]interface{}, []interface{}:
+					v[key] = scrubAll(f)
+					changed = true
+				}
+			default:
+				changed = r.scrubValue(field) || changed
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			changed = r.scrubValue(item) || changed
+		}
+	}
+	return changed
+}
+
+// scrubAll replaces every value in value but nulls, keeping the shape of
+// objects and arrays.
+func scrubAll(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case map[string]interface{}:
+		for key, field := range v {
+			v[key] = scrubAll(field)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = scrubAll(item)
+		}
+		return v
+	default:
+		return Scrubbed
+	}
+}
+
+func (r *Recorder) secretField(key string) bool {
+	key = strings.ToLower(key)
+	for _, field := range r.fields {
+		if strings.Contains(key, strings.ToLower(field)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Recorder) secretObject(key string) bool {
+	for _, object := range r.objects {
+		if strings.EqualFold(object, key) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package cassette_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sdutt/agentserver/pkg/cassette"
+)
+
+const credential = `{
+	"_id": "c1",
+	"llm_credential_id": "lyzr_openai",
+	"credentials": {"OPENAI_API_KEY": "sk-proj-1", "extra": {"host": "db.internal", "port": 5432}},
+	"meta_data": {"client_secret": "cs-2", "refresh_token": "rt-3", "owner": "billing"},
+	"signing_secret": {"value": "ss-7"},
+	"api_keys": ["ak-8"],
+	"usage": {"total_tokens": 12}
+}`
+
+func TestRecordScrubsSecrets(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "session=s-4")
+		io.WriteString(w, credential)
+	}))
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	rec, err := cassette.New(path, cassette.Record)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/v3/tools/credentials", strings.NewReader(`{"name":"prod","credentials":{"password":"pw-5"}}`))
+	req.Header.Set("x-api-key", "key-6")
+	resp, err := (&http.Client{Transport: rec}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != credential {
+		t.Errorf("the caller got %s, want the unscrubbed answer", body)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"sk-proj-1", "db.internal", "5432", "cs-2", "rt-3", "s-4", "pw-5", "key-6", "ss-7", "ak-8"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("the cassette keeps %s", secret)
+		}
+	}
+	var recorded cassette.Cassette
+	if err := json.Unmarshal(data, &recorded); err != nil {
+		t.Fatal(err)
+	}
+	var answer map[string]interface{}
+	if err := json.Unmarshal([]byte(recorded.Interactions[0].Response.Body), &answer); err != nil {
+		t.Fatal(err)
+	}
+	// ids and counts are no secrets
+	if answer["llm_credential_id"] != "lyzr_openai" || answer["usage"].(map[string]interface{})["total_tokens"] != 12.0 {
+		t.Errorf("got %v", answer)
+	}
+	if owner := answer["meta_data"].(map[string]interface{})["owner"]; owner != "billing" {
+		t.Errorf("got owner %v, want it kept", owner)
+	}
+}
+
+func TestReplayAnswersOnlyRecordedRequests(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	data, _ := json.Marshal(cassette.Cassette{Interactions: []cassette.Interaction{{
+		Request:  cassette.Request{Method: http.MethodPost, URL: "/v3/chat", Body: `{"a":1,"b":2}`},
+		Response: cassette.Response{Status: http.StatusOK, Body: `{"response":"hi"}`},
+	}}})
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rec, err := cassette.New(path, cassette.Replay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: rec}
+
+	// bodies match by value
+	resp, err := client.Post("http://replay/v3/chat", "application/json", strings.NewReader(`{"b":2,"a":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != `{"response":"hi"}` {
+		t.Errorf("got %s", body)
+	}
+	if len(rec.Unused()) != 0 {
+		t.Errorf("got unused recordings %v", rec.Unused())
+	}
+	// every recording answers once
+	if _, err := client.Post("http://replay/v3/chat", "application/json", strings.NewReader(`{"a":1,"b":2}`)); err == nil {
+		t.Error("a used recording answered again")
+	}
+}
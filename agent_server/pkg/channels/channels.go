@@ -0,0 +1,236 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	models "github.com/sdutt/agentserver/models/chat"
+	jobmodels "github.com/sdutt/agentserver/models/jobs"
+	"github.com/sdutt/agentserver/pkg/chat"
+	"github.com/sdutt/agentserver/pkg/jobs"
+	"github.com/sdutt/agentserver/repository"
+)
+
+// Inbound is a customer message received on a channel.
+type Inbound struct {
+	// ExternalID identifies the message on the channel, e.g. a Message-ID.
+	ExternalID string
+	// ThreadIDs are the external ids of earlier messages this one follows
+	// up on, most relevant first.
+	ThreadIDs   []string
+	From        string
+	Subject     string
+	Text        string
+	Attachments []models.Attachment
+}
+
+// Outbound is a message sent to the customer on a channel.
+type Outbound struct {
+	To      string
+	Subject string
+	Text    string
+	// ThreadIDs are the external ids of the conversation so far, oldest
+	// first; the last one is the message being answered.
+	ThreadIDs []string
+}
+
+// Adapter connects the chat engine to one external channel.
+type Adapter interface {
+	Name() string
+	// Run receives messages until ctx is done, passing each to receive. An
+	// error from receive tells the sender to try again later.
+	Run(ctx context.Context, receive func(ctx context.Context, in Inbound) error) error
+	// Send delivers a message and returns its external id.
+	Send(ctx context.Context, out Outbound) (string, error)
+}
+
+// Target is where an adapter's new conversations go.
+type Target struct {
+	AgentID     string
+	WorkspaceID string
+}
+
+// Manager threads inbound messages of every adapter into conversations and
+// sends the replies back through the same adapter.
+type Manager struct {
+	chat          *chat.Service
+	conversations repository.ConversationRepository
+	threads       repository.ChannelRepository
+	mu            sync.RWMutex
+	adapters      map[string]Adapter
+	targets       map[string]Target
+}
+
+func NewManager(chatService *chat.Service, conversations repository.ConversationRepository, threads repository.ChannelRepository) *Manager {
+	return &Manager{
+		chat:          chatService,
+		conversations: conversations,
+		threads:       threads,
+		adapters:      make(map[string]Adapter),
+		targets:       make(map[string]Target),
+	}
+}
+
+func (m *Manager) Register(adapter Adapter, target Target) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.adapters[adapter.Name()] = adapter
+	m.targets[adapter.Name()] = target
+}
+
+// Run runs every adapter until ctx is done.
+func (m *Manager) Run(ctx context.Context) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var wg sync.WaitGroup
+	for name, adapter := range m.adapters {
+		wg.Add(1)
+		go func(name string, adapter Adapter) {
+			defer wg.Done()
+			receive := func(ctx context.Context, in Inbound) error {
+				return m.receive(ctx, name, in)
+			}
+			if err := adapter.Run(ctx, receive); err != nil && ctx.Err() == nil {
+				log.Printf("Channel %s stopped: %v", name, err)
+			}
+		}(name, adapter)
+	}
+	wg.Wait()
+}
+
+// receive appends an inbound message to the conversation it replies to, or
+// opens a new one, and asks the agent to answer.
+func (m *Manager) receive(ctx context.Context, channel string, in Inbound) error {
+	if strings.TrimSpace(in.Text) == "" && len(in.Attachments) == 0 {
+		log.Printf("Ignoring empty %s message %s from %s", channel, in.ExternalID, in.From)
+		return nil
+	}
+	// claim the external id first so a redelivered message is not answered
+	// twice; it is released again if the message cannot be posted
+	thread := &models.ChannelThread{
+		Channel:    channel,
+		ExternalID: in.ExternalID,
+		Direction:  models.DirectionInbound,
+		Address:    in.From,
+		Subject:    in.Subject,
+	}
+	fresh, err := m.threads.SaveThread(ctx, thread)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		log.Printf("Ignoring duplicate %s message %s", channel, in.ExternalID)
+		return nil
+	}
+	message, err := m.post(ctx, channel, in, thread)
+	if err != nil {
+		if err := m.threads.DeleteThread(ctx, thread.ID); err != nil {
+			log.Printf("Unable to release %s message %s: %v", channel, in.ExternalID, err)
+		}
+		return err
+	}
+	// the message is in the transcript now, so a redelivery must not post
+	// it again even if the answer cannot be queued
+	if _, err := m.chat.RequestReply(ctx, message); err != nil {
+		log.Printf("Unable to request a reply to %s message %s: %v", channel, in.ExternalID, err)
+	}
+	return nil
+}
+
+// post appends in to the conversation it threads into and files thread
+// under that conversation.
+func (m *Manager) post(ctx context.Context, channel string, in Inbound, thread *models.ChannelThread) (*models.Message, error) {
+	conversation, err := m.open(ctx, channel, in)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.threads.AttachThread(ctx, thread.ID, conversation.ID); err != nil {
+		return nil, err
+	}
+	participant := chat.Participant{ID: conversation.UserID, Role: models.RoleUser}
+	return m.chat.Post(ctx, conversation, participant, chat.Message{Text: in.Text, Attachments: in.Attachments}, nil)
+}
+
+// open returns the conversation in replies to, or a new one. Thread
+// headers are chosen by the sender, so a reply only joins a conversation
+// started by the same address.
+func (m *Manager) open(ctx context.Context, channel string, in Inbound) (*models.Conversation, error) {
+	conversationID, err := m.threads.FindConversation(ctx, channel, in.ThreadIDs)
+	switch {
+	case err == nil:
+		conversation, err := m.conversations.GetConversation(ctx, conversationID)
+		if err != nil {
+			return nil, err
+		}
+		if strings.EqualFold(conversation.UserID, in.From) {
+			return conversation, nil
+		}
+		log.Printf("%s message %s from %s refers to a conversation of another sender, starting a new one", channel, in.ExternalID, in.From)
+	case !errors.Is(err, repository.ErrNotFound):
+		return nil, err
+	}
+	target := m.targets[channel]
+	return m.chat.Open(ctx, chat.Handshake{
+		AgentID:     target.AgentID,
+		UserID:      in.From,
+		WorkspaceID: target.WorkspaceID,
+		Channel:     channel,
+	})
+}
+
+// HandleSend delivers a queued agent or operator message on the channel of
+// its conversation, threaded after the messages exchanged so far.
+func (m *Manager) HandleSend(ctx context.Context, job *jobmodels.Job) (string, error) {
+	var payload chat.ChannelSend
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return "", jobs.Permanent(err)
+	}
+	conversation, err := m.conversations.GetConversation(ctx, payload.ConversationID)
+	if err != nil {
+		return "", jobs.Permanent(err)
+	}
+	message, err := m.conversations.GetMessage(ctx, payload.ConversationID, payload.MessageID)
+	if err != nil {
+		return "", jobs.Permanent(err)
+	}
+	m.mu.RLock()
+	adapter, ok := m.adapters[conversation.Channel]
+	m.mu.RUnlock()
+	if !ok {
+		return "", jobs.Permanent(fmt.Errorf("no adapter for channel %q", conversation.Channel))
+	}
+	threads, err := m.threads.ListThreads(ctx, conversation.ID)
+	if err != nil {
+		return "", err
+	}
+	out := Outbound{To: conversation.UserID, Text: message.Text}
+	for _, thread := range threads {
+		out.ThreadIDs = append(out.ThreadIDs, thread.ExternalID)
+		if thread.Direction == models.DirectionInbound {
+			out.To = thread.Address
+			out.Subject = thread.Subject
+		}
+	}
+	externalID, err := adapter.Send(ctx, out)
+	if err != nil {
+		return "", err
+	}
+	_, err = m.threads.SaveThread(ctx, &models.ChannelThread{
+		Channel:        conversation.Channel,
+		ExternalID:     externalID,
+		ConversationID: conversation.ID,
+		MessageID:      message.ID,
+		Direction:      models.DirectionOutbound,
+		Address:        out.To,
+		Subject:        out.Subject,
+	})
+	if err != nil {
+		log.Printf("Unable to record %s message %s: %v", conversation.Channel, externalID, err)
+	}
+	return externalID, nil
+}
@@ -0,0 +1,154 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/sdutt/agentserver/configs"
+	"github.com/sdutt/agentserver/pkg/channels"
+	"github.com/sdutt/agentserver/pkg/ids"
+)
+
+// Name is the channel name of email conversations.
+const Name = "email"
+
+// errRejected marks mail that will never be accepted, so it is not retried.
+var errRejected = errors.New("rejected")
+
+// Adapter receives mail over SMTP or from a maildir and answers through an
+// SMTP relay, threading replies with In-Reply-To and References.
+type Adapter struct {
+	config *configs.EmailConfig
+	domain string
+}
+
+func NewAdapter(config *configs.EmailConfig) *Adapter {
+	domain := "localhost"
+	if at := strings.LastIndexByte(config.Address, '@'); at >= 0 {
+		domain = config.Address[at+1:]
+	}
+	return &Adapter{config, domain}
+}
+
+func (a *Adapter) Name() string {
+	return Name
+}
+
+func (a *Adapter) Run(ctx context.Context, receive func(ctx context.Context, in channels.Inbound) error) error {
+	deliver := func(data []byte) error {
+		in, err := parse(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("%w: %v", errRejected, err)
+		}
+		// mail we sent ourselves, e.g. bounced back by the relay
+		if strings.EqualFold(in.From, a.config.Address) {
+			return nil
+		}
+		return receive(ctx, in)
+	}
+	if a.config.Source == "maildir" {
+		return a.poll(ctx, deliver)
+	}
+	return a.listen(ctx, deliver)
+}
+
+func (a *Adapter) Send(ctx context.Context, out channels.Outbound) (string, error) {
+	messageID := ids.New() + "@" + a.domain
+	subject := out.Subject
+	if subject == "" {
+		subject = "Your conversation"
+	}
+	if !strings.HasPrefix(strings.ToLower(subject), "re:") {
+		subject = "Re: " + subject
+	}
+
+	var msg bytes.Buffer
+	header := func(key, value string) {
+		fmt.Fprintf(&msg, "%s: %s\r\n", key, value)
+	}
+	header("From", (&mail.Address{Address: a.config.Address}).String())
+	header("To", (&mail.Address{Address: out.To}).String())
+	header("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", "<"+messageID+">")
+	if len(out.ThreadIDs) > 0 {
+		refs := make([]string, len(out.ThreadIDs))
+		for i, id := range out.ThreadIDs {
+			refs[i] = "<" + id + ">"
+		}
+		header("In-Reply-To", refs[len(refs)-1])
+		header("References", strings.Join(refs, " "))
+	}
+	header("MIME-Version", "1.0")
+	header("Content-Type", `text/plain; charset="utf-8"`)
+	header("Content-Transfer-Encoding", "quoted-printable")
+	msg.WriteString("\r\n")
+	body := quotedprintable.NewWriter(&msg)
+	body.Write([]byte(strings.ReplaceAll(strings.ReplaceAll(out.Text, "\r\n", "\n"), "\n", "\r\n")))
+	body.Close()
+
+	if err := a.relay(ctx, out.To, msg.Bytes()); err != nil {
+		return "", fmt.Errorf("sending email to %s: %w", out.To, err)
+	}
+	return messageID, nil
+}
+
+// relay hands msg to the configured SMTP relay, upgrading to TLS when the
+// relay offers it.
+func (a *Adapter) relay(ctx context.Context, to string, msg []byte) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", a.config.GetRelayURL())
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	client, err := smtp.NewClient(conn, a.config.RelayHost)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if err := client.Hello(a.domain); err != nil {
+		return err
+	}
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: a.config.RelayHost}); err != nil {
+			return err
+		}
+	}
+	if a.config.RelayUser != "" {
+		auth := smtp.PlainAuth("", a.config.RelayUser, a.config.RelayPassword, a.config.RelayHost)
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(a.config.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,238 @@
+package email_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	clients "github.com/sdutt/agentserver/clients/lyzr"
+	"github.com/sdutt/agentserver/configs"
+	chatmodels "github.com/sdutt/agentserver/models/chat"
+	jobmodels "github.com/sdutt/agentserver/models/jobs"
+	"github.com/sdutt/agentserver/pkg/broker"
+	"github.com/sdutt/agentserver/pkg/cache"
+	"github.com/sdutt/agentserver/pkg/channels"
+	"github.com/sdutt/agentserver/pkg/channels/email"
+	"github.com/sdutt/agentserver/pkg/chat"
+	"github.com/sdutt/agentserver/pkg/connectors"
+	"github.com/sdutt/agentserver/pkg/dbtest"
+	"github.com/sdutt/agentserver/pkg/jobs"
+	"github.com/sdutt/agentserver/pkg/presence"
+	"github.com/sdutt/agentserver/pkg/providers"
+	"github.com/sdutt/agentserver/pkg/tokens"
+	"github.com/sdutt/agentserver/pkg/webhooks"
+	"github.com/sdutt/agentserver/repository"
+)
+
+const support = "support@example.test"
+
+func newService(t *testing.T, db connectors.SqliteConnector) *chat.Service {
+	t.Helper()
+	config := &configs.AppConfig{
+		Jobs:     configs.JobsConfig{MaxAttempts: 3},
+		Webhooks: configs.WebhooksConfig{Timeout: time.Second},
+		Context:  configs.ContextConfig{TokenBudget: 1000},
+	}
+	b := broker.NewMemoryBroker()
+	queue := jobs.NewQueue(&config.Jobs, repository.NewJobRepository(db))
+	registry := providers.NewRegistry(providers.Lyzr(clients.NewLyzrClient(config)), repository.NewLocalAgentRepository(db), cache.NewLoader(cache.NewMemoryCache(16)), &config.Cache)
+	conversations := repository.NewConversationRepository(db)
+	prices, err := tokens.ParsePrices("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chat.NewService(
+		registry,
+		conversations,
+		repository.NewFeedbackRepository(db),
+		repository.NewAgentCallRepository(db),
+		prices,
+		chat.NewContextBuilder(&config.Context, registry, conversations, queue),
+		chat.NewHub(b),
+		presence.NewTracker(time.Minute, time.Hour, b),
+		queue,
+		webhooks.NewDispatcher(&config.Webhooks, repository.NewWebhookRepository(db), queue),
+		"",
+	)
+}
+
+// freeAddr returns a loopback address nothing listens on.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// run serves the email channel of a new manager on an SMTP address until
+// the test ends.
+func run(t *testing.T, db connectors.SqliteConnector, target channels.Target) string {
+	t.Helper()
+	addr := freeAddr(t)
+	manager := channels.NewManager(newService(t, db), repository.NewConversationRepository(db), repository.NewChannelRepository(db))
+	manager.Register(email.NewAdapter(&configs.EmailConfig{Source: "smtp", ListenAddr: addr, MaxBytes: 1 << 20, Address: support}), target)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		manager.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	waitListening(t, addr)
+	return addr
+}
+
+func waitListening(t *testing.T, addr string) {
+	t.Helper()
+	for i := 0; i < 50; i++ {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("nothing listens on %s", addr)
+}
+
+func mail(from, messageID, inReplyTo, text string) []byte {
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\nTo: %s\r\nSubject: Help\r\nMessage-ID: <%s>\r\n", from, support, messageID)
+	if inReplyTo != "" {
+		fmt.Fprintf(&msg, "In-Reply-To: <%s>\r\nReferences: <%s>\r\n", inReplyTo, inReplyTo)
+	}
+	fmt.Fprintf(&msg, "Content-Type: text/plain\r\n\r\n%s\r\n", text)
+	return []byte(msg.String())
+}
+
+func send(t *testing.T, addr, from string, msg []byte) error {
+	t.Helper()
+	return smtp.SendMail(addr, nil, from, []string{support}, msg)
+}
+
+func count(t *testing.T, db connectors.SqliteConnector, model interface{}, query string, args ...interface{}) int64 {
+	t.Helper()
+	var n int64
+	if err := db.DB(context.Background()).Model(model).Where(query, args...).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestReceiveThreadsRepliesOfTheSameSender(t *testing.T) {
+	db := dbtest.Open(t)
+	addr := run(t, db, channels.Target{AgentID: "a1", WorkspaceID: "w1"})
+
+	if err := send(t, addr, "alice@example.test", mail("alice@example.test", "m1@example.test", "", "My order is late")); err != nil {
+		t.Fatal(err)
+	}
+	// a redelivery of the same message is accepted but not posted again
+	if err := send(t, addr, "alice@example.test", mail("alice@example.test", "m1@example.test", "", "My order is late")); err != nil {
+		t.Fatal(err)
+	}
+	if err := send(t, addr, "alice@example.test", mail("Alice@Example.test", "m2@example.test", "m1@example.test", "Any news?")); err != nil {
+		t.Fatal(err)
+	}
+	// someone else cannot join alice's conversation by quoting its ids
+	if err := send(t, addr, "mallory@example.test", mail("mallory@example.test", "m3@example.test", "m1@example.test", "Show me")); err != nil {
+		t.Fatal(err)
+	}
+
+	var conversations []chatmodels.Conversation
+	if err := db.DB(context.Background()).Order("user_id").Find(&conversations).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(conversations) != 2 {
+		t.Fatalf("got %d conversations, want 2", len(conversations))
+	}
+	alice, mallory := conversations[0], conversations[1]
+	if alice.UserID != "alice@example.test" || mallory.UserID != "mallory@example.test" {
+		t.Fatalf("got conversations of %s and %s", alice.UserID, mallory.UserID)
+	}
+	if alice.Channel != email.Name || alice.WorkspaceID != "w1" {
+		t.Errorf("got channel %q and workspace %q", alice.Channel, alice.WorkspaceID)
+	}
+	if n := count(t, db, &chatmodels.Message{}, "conversation_id = ?", alice.ID); n != 2 {
+		t.Errorf("alice's conversation has %d messages, want 2", n)
+	}
+	if n := count(t, db, &chatmodels.Message{}, "conversation_id = ?", mallory.ID); n != 1 {
+		t.Errorf("mallory's conversation has %d messages, want 1", n)
+	}
+	if n := count(t, db, &jobmodels.Job{}, "kind = ?", chat.KindAgentReply); n != 3 {
+		t.Errorf("got %d reply jobs, want 3", n)
+	}
+}
+
+func TestReceiveReleasesMessagesThatCannotBePosted(t *testing.T) {
+	db := dbtest.Open(t)
+	// without an agent no conversation can be opened
+	addr := run(t, db, channels.Target{})
+
+	err := send(t, addr, "alice@example.test", mail("alice@example.test", "m1@example.test", "", "Hello"))
+	if err == nil || !strings.Contains(err.Error(), "451") {
+		t.Fatalf("got %v, want a temporary failure", err)
+	}
+	if n := count(t, db, &chatmodels.ChannelThread{}, "external_id = ?", "m1@example.test"); n != 0 {
+		t.Errorf("the failed message is still recorded %d times", n)
+	}
+	if n := count(t, db, &chatmodels.Conversation{}, "1 = 1"); n != 0 {
+		t.Errorf("got %d conversations, want none", n)
+	}
+}
+
+func TestSendThreadsTheReply(t *testing.T) {
+	// a second adapter stands in for the relay and parses what it is given
+	relayAddr := freeAddr(t)
+	relay := email.NewAdapter(&configs.EmailConfig{Source: "smtp", ListenAddr: relayAddr, MaxBytes: 1 << 20, Address: "relay@example.test"})
+	var mu sync.Mutex
+	var received []channels.Inbound
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go relay.Run(ctx, func(ctx context.Context, in channels.Inbound) error {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, in)
+		return nil
+	})
+	waitListening(t, relayAddr)
+
+	host, port, _ := net.SplitHostPort(relayAddr)
+	var relayPort int
+	fmt.Sscan(port, &relayPort)
+	adapter := email.NewAdapter(&configs.EmailConfig{Address: support, RelayHost: host, RelayPort: relayPort})
+	id, err := adapter.Send(context.Background(), channels.Outbound{
+		To:        "alice@example.test",
+		Subject:   "Help",
+		Text:      "It ships today.",
+		ThreadIDs: []string{"m1@example.test", "m2@example.test"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 1 {
+		t.Fatalf("the relay got %d messages, want 1", len(received))
+	}
+	got := received[0]
+	if got.ExternalID != id {
+		t.Errorf("got Message-ID %q, want %q", got.ExternalID, id)
+	}
+	if got.From != support || got.Subject != "Re: Help" || strings.TrimSpace(got.Text) != "It ships today." {
+		t.Errorf("got %q from %q: %q", got.Subject, got.From, got.Text)
+	}
+	if len(got.ThreadIDs) == 0 || got.ThreadIDs[0] != "m2@example.test" {
+		t.Errorf("got thread ids %v, want m2@example.test first", got.ThreadIDs)
+	}
+}
@@ -0,0 +1,68 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// poll delivers the messages in the new/ folder of the maildir every poll
+// interval. Delivered and rejected messages move to cur/; failed ones stay
+// for the next round.
+func (a *Adapter) poll(ctx context.Context, receive func([]byte) error) error {
+	for _, dir := range []string{"new", "cur", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(a.config.Maildir, dir), 0o755); err != nil {
+			return err
+		}
+	}
+	log.Printf("Polling email from %s", a.config.Maildir)
+	ticker := time.NewTicker(a.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		if err := a.scan(ctx, receive); err != nil {
+			log.Printf("Unable to scan maildir: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *Adapter) scan(ctx context.Context, receive func([]byte) error) error {
+	entries, err := os.ReadDir(filepath.Join(a.config.Maildir, "new"))
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(a.config.Maildir, "new", entry.Name())
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if info.Size() > a.config.MaxBytes {
+			log.Printf("Rejecting email %s: %d bytes exceeds the limit", entry.Name(), info.Size())
+		} else if data, err := os.ReadFile(path); err != nil {
+			log.Printf("Unable to read email %s: %v", entry.Name(), err)
+			continue
+		} else if err := receive(data); err != nil && !errors.Is(err, errRejected) {
+			log.Printf("Unable to accept email %s: %v", entry.Name(), err)
+			continue
+		}
+		// ":2," marks the message as seen by a maildir reader
+		if err := os.Rename(path, filepath.Join(a.config.Maildir, "cur", entry.Name()+":2,S")); err != nil {
+			log.Printf("Unable to move email %s: %v", entry.Name(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package email
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"strings"
+
+	"github.com/sdutt/agentserver/pkg/channels"
+)
+
+var (
+	errNoMessageID = errors.New("message has no Message-ID")
+	errNoSender    = errors.New("message has no From address")
+	// replyHeader matches the line mail clients put above a quoted reply.
+	replyHeader = regexp.MustCompile(`(?i)^on .+ wrote:$`)
+	wordDecoder = &mime.WordDecoder{}
+)
+
+// parse reads an RFC 5322 message into an inbound channel message, keeping
+// only the new text of a reply.
+func parse(r io.Reader) (channels.Inbound, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return channels.Inbound{}, err
+	}
+	in := channels.Inbound{ExternalID: msgID(msg.Header.Get("Message-ID"))}
+	if in.ExternalID == "" {
+		return in, errNoMessageID
+	}
+	from, err := mail.ParseAddress(msg.Header.Get("From"))
+	if err != nil {
+		return in, errNoSender
+	}
+	in.From = strings.ToLower(from.Address)
+	in.Subject = msg.Header.Get("Subject")
+	if subject, err := wordDecoder.DecodeHeader(in.Subject); err == nil {
+		in.Subject = subject
+	}
+	// In-Reply-To names the direct parent; References the whole thread,
+	// oldest first
+	if parent := msgID(msg.Header.Get("In-Reply-To")); parent != "" {
+		in.ThreadIDs = append(in.ThreadIDs, parent)
+	}
+	refs := strings.Fields(msg.Header.Get("References"))
+	for i := len(refs) - 1; i >= 0; i-- {
+		if id := msgID(refs[i]); id != "" {
+			in.ThreadIDs = append(in.ThreadIDs, id)
+		}
+	}
+
+	text, err := plainText(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body)
+	if err != nil {
+		return in, err
+	}
+	in.Text = stripQuoted(text)
+	return in, nil
+}
+
+// plainText returns the text/plain content of a body, descending into
+// multipart bodies.
+func plainText(contentType, encoding string, body io.Reader) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+	body = decode(encoding, body)
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return "", nil
+			}
+			if err != nil {
+				return "", err
+			}
+			// multipart.Reader already undoes quoted-printable
+			text, err := plainText(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part)
+			if err != nil {
+				return "", err
+			}
+			if text != "" {
+				return text, nil
+			}
+		}
+	}
+	if mediaType != "text/plain" {
+		return "", nil
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", fmt.Errorf("reading body: %w", err)
+	}
+	return string(data), nil
+}
+
+func decode(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, newlineStripper{body})
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	}
+	return body
+}
+
+// stripQuoted drops the quoted history mail clients append to replies.
+func stripQuoted(text string) string {
+	var kept []string
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \r")
+		if replyHeader.MatchString(strings.TrimSpace(line)) {
+			break
+		}
+		if strings.HasPrefix(line, ">") {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return strings.TrimSpace(strings.Join(kept, "\n"))
+}
+
+// msgID returns the id inside angle brackets, or the value trimmed.
+func msgID(value string) string {
+	value = strings.TrimSpace(value)
+	if start := strings.IndexByte(value, '<'); start >= 0 {
+		if end := strings.IndexByte(value[start:], '>'); end > 0 {
+			return value[start+1 : start+end]
+		}
+	}
+	return value
+}
+
+// newlineStripper drops line breaks so base64 bodies split over lines decode.
+type newlineStripper struct {
+	r io.Reader
+}
+
+func (n newlineStripper) Read(p []byte) (int, error) {
+	count, err := n.r.Read(p)
+	kept := 0
+	for _, b := range p[:count] {
+		if b != '\r' && b != '\n' {
+			p[kept] = b
+			kept++
+		}
+	}
+	return kept, err
+}
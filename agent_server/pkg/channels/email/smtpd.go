@@ -0,0 +1,160 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// sessionTimeout bounds how long one SMTP client may hold a connection.
+const sessionTimeout = 5 * time.Minute
+
+var errTooLarge = errors.New("message too large")
+
+// listen accepts mail over SMTP on addr until ctx is done. It only accepts
+// mail, it never relays, so it should sit behind the MX that faces the
+// internet.
+func (a *Adapter) listen(ctx context.Context, receive func([]byte) error) error {
+	listener, err := net.Listen("tcp", a.config.ListenAddr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+	log.Printf("Accepting email on %s", listener.Addr())
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			return err
+		}
+		go a.serveSMTP(conn, receive)
+	}
+}
+
+func (a *Adapter) serveSMTP(conn net.Conn, receive func([]byte) error) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(sessionTimeout))
+	text := textproto.NewConn(conn)
+	reply := func(code int, msg string) {
+		text.PrintfLine("%d %s", code, msg)
+	}
+
+	reply(220, a.domain+" ESMTP ready")
+	var from string
+	var recipients int
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "HELO":
+			reply(250, a.domain)
+		case "EHLO":
+			text.PrintfLine("250-%s", a.domain)
+			text.PrintfLine("250 SIZE %d", a.config.MaxBytes)
+		case "MAIL":
+			if !strings.HasPrefix(strings.ToUpper(arg), "FROM:") {
+				reply(501, "Syntax: MAIL FROM:<address>")
+				continue
+			}
+			from, recipients = arg[len("FROM:"):], 0
+			reply(250, "OK")
+		case "RCPT":
+			if from == "" {
+				reply(503, "Need MAIL before RCPT")
+				continue
+			}
+			recipients++
+			reply(250, "OK")
+		case "DATA":
+			if recipients == 0 {
+				reply(503, "Need RCPT before DATA")
+				continue
+			}
+			reply(354, "End data with <CR><LF>.<CR><LF>")
+			data, err := readData(text.Reader.R, a.config.MaxBytes)
+			from, recipients = "", 0
+			switch {
+			case errors.Is(err, errTooLarge):
+				reply(552, "Message exceeds fixed maximum message size")
+			case err != nil:
+				return
+			default:
+				err := receive(data)
+				if errors.Is(err, errRejected) {
+					reply(554, "Transaction failed: "+err.Error())
+					continue
+				}
+				if err != nil {
+					log.Printf("Unable to accept email: %v", err)
+					reply(451, "Requested action aborted: try again later")
+					continue
+				}
+				reply(250, "OK: queued")
+			}
+		case "RSET":
+			from, recipients = "", 0
+			reply(250, "OK")
+		case "NOOP":
+			reply(250, "OK")
+		case "QUIT":
+			reply(221, "Bye")
+			return
+		default:
+			reply(502, "Command not implemented")
+		}
+	}
+}
+
+// readData reads a DATA section up to the lone dot, undoing dot-stuffing.
+// An oversized message is read to the end so the session stays in sync.
+func readData(r *bufio.Reader, max int64) ([]byte, error) {
+	var buf bytes.Buffer
+	tooLarge := false
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, fmt.Errorf("reading data: %w", err)
+		}
+		trimmed := bytes.TrimRight(line, "\r\n")
+		if bytes.Equal(trimmed, []byte(".")) {
+			break
+		}
+		if bytes.HasPrefix(line, []byte(".")) {
+			line = line[1:]
+		}
+		if int64(buf.Len()+len(line)) > max {
+			tooLarge = true
+			buf.Reset()
+		}
+		if !tooLarge {
+			buf.Write(line)
+		}
+	}
+	if tooLarge {
+		return nil, errTooLarge
+	}
+	return buf.Bytes(), nil
+}
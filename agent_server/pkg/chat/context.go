@@ -0,0 +1,263 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/sdutt/agentserver/configs"
+	models "github.com/sdutt/agentserver/models/chat"
+	jobmodels "github.com/sdutt/agentserver/models/jobs"
+	lyzr "github.com/sdutt/agentserver/models/lyzr"
+	"github.com/sdutt/agentserver/pkg/ids"
+	"github.com/sdutt/agentserver/pkg/jobs"
+	"github.com/sdutt/agentserver/pkg/providers"
+	"github.com/sdutt/agentserver/pkg/tokens"
+	"github.com/sdutt/agentserver/repository"
+)
+
+const summarizerInstructions = "Update the running summary of a customer support conversation. " +
+	"Keep names, order numbers, decisions and open questions, drop greetings and small talk. " +
+	"Reply with the updated summary only."
+
+// KindSummarize is the job kind folding older turns of a conversation into
+// its rolling summary.
+const KindSummarize = "conversation_summarize"
+
+type summarizeJob struct {
+	ConversationID string `json:"conversation_id"`
+	UpToSeq        int64  `json:"up_to_seq"`
+}
+
+// ContextBuilder assembles the prompt sent to the agent for a reply: a
+// rolling summary of older turns followed by the most recent turns verbatim,
+// kept within the token budget of the model. The summary is updated by a
+// queued job, off the reply path.
+type ContextBuilder struct {
+	config        *configs.ContextConfig
+	providers     *providers.Registry
+	conversations repository.ConversationRepository
+	jobs          *jobs.Queue
+}
+
+func NewContextBuilder(config *configs.ContextConfig, registry *providers.Registry, conversations repository.ConversationRepository, queue *jobs.Queue) *ContextBuilder {
+	if config.SummarizerAgentID == "" {
+		log.Printf("CONTEXT__SUMMARIZER_AGENT_ID is not set, turns beyond the token budget are dropped from prompts")
+	}
+	return &ContextBuilder{config, registry, conversations, queue}
+}
+
+// turn is a user message followed by everything up to the next user message.
+type turn []models.Message
+
+func (t turn) lastSeq() int64 {
+	return t[len(t)-1].Seq
+}
+
+// Build returns the context for answering parent. The returned snapshot is
+// not yet bound to a reply message.
+//
+// The summary is used only if it ends before parent, which is not the case
+// when an earlier reply is regenerated. Turns not yet summarized are sent
+// verbatim, and a summarize job is queued once there are more of them than
+// RecentTurns. Whatever still exceeds the token budget is dropped oldest
+// first and the snapshot marked truncated; without a summarizer agent that
+// is the only way older turns leave the prompt.
+func (b *ContextBuilder) Build(ctx context.Context, conversationID, model string, parent *models.Message) (*models.ContextSnapshot, error) {
+	conversation, err := b.conversations.GetConversation(ctx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := b.conversations.ListMessages(ctx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	summary, upToSeq := conversation.Summary, conversation.SummaryUpToSeq
+	if upToSeq >= parent.Seq {
+		summary, upToSeq = "", 0
+	}
+	var pending []turn
+	for _, t := range splitTurns(history(messages, parent)) {
+		if t.lastSeq() > upToSeq {
+			pending = append(pending, t)
+		}
+	}
+	if b.config.SummarizerAgentID != "" && upToSeq == conversation.SummaryUpToSeq && len(pending) > b.config.RecentTurns {
+		older := pending[:len(pending)-b.config.RecentTurns]
+		_, err := b.jobs.Enqueue(ctx, KindSummarize, summarizeJob{
+			ConversationID: conversation.ID,
+			UpToSeq:        older[len(older)-1].lastSeq(),
+		})
+		if err != nil {
+			log.Printf("Unable to queue summary of conversation %s: %v", conversation.ID, err)
+		}
+	}
+
+	snapshot := &models.ContextSnapshot{
+		ConversationID: conversation.ID,
+		Model:          model,
+		TokenBudget:    b.config.BudgetFor(model),
+		Summary:        summary,
+		SummaryUpToSeq: upToSeq,
+	}
+	verbatim := pending
+	snapshot.Prompt = render(summary, verbatim, parent)
+	snapshot.Tokens = tokens.Estimate(snapshot.Prompt)
+	for snapshot.Tokens > snapshot.TokenBudget && len(verbatim) > 0 {
+		verbatim = verbatim[1:]
+		snapshot.Truncated = true
+		snapshot.Prompt = render(summary, verbatim, parent)
+		snapshot.Tokens = tokens.Estimate(snapshot.Prompt)
+	}
+	for _, t := range verbatim {
+		for _, m := range t {
+			snapshot.MessageIDs = append(snapshot.MessageIDs, m.ID)
+		}
+	}
+	snapshot.MessageIDs = append(snapshot.MessageIDs, parent.ID)
+	return snapshot, nil
+}
+
+// HandleSummarize runs a queued summary update. Jobs overtaken by a newer
+// summary do nothing.
+func (b *ContextBuilder) HandleSummarize(ctx context.Context, job *jobmodels.Job) (string, error) {
+	var payload summarizeJob
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return "", jobs.Permanent(err)
+	}
+	conversation, err := b.conversations.GetConversation(ctx, payload.ConversationID)
+	if err != nil {
+		return "", jobs.Permanent(err)
+	}
+	if conversation.SummaryUpToSeq >= payload.UpToSeq {
+		return "", nil
+	}
+	messages, err := b.conversations.ListMessages(ctx, conversation.ID)
+	if err != nil {
+		return "", err
+	}
+	var older []turn
+	for _, t := range splitTurns(history(messages, &models.Message{Seq: payload.UpToSeq + 1})) {
+		if t.lastSeq() > conversation.SummaryUpToSeq {
+			older = append(older, t)
+		}
+	}
+	if len(older) == 0 {
+		return "", nil
+	}
+	if err := b.summarize(ctx, conversation, older); err != nil {
+		return "", err
+	}
+	return conversation.Summary, nil
+}
+
+// summarize folds older into the conversation's rolling summary.
+func (b *ContextBuilder) summarize(ctx context.Context, conversation *models.Conversation, older []turn) error {
+	var prompt strings.Builder
+	prompt.WriteString(summarizerInstructions)
+	if conversation.Summary != "" {
+		prompt.WriteString("\n\nCurrent summary:\n")
+		prompt.WriteString(conversation.Summary)
+	}
+	prompt.WriteString("\n\nNew messages:\n")
+	for _, t := range older {
+		writeTurn(&prompt, t)
+	}
+	resp, err := b.providers.Chat(ctx, lyzr.ChatPayload{
+		UserID:    "summarizer",
+		AgentID:   b.config.SummarizerAgentID,
+		SessionID: "summary-" + ids.New(),
+		Message:   prompt.String(),
+	})
+	if err != nil {
+		return err
+	}
+	summary := strings.TrimSpace(resp.Response)
+	if summary == "" {
+		return fmt.Errorf("summarizer returned an empty summary")
+	}
+	return b.conversations.SaveSummary(ctx, conversation, summary, older[len(older)-1].lastSeq())
+}
+
+// history is what preceded parent, keeping only the latest of regenerated
+// replies and dropping failed agent calls.
+func history(messages []models.Message, parent *models.Message) []models.Message {
+	latest := map[string]int64{}
+	for _, m := range messages {
+		if m.Role == models.RoleAgent && m.ParentID != "" && m.Seq < parent.Seq {
+			latest[m.ParentID] = max(latest[m.ParentID], m.Seq)
+		}
+	}
+	var out []models.Message
+	for _, m := range messages {
+		if m.Seq >= parent.Seq {
+			break
+		}
+		if m.ParentID != "" && m.Role == models.RoleSystem {
+			continue
+		}
+		if m.Role == models.RoleAgent && m.ParentID != "" && latest[m.ParentID] != m.Seq {
+			continue
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+func splitTurns(messages []models.Message) []turn {
+	var turns []turn
+	for _, m := range messages {
+		if m.Role == models.RoleUser || len(turns) == 0 {
+			turns = append(turns, turn{m})
+			continue
+		}
+		turns[len(turns)-1] = append(turns[len(turns)-1], m)
+	}
+	return turns
+}
+
+func render(summary string, turns []turn, parent *models.Message) string {
+	if summary == "" && len(turns) == 0 {
+		return parent.Text
+	}
+	var b strings.Builder
+	if summary != "" {
+		b.WriteString("Summary of the earlier conversation:\n")
+		b.WriteString(summary)
+		b.WriteString("\n\n")
+	}
+	if len(turns) > 0 {
+		b.WriteString("Conversation so far:\n")
+		for _, t := range turns {
+			writeTurn(&b, t)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("User: ")
+	b.WriteString(parent.Text)
+	return b.String()
+}
+
+func writeTurn(b *strings.Builder, t turn) {
+	for _, m := range t {
+		b.WriteString(speaker(m.Role))
+		b.WriteString(": ")
+		b.WriteString(m.Text)
+		b.WriteString("\n")
+	}
+}
+
+func speaker(role string) string {
+	switch role {
+	case models.RoleUser:
+		return "User"
+	case models.RoleAgent:
+		return "Assistant"
+	case models.RoleOperator:
+		return "Operator"
+	}
+	return "System"
+}
@@ -0,0 +1,185 @@
+package chat
+
+import (
+	"time"
+
+	models "github.com/sdutt/agentserver/models/chat"
+	"github.com/sdutt/agentserver/pkg/presence"
+)
+
+// Frame types of the chat protocol. Chat messages sent to clients carry no
+// type so older clients keep rendering them.
+const (
+	FrameMessage        = "message"
+	FrameSession        = "session"
+	FrameError          = "error"
+	FrameEdit           = "edit"
+	FrameDelete         = "delete"
+	FrameRegenerate     = "regenerate"
+	FrameMessageEdited  = "message_edited"
+	FrameMessageDeleted = "message_deleted"
+	FrameFeedback       = "feedback"
+	FrameFeedbackSaved  = "feedback_saved"
+	FrameEscalated      = "escalated"
+	FrameResolved       = "resolved"
+	FrameAck            = "ack"
+	FrameRead           = "read"
+	FrameReadReceipt    = "read_receipt"
+	FrameDraft          = "draft"
+	// FramePresence is sent by clients to set their status and by the server
+	// to announce status changes.
+	FramePresence            = presence.FramePresence
+	FramePresenceSubscribe   = "presence_subscribe"
+	FramePresenceUnsubscribe = "presence_unsubscribe"
+	FramePresenceSnapshot    = "presence_snapshot"
+)
+
+type Message struct {
+	ID          string              `json:"id"`
+	From        string              `json:"from"`
+	Text        string              `json:"text"`
+	Timestamp   string              `json:"timestamp"`
+	Attachments []models.Attachment `json:"attachments,omitempty"`
+	ParentID    string              `json:"parent_id,omitempty"`
+	Seq         int64               `json:"seq,omitempty"`
+}
+
+// Frame is any frame a client sends after the handshake. An empty type is a
+// chat message.
+type Frame struct {
+	Type string `json:"type,omitempty"`
+	Message
+	MessageID  string `json:"message_id,omitempty"`
+	Regenerate bool   `json:"regenerate,omitempty"`
+	Status     string `json:"status,omitempty"`
+	Rating
+}
+
+// Rating is the payload of a feedback frame.
+type Rating struct {
+	Rating  string `json:"rating,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// Handshake is the first frame a client sends after connecting. An empty
+// conversation id starts a new conversation with the given agent.
+type Handshake struct {
+	ConversationID string `json:"conversation_id"`
+	AgentID        string `json:"agent_id"`
+	UserID         string `json:"user_id"`
+	WorkspaceID    string `json:"workspace_id"`
+	// Role is user (the default) or operator. Operators join existing
+	// conversations with the operator key and use UserID as their own id.
+	Role        string `json:"role"`
+	OperatorKey string `json:"operator_key"`
+	// Channel is set by channel adapters opening conversations; sockets
+	// cannot choose it.
+	Channel string `json:"-"`
+}
+
+// Participant is who is on the other end of a client connection.
+type Participant struct {
+	ID   string `json:"id"`
+	Role string `json:"role"`
+}
+
+type SessionFrame struct {
+	Type           string `json:"type"`
+	ConversationID string `json:"conversation_id"`
+}
+
+type ErrorFrame struct {
+	Type  string `json:"type"`
+	Error string `json:"error"`
+}
+
+type MessageEditedFrame struct {
+	Type           string    `json:"type"`
+	ConversationID string    `json:"conversation_id"`
+	MessageID      string    `json:"message_id"`
+	Text           string    `json:"text"`
+	EditedAt       time.Time `json:"edited_at"`
+}
+
+type MessageDeletedFrame struct {
+	Type           string `json:"type"`
+	ConversationID string `json:"conversation_id"`
+	MessageID      string `json:"message_id"`
+}
+
+func NewMessage(m *models.Message) Message {
+	return Message{
+		ID:          m.ID,
+		From:        m.Role,
+		Text:        m.Text,
+		Timestamp:   m.CreatedAt.Format(time.RFC3339),
+		Attachments: m.Attachments,
+		ParentID:    m.ParentID,
+		Seq:         m.Seq,
+	}
+}
+
+// DraftFrame carries the part of an agent answer to ParentID produced so
+// far. The answer itself follows as a message with the same parent.
+type DraftFrame struct {
+	Type     string `json:"type"`
+	ParentID string `json:"parent_id"`
+	Text     string `json:"text"`
+}
+
+type FeedbackSavedFrame struct {
+	Type       string `json:"type"`
+	MessageID  string `json:"message_id"`
+	FeedbackID string `json:"feedback_id"`
+	Rating     string `json:"rating"`
+}
+
+type EscalatedFrame struct {
+	Type           string    `json:"type"`
+	ConversationID string    `json:"conversation_id"`
+	Reason         string    `json:"reason,omitempty"`
+	EscalatedAt    time.Time `json:"escalated_at"`
+}
+
+type ResolvedFrame struct {
+	Type           string    `json:"type"`
+	ConversationID string    `json:"conversation_id"`
+	Resolution     string    `json:"resolution,omitempty"`
+	ResolvedAt     time.Time `json:"resolved_at"`
+}
+
+// AckFrame confirms a client message was stored. ClientID echoes the id the
+// client gave the message.
+type AckFrame struct {
+	Type      string `json:"type"`
+	ClientID  string `json:"client_id"`
+	MessageID string `json:"message_id"`
+	Seq       int64  `json:"seq"`
+	Timestamp string `json:"timestamp"`
+}
+
+type ReadReceiptFrame struct {
+	Type           string    `json:"type"`
+	ConversationID string    `json:"conversation_id"`
+	ParticipantID  string    `json:"participant_id"`
+	Role           string    `json:"role"`
+	MessageID      string    `json:"message_id"`
+	Seq            int64     `json:"seq"`
+	ReadAt         time.Time `json:"read_at"`
+}
+
+func NewAck(clientID string, m *models.Message) AckFrame {
+	return AckFrame{
+		Type:      FrameAck,
+		ClientID:  clientID,
+		MessageID: m.ID,
+		Seq:       m.Seq,
+		Timestamp: m.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+type PresenceSnapshotFrame struct {
+	Type    string           `json:"type"`
+	Entries []presence.Entry `json:"entries"`
+}
@@ -0,0 +1,126 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+
+	"github.com/sdutt/agentserver/pkg/broker"
+	"github.com/sdutt/agentserver/pkg/ids"
+)
+
+// Client is one connected socket. Send must be safe for concurrent use.
+type Client interface {
+	Send(frame interface{}) error
+}
+
+// envelope carries a broadcast frame to the other instances.
+type envelope struct {
+	Origin string          `json:"origin"`
+	Frame  json.RawMessage `json:"frame"`
+}
+
+// Hub tracks which clients are attached to which conversation on this
+// instance. Broadcasts reach local clients directly and are published on
+// the broker so that instances holding other clients of the conversation
+// deliver them too.
+type Hub struct {
+	id     string
+	broker broker.Broker
+	mu     sync.RWMutex
+	rooms  map[string]map[Client]struct{}
+	cancel map[string]func()
+}
+
+func NewHub(b broker.Broker) *Hub {
+	return &Hub{
+		id:     ids.New(),
+		broker: b,
+		rooms:  make(map[string]map[Client]struct{}),
+		cancel: make(map[string]func()),
+	}
+}
+
+func conversationTopic(conversationID string) string {
+	return "conversation:" + conversationID
+}
+
+func (h *Hub) Join(conversationID string, client Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	room, ok := h.rooms[conversationID]
+	if !ok {
+		room = make(map[Client]struct{})
+		h.rooms[conversationID] = room
+		cancel, err := h.broker.Subscribe(conversationTopic(conversationID), func(payload []byte) {
+			h.receive(conversationID, payload)
+		})
+		if err != nil {
+			log.Printf("Unable to subscribe to conversation %s: %v", conversationID, err)
+		} else {
+			h.cancel[conversationID] = cancel
+		}
+	}
+	room[client] = struct{}{}
+}
+
+func (h *Hub) Leave(conversationID string, client Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	room := h.rooms[conversationID]
+	delete(room, client)
+	if len(room) == 0 {
+		delete(h.rooms, conversationID)
+		if cancel, ok := h.cancel[conversationID]; ok {
+			cancel()
+			delete(h.cancel, conversationID)
+		}
+	}
+}
+
+// Broadcast sends frame to every client of the conversation except the
+// given one, which may be nil.
+func (h *Hub) Broadcast(conversationID string, frame interface{}, except Client) {
+	h.deliver(conversationID, frame, except)
+
+	data, err := json.Marshal(frame)
+	if err != nil {
+		log.Printf("Unable to encode broadcast for conversation %s: %v", conversationID, err)
+		return
+	}
+	payload, _ := json.Marshal(envelope{Origin: h.id, Frame: data})
+	if err := h.broker.Publish(context.Background(), conversationTopic(conversationID), payload); err != nil {
+		log.Printf("Publish to conversation %s failed: %v", conversationID, err)
+	}
+}
+
+// receive delivers a frame broadcast by another instance.
+func (h *Hub) receive(conversationID string, payload []byte) {
+	var env envelope
+	if err := json.Unmarshal(payload, &env); err != nil {
+		log.Printf("Invalid broadcast for conversation %s: %v", conversationID, err)
+		return
+	}
+	if env.Origin == h.id {
+		return
+	}
+	h.deliver(conversationID, env.Frame, nil)
+}
+
+func (h *Hub) deliver(conversationID string, frame interface{}, except Client) {
+	h.mu.RLock()
+	clients := make([]Client, 0, len(h.rooms[conversationID]))
+	for client := range h.rooms[conversationID] {
+		if client != except {
+			clients = append(clients, client)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, client := range clients {
+		if err := client.Send(frame); err != nil {
+			log.Printf("Broadcast to conversation %s failed: %v", conversationID, err)
+		}
+	}
+}
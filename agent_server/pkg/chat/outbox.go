@@ -0,0 +1,66 @@
+package chat
+
+import (
+	"errors"
+	"log"
+	"sync"
+)
+
+// outboxSize is how many frames may wait for a client before it counts as
+// too slow to keep.
+const outboxSize = 256
+
+var errClientGone = errors.New("client connection is closed")
+
+// outbox queues the frames for a connection and writes them from its own
+// goroutine, so broadcasts, which run on the broker's reader, never wait on
+// a slow socket. A client that falls outboxSize frames behind is closed.
+type outbox struct {
+	Conn
+	frames chan interface{}
+	done   chan struct{}
+	once   sync.Once
+}
+
+func newOutbox(conn Conn) *outbox {
+	o := &outbox{Conn: conn, frames: make(chan interface{}, outboxSize), done: make(chan struct{})}
+	go o.run()
+	return o
+}
+
+func (o *outbox) Send(frame interface{}) error {
+	select {
+	case <-o.done:
+		return errClientGone
+	case o.frames <- frame:
+		return nil
+	default:
+		log.Printf("Closing a client %d frames behind", outboxSize)
+		o.close()
+		return errClientGone
+	}
+}
+
+func (o *outbox) run() {
+	for {
+		select {
+		case <-o.done:
+			return
+		case frame := <-o.frames:
+			if err := o.Conn.Send(frame); err != nil {
+				log.Printf("Write error: %v", err)
+				o.close()
+				return
+			}
+		}
+	}
+}
+
+// close stops the writer and closes the connection, which also ends the
+// read loop of its session.
+func (o *outbox) close() {
+	o.once.Do(func() {
+		close(o.done)
+		o.Conn.Close()
+	})
+}
@@ -0,0 +1,587 @@
+package chat
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	models "github.com/sdutt/agentserver/models/chat"
+	jobmodels "github.com/sdutt/agentserver/models/jobs"
+	lyzr "github.com/sdutt/agentserver/models/lyzr"
+	webhookmodels "github.com/sdutt/agentserver/models/webhooks"
+	"github.com/sdutt/agentserver/pkg/ids"
+	"github.com/sdutt/agentserver/pkg/jobs"
+	"github.com/sdutt/agentserver/pkg/presence"
+	"github.com/sdutt/agentserver/pkg/providers"
+	"github.com/sdutt/agentserver/pkg/redact"
+	"github.com/sdutt/agentserver/pkg/tokens"
+	"github.com/sdutt/agentserver/pkg/webhooks"
+	"github.com/sdutt/agentserver/repository"
+)
+
+// Shown while the Lyzr circuit breaker is open: a notice while the reply is
+// still retried, and the transcript entry once it gave up.
+const (
+	msgUpstreamDelayed     = "Our assistant is temporarily unavailable. We will answer as soon as it is back."
+	msgUpstreamUnavailable = "Our assistant is temporarily unavailable, please try again in a few minutes."
+)
+
+var (
+	ErrAgentRequired  = errors.New("agent_id is required to start a conversation")
+	ErrNotEditable    = errors.New("only user messages can be edited or deleted")
+	ErrForbidden      = errors.New("conversation or message belongs to another user")
+	ErrActorRequired  = errors.New("user_id is required to edit or delete a message")
+	ErrRaterRequired  = errors.New("user_id is required to rate a message")
+	ErrReaderRequired = errors.New("user_id is required to mark messages read")
+	ErrNoParent       = errors.New("message has no user message to answer")
+	ErrNotRateable    = errors.New("only agent replies can be rated")
+	ErrInvalidRating  = errors.New("rating must be up or down with a matching reason code")
+	ErrEscalated      = errors.New("conversation is already escalated")
+	ErrResolved       = errors.New("conversation is already resolved")
+	ErrInvalidRole    = errors.New("role must be user or operator")
+	ErrJoinRequired   = errors.New("operators can only join existing conversations")
+	ErrOperatorID     = errors.New("operators must identify themselves with user_id")
+	ErrOperatorKey    = errors.New("the operator role needs the operator key")
+	ErrInboundRole    = errors.New("inbound messages must have role system or agent")
+	ErrWorkspace      = errors.New("conversation belongs to another workspace")
+)
+
+// KindAgentReply is the job kind of queued agent answers.
+const KindAgentReply = "agent_reply"
+
+// KindChannelSend is the job kind delivering a message to the external
+// channel of its conversation.
+const KindChannelSend = "channel_send"
+
+type replyJob struct {
+	ConversationID string `json:"conversation_id"`
+	MessageID      string `json:"message_id"`
+}
+
+// ChannelSend is the payload of KindChannelSend jobs.
+type ChannelSend struct {
+	ConversationID string `json:"conversation_id"`
+	MessageID      string `json:"message_id"`
+}
+
+// Service runs conversations: it persists messages, calls the agent and
+// notifies every client attached to the conversation.
+type Service struct {
+	providers     *providers.Registry
+	conversations repository.ConversationRepository
+	feedback      repository.FeedbackRepository
+	calls         repository.AgentCallRepository
+	prices        *tokens.Prices
+	contexts      *ContextBuilder
+	hub           *Hub
+	presence      *presence.Tracker
+	jobs          *jobs.Queue
+	webhooks      *webhooks.Dispatcher
+	operatorKey   string
+}
+
+func NewService(registry *providers.Registry, conversations repository.ConversationRepository, feedback repository.FeedbackRepository, calls repository.AgentCallRepository, prices *tokens.Prices, contexts *ContextBuilder, hub *Hub, tracker *presence.Tracker, queue *jobs.Queue, dispatcher *webhooks.Dispatcher, operatorKey string) *Service {
+	return &Service{registry, conversations, feedback, calls, prices, contexts, hub, tracker, queue, dispatcher, operatorKey}
+}
+
+// IsOperator reports whether key is the operator key. Without a configured
+// key nobody is an operator.
+func (s *Service) IsOperator(key string) bool {
+	return s.operatorKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(s.operatorKey)) == 1
+}
+
+func (s *Service) Hub() *Hub {
+	return s.hub
+}
+
+func (s *Service) Contexts() *ContextBuilder {
+	return s.contexts
+}
+
+func (s *Service) Open(ctx context.Context, hs Handshake) (*models.Conversation, error) {
+	switch hs.Role {
+	case "", models.RoleUser:
+	case models.RoleOperator:
+		if hs.ConversationID == "" {
+			return nil, ErrJoinRequired
+		}
+		if hs.UserID == "" {
+			return nil, ErrOperatorID
+		}
+		if !s.IsOperator(hs.OperatorKey) {
+			return nil, ErrOperatorKey
+		}
+	default:
+		return nil, ErrInvalidRole
+	}
+	if hs.ConversationID != "" {
+		return s.conversations.GetConversation(ctx, hs.ConversationID)
+	}
+	if hs.AgentID == "" {
+		return nil, ErrAgentRequired
+	}
+	conversation := &models.Conversation{
+		AgentID:     hs.AgentID,
+		UserID:      hs.UserID,
+		WorkspaceID: hs.WorkspaceID,
+		Channel:     hs.Channel,
+	}
+	if err := s.conversations.CreateConversation(ctx, conversation); err != nil {
+		return nil, err
+	}
+	s.webhooks.Publish(ctx, webhookmodels.EventConversationCreated, conversation.WorkspaceID, conversation)
+	return conversation, nil
+}
+
+// FindAgent looks up the agent so replies can record the configuration they
+// were produced with. A failed lookup only loses that metadata.
+func (s *Service) FindAgent(ctx context.Context, agentID string) *lyzr.Agent {
+	agent, err := s.providers.GetAgent(ctx, agentID)
+	if err != nil {
+		log.Printf("Unable to look up agent %s: %v", agentID, err)
+		return nil
+	}
+	return agent
+}
+
+// Participant returns who a connection that opened the conversation with hs
+// speaks for. Users can only join their own conversations.
+func (s *Service) Participant(conversation *models.Conversation, hs Handshake) (Participant, error) {
+	if hs.Role == models.RoleOperator {
+		return Participant{ID: hs.UserID, Role: models.RoleOperator}, nil
+	}
+	if hs.UserID != conversation.UserID {
+		return Participant{}, ErrForbidden
+	}
+	return Participant{ID: conversation.UserID, Role: models.RoleUser}, nil
+}
+
+// Post stores a message of the participant and shows it on every other
+// client of the conversation.
+func (s *Service) Post(ctx context.Context, conversation *models.Conversation, participant Participant, msg Message, from Client) (*models.Message, error) {
+	message := &models.Message{
+		ConversationID: conversation.ID,
+		Role:           participant.Role,
+		SenderID:       participant.ID,
+		Text:           msg.Text,
+		Attachments:    msg.Attachments,
+	}
+	message.ModerationFlags = moderate(message.Text)
+	if err := s.conversations.AppendMessage(ctx, message); err != nil {
+		return nil, err
+	}
+	s.hub.Broadcast(conversation.ID, NewMessage(message), from)
+	if participant.Role == models.RoleOperator {
+		s.relay(ctx, conversation, message)
+	}
+	return message, nil
+}
+
+// relay queues message for the external channel the conversation came
+// through, if any.
+func (s *Service) relay(ctx context.Context, conversation *models.Conversation, message *models.Message) {
+	if conversation.Channel == "" {
+		return
+	}
+	_, err := s.jobs.Enqueue(ctx, KindChannelSend, ChannelSend{
+		ConversationID: conversation.ID,
+		MessageID:      message.ID,
+	})
+	if err != nil {
+		log.Printf("Unable to queue message %s for channel %s: %v", message.ID, conversation.Channel, err)
+	}
+}
+
+// Inbound is a message posted by an external system. Without a
+// ConversationID a new conversation is opened from AgentID, UserID and
+// WorkspaceID.
+type Inbound struct {
+	ConversationID string              `json:"conversation_id"`
+	AgentID        string              `json:"agent_id"`
+	UserID         string              `json:"user_id"`
+	WorkspaceID    string              `json:"workspace_id"`
+	Role           string              `json:"role"`
+	SenderID       string              `json:"sender_id"`
+	Text           string              `json:"text"`
+	Attachments    []models.Attachment `json:"attachments"`
+}
+
+// PostInbound appends a system or agent-attributed message from an external
+// system. It is stored and shown like any other message, so it becomes part
+// of the context of the next agent call.
+func (s *Service) PostInbound(ctx context.Context, in Inbound) (*models.Conversation, *models.Message, error) {
+	if in.Role == "" {
+		in.Role = models.RoleSystem
+	}
+	if in.Role != models.RoleSystem && in.Role != models.RoleAgent {
+		return nil, nil, ErrInboundRole
+	}
+	conversation, err := s.Open(ctx, Handshake{
+		ConversationID: in.ConversationID,
+		AgentID:        in.AgentID,
+		UserID:         in.UserID,
+		WorkspaceID:    in.WorkspaceID,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if conversation.WorkspaceID != in.WorkspaceID {
+		return nil, nil, ErrWorkspace
+	}
+	sender := in.SenderID
+	if sender == "" && in.Role == models.RoleAgent {
+		sender = conversation.AgentID
+	}
+	message := &models.Message{
+		ConversationID: conversation.ID,
+		Role:           in.Role,
+		SenderID:       sender,
+		Text:           in.Text,
+		Attachments:    in.Attachments,
+	}
+	message.ModerationFlags = moderate(message.Text)
+	if err := s.conversations.AppendMessage(ctx, message); err != nil {
+		return nil, nil, err
+	}
+	s.hub.Broadcast(conversation.ID, NewMessage(message), nil)
+	return conversation, message, nil
+}
+
+// RequestReply queues an agent answer to parent. The reply reaches the
+// clients of the conversation once a worker has produced it.
+func (s *Service) RequestReply(ctx context.Context, parent *models.Message) (*jobmodels.Job, error) {
+	return s.jobs.Enqueue(ctx, KindAgentReply, replyJob{
+		ConversationID: parent.ConversationID,
+		MessageID:      parent.ID,
+	})
+}
+
+// HandleReply runs a queued agent answer. Upstream failures are retried by
+// the queue; only the last attempt stores the failure in the transcript.
+func (s *Service) HandleReply(ctx context.Context, job *jobmodels.Job) (string, error) {
+	var payload replyJob
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return "", jobs.Permanent(err)
+	}
+	conversation, err := s.conversations.GetConversation(ctx, payload.ConversationID)
+	if err != nil {
+		return "", jobs.Permanent(err)
+	}
+	// a parent deleted meanwhile needs no answer
+	parent, err := s.conversations.GetMessage(ctx, payload.ConversationID, payload.MessageID)
+	if err != nil {
+		return "", jobs.Permanent(err)
+	}
+	message, err := s.reply(ctx, conversation, s.FindAgent(ctx, conversation.AgentID), parent, job.LastAttempt())
+	if providers.IsUnavailable(err) && job.Attempts == 1 && !job.LastAttempt() {
+		// tell the clients once why the answer is late; it is not stored
+		s.hub.Broadcast(conversation.ID, ErrorFrame{Type: FrameError, Error: msgUpstreamDelayed}, nil)
+	}
+	if err != nil {
+		return "", err
+	}
+	return message.ID, nil
+}
+
+// reply asks the agent to answer parent, persists the answer and sends it to
+// every client. On the final attempt an upstream failure is stored as a
+// system message so the transcript shows it, and the upstream error is
+// returned with it; before that the failure is only recorded as a failed
+// call and returned, so the caller can try again.
+func (s *Service) reply(ctx context.Context, conversation *models.Conversation, agent *lyzr.Agent, parent *models.Message, final bool) (*models.Message, error) {
+	message := &models.Message{
+		ConversationID: conversation.ID,
+		Role:           models.RoleAgent,
+		SenderID:       conversation.AgentID,
+		ParentID:       parent.ID,
+	}
+	if agent != nil {
+		message.AgentName = agent.Name
+		message.AgentModel = agent.Model
+		message.AgentTemperature = agent.Temperature
+		message.AgentRevision = agent.Revision()
+	}
+	snapshot, err := s.contexts.Build(ctx, conversation.ID, message.AgentModel, parent)
+	if err != nil {
+		return nil, err
+	}
+	started := time.Now()
+	// clients see the answer grow; the stored message replaces the draft
+	var draft strings.Builder
+	resp, callErr := s.providers.Stream(ctx, lyzr.ChatPayload{
+		UserID:  conversation.UserID,
+		AgentID: conversation.AgentID,
+		// the prompt carries the history; a fresh session keeps the
+		// provider from adding its own memory of the conversation
+		SessionID: conversation.ID + "-" + ids.New(),
+		Message:   snapshot.Prompt,
+	}, func(delta string) error {
+		draft.WriteString(delta)
+		s.hub.Broadcast(conversation.ID, DraftFrame{Type: FrameDraft, ParentID: parent.ID, Text: draft.String()}, nil)
+		return nil
+	})
+	call := &models.AgentCall{
+		ConversationID: conversation.ID,
+		AgentID:        conversation.AgentID,
+		AgentModel:     message.AgentModel,
+		AgentRevision:  message.AgentRevision,
+		StatusCode:     http.StatusOK,
+		LatencyMs:      time.Since(started).Milliseconds(),
+		PromptTokens:   snapshot.Tokens,
+	}
+	if callErr != nil {
+		log.Printf("Agent call failed: %v", callErr)
+		call.StatusCode = 0
+		var apiErr *providers.Error
+		if errors.As(callErr, &apiErr) {
+			call.StatusCode = apiErr.StatusCode
+		}
+		if !final {
+			if err := s.calls.RecordCall(ctx, call); err != nil {
+				log.Printf("Unable to record agent call: %v", err)
+			}
+			return nil, callErr
+		}
+		message.Role = models.RoleSystem
+		message.Text = "The agent is unavailable right now, please try again."
+		if providers.IsUnavailable(callErr) {
+			message.Text = msgUpstreamUnavailable
+		}
+	} else {
+		message.Text = resp.Response
+		// prefer the usage the provider reports over our estimates
+		if resp.Usage != nil {
+			call.PromptTokens = resp.Usage.PromptTokens
+			call.CompletionTokens = resp.Usage.CompletionTokens
+		} else {
+			call.CompletionTokens = tokens.Estimate(resp.Response)
+			call.UsageEstimated = true
+		}
+		call.Cost = s.prices.Cost(message.AgentModel, call.PromptTokens, call.CompletionTokens)
+	}
+	message.ModerationFlags = moderate(message.Text)
+	if err := s.conversations.AppendMessage(ctx, message); err != nil {
+		return nil, err
+	}
+	call.MessageID = message.ID
+	if err := s.calls.RecordCall(ctx, call); err != nil {
+		log.Printf("Unable to record agent call: %v", err)
+	}
+	snapshot.MessageID = message.ID
+	if err := s.conversations.SaveContextSnapshot(ctx, snapshot); err != nil {
+		log.Printf("Unable to store context of reply %s: %v", message.ID, err)
+	}
+	s.hub.Broadcast(conversation.ID, NewMessage(message), nil)
+	if callErr == nil {
+		s.relay(ctx, conversation, message)
+	}
+	return message, callErr
+}
+
+// Escalate marks the conversation as handed over to a human.
+func (s *Service) Escalate(ctx context.Context, conversationID, reason string) (*models.Conversation, error) {
+	conversation, err := s.conversations.GetConversation(ctx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	if conversation.EscalatedAt != nil {
+		return nil, ErrEscalated
+	}
+	if err := s.conversations.EscalateConversation(ctx, conversation, reason); err != nil {
+		return nil, err
+	}
+	s.hub.Broadcast(conversation.ID, EscalatedFrame{
+		Type:           FrameEscalated,
+		ConversationID: conversation.ID,
+		Reason:         reason,
+		EscalatedAt:    *conversation.EscalatedAt,
+	}, nil)
+	s.webhooks.Publish(ctx, webhookmodels.EventConversationEscalated, conversation.WorkspaceID, conversation)
+	return conversation, nil
+}
+
+// Resolve closes the ticket the conversation raised.
+func (s *Service) Resolve(ctx context.Context, conversationID, resolution string) (*models.Conversation, error) {
+	conversation, err := s.conversations.GetConversation(ctx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	if conversation.ResolvedAt != nil {
+		return nil, ErrResolved
+	}
+	if err := s.conversations.ResolveConversation(ctx, conversation, resolution); err != nil {
+		return nil, err
+	}
+	s.hub.Broadcast(conversation.ID, ResolvedFrame{
+		Type:           FrameResolved,
+		ConversationID: conversation.ID,
+		Resolution:     resolution,
+		ResolvedAt:     *conversation.ResolvedAt,
+	}, nil)
+	s.webhooks.Publish(ctx, webhookmodels.EventTicketResolved, conversation.WorkspaceID, conversation)
+	return conversation, nil
+}
+
+// Edit changes the text of a user message. Only its sender or an operator
+// may edit it.
+func (s *Service) Edit(ctx context.Context, conversationID, messageID string, editor Participant, text string) (*models.Message, error) {
+	message, err := s.editable(ctx, conversationID, messageID, editor)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.conversations.EditMessage(ctx, message, text, moderate(text), editor.ID); err != nil {
+		return nil, err
+	}
+	s.hub.Broadcast(conversationID, MessageEditedFrame{
+		Type:           FrameMessageEdited,
+		ConversationID: conversationID,
+		MessageID:      message.ID,
+		Text:           message.Text,
+		EditedAt:       *message.EditedAt,
+	}, nil)
+	return message, nil
+}
+
+// Delete removes a user message. Only its sender or an operator may delete it.
+func (s *Service) Delete(ctx context.Context, conversationID, messageID string, actor Participant) error {
+	message, err := s.editable(ctx, conversationID, messageID, actor)
+	if err != nil {
+		return err
+	}
+	if err := s.conversations.DeleteMessage(ctx, message); err != nil {
+		return err
+	}
+	s.hub.Broadcast(conversationID, MessageDeletedFrame{
+		Type:           FrameMessageDeleted,
+		ConversationID: conversationID,
+		MessageID:      message.ID,
+	}, nil)
+	return nil
+}
+
+// Regenerate queues a new reply to the user message messageID, or to the
+// message an agent reply messageID answered. Earlier replies are kept as
+// siblings sharing the same parent.
+func (s *Service) Regenerate(ctx context.Context, conversationID, messageID string) (*jobmodels.Job, error) {
+	parent, err := s.conversations.GetMessage(ctx, conversationID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if parent.Role != models.RoleUser {
+		if parent.ParentID == "" {
+			return nil, ErrNoParent
+		}
+		parent, err = s.conversations.GetMessage(ctx, conversationID, parent.ParentID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s.RequestReply(ctx, parent)
+}
+
+// Rate stores a user's rating of an agent reply against the agent revision
+// that produced it.
+func (s *Service) Rate(ctx context.Context, conversationID, messageID, userID string, rating Rating) (*models.Feedback, error) {
+	// ratings are keyed on the rater, so anonymous ones would overwrite
+	// each other
+	if userID == "" {
+		return nil, ErrRaterRequired
+	}
+	if rating.Rating != models.RatingUp && rating.Rating != models.RatingDown {
+		return nil, ErrInvalidRating
+	}
+	if !models.ValidFeedbackReason(rating.Rating, rating.Reason) {
+		return nil, ErrInvalidRating
+	}
+	message, err := s.conversations.GetMessage(ctx, conversationID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if message.Role != models.RoleAgent {
+		return nil, ErrNotRateable
+	}
+	feedback := &models.Feedback{
+		MessageID:      message.ID,
+		UserID:         userID,
+		ConversationID: conversationID,
+		AgentID:        message.SenderID,
+		AgentRevision:  message.AgentRevision,
+		Rating:         rating.Rating,
+		Reason:         rating.Reason,
+		Comment:        rating.Comment,
+	}
+	if err := s.feedback.SaveFeedback(ctx, feedback); err != nil {
+		return nil, err
+	}
+	return feedback, nil
+}
+
+// MarkRead records that the participant has read the conversation up to
+// messageID and tells the other participants.
+func (s *Service) MarkRead(ctx context.Context, conversationID string, participant Participant, messageID string, from Client) (*models.ReadState, error) {
+	// read states are keyed on the participant
+	if participant.ID == "" {
+		return nil, ErrReaderRequired
+	}
+	message, err := s.conversations.GetMessage(ctx, conversationID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	state := &models.ReadState{
+		ConversationID:    conversationID,
+		ParticipantID:     participant.ID,
+		ParticipantRole:   participant.Role,
+		LastReadMessageID: message.ID,
+		LastReadSeq:       message.Seq,
+		ReadAt:            time.Now(),
+	}
+	if err := s.conversations.MarkRead(ctx, state); err != nil {
+		return nil, err
+	}
+	s.hub.Broadcast(conversationID, ReadReceiptFrame{
+		Type:           FrameReadReceipt,
+		ConversationID: conversationID,
+		ParticipantID:  participant.ID,
+		Role:           participant.Role,
+		MessageID:      message.ID,
+		Seq:            message.Seq,
+		ReadAt:         state.ReadAt,
+	}, from)
+	return state, nil
+}
+
+// editable returns the user message messageID if actor may change it:
+// operators may change any user message, users only their own.
+func (s *Service) editable(ctx context.Context, conversationID, messageID string, actor Participant) (*models.Message, error) {
+	if actor.ID == "" {
+		return nil, ErrActorRequired
+	}
+	if actor.Role != models.RoleUser && actor.Role != models.RoleOperator {
+		return nil, ErrInvalidRole
+	}
+	message, err := s.conversations.GetMessage(ctx, conversationID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if message.Role != models.RoleUser {
+		return nil, ErrNotEditable
+	}
+	if actor.Role != models.RoleOperator && message.SenderID != actor.ID {
+		return nil, ErrForbidden
+	}
+	return message, nil
+}
+
+// moderate flags the kinds of personal data found in text, such as "pii:email".
+func moderate(text string) []string {
+	var flags []string
+	for _, kind := range redact.Detect(text) {
+		flags = append(flags, "pii:"+kind)
+	}
+	return flags
+}
@@ -0,0 +1,155 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	models "github.com/sdutt/agentserver/models/chat"
+	"github.com/sdutt/agentserver/pkg/presence"
+)
+
+// Conn is a client connection of any transport. Read returns one frame.
+// Close must make a pending Read return.
+type Conn interface {
+	Client
+	Read() ([]byte, error)
+	Close() error
+}
+
+type session struct {
+	conversation *models.Conversation
+	participant  Participant
+	conn         Conn
+}
+
+// Serve runs the chat protocol on conn until the client goes away: a
+// handshake frame first, then chat messages and control frames.
+func (s *Service) Serve(ctx context.Context, conn Conn) {
+	// Wait for an initial client message before entering main loop
+	msgBytes, err := conn.Read()
+	if err != nil {
+		log.Printf("Read error during handshake: %v", err)
+		return
+	}
+
+	var hs Handshake
+	if err := json.Unmarshal(msgBytes, &hs); err != nil {
+		log.Printf("Handshake unmarshal error: %v", err)
+		return
+	}
+	conversation, err := s.Open(ctx, hs)
+	if err != nil {
+		log.Printf("Unable to open conversation: %v", err)
+		conn.Send(ErrorFrame{Type: FrameError, Error: err.Error()})
+		return
+	}
+	participant, err := s.Participant(conversation, hs)
+	if err != nil {
+		conn.Send(ErrorFrame{Type: FrameError, Error: err.Error()})
+		return
+	}
+	if err := conn.Send(SessionFrame{Type: FrameSession, ConversationID: conversation.ID}); err != nil {
+		log.Printf("Write error: %v", err)
+		return
+	}
+	out := newOutbox(conn)
+	defer out.close()
+	sess := &session{
+		conversation: conversation,
+		participant:  participant,
+		conn:         out,
+	}
+
+	s.hub.Join(conversation.ID, out)
+	defer s.hub.Leave(conversation.ID, out)
+	s.presence.Connect(sess.participant.Role, sess.participant.ID)
+	defer s.presence.Disconnect(sess.participant.Role, sess.participant.ID)
+	s.presence.Connect(presence.KindAgent, conversation.AgentID)
+	defer s.presence.Disconnect(presence.KindAgent, conversation.AgentID)
+	defer s.presence.Unsubscribe(out)
+
+	for {
+		msgBytes, err := out.Read()
+		if err != nil {
+			log.Printf("Read error: %v", err)
+			break
+		}
+
+		var frame Frame
+		err = json.Unmarshal(msgBytes, &frame)
+		if err != nil {
+			log.Printf("Unmarshal error: %v", err)
+			continue
+		}
+		s.presence.Touch(sess.participant.Role, sess.participant.ID)
+		s.presence.Touch(presence.KindAgent, conversation.AgentID)
+
+		if err := s.handleFrame(ctx, sess, frame); err != nil {
+			log.Printf("Unable to handle %q frame: %v", frame.Type, err)
+			if err := out.Send(ErrorFrame{Type: FrameError, Error: err.Error()}); err != nil {
+				log.Printf("Write error: %v", err)
+				break
+			}
+		}
+	}
+}
+
+func (s *Service) handleFrame(ctx context.Context, sess *session, frame Frame) error {
+	conversation, participant := sess.conversation, sess.participant
+	switch frame.Type {
+	case "", FrameMessage:
+		message, err := s.Post(ctx, conversation, participant, frame.Message, sess.conn)
+		if err != nil {
+			return err
+		}
+		if err := sess.conn.Send(NewAck(frame.ID, message)); err != nil {
+			return err
+		}
+		// operators answer themselves
+		if participant.Role == models.RoleOperator {
+			return nil
+		}
+		_, err = s.RequestReply(ctx, message)
+		return err
+	case FrameRead:
+		_, err := s.MarkRead(ctx, conversation.ID, participant, frame.MessageID, sess.conn)
+		return err
+	case FrameEdit:
+		message, err := s.Edit(ctx, conversation.ID, frame.MessageID, participant, frame.Text)
+		if err != nil || !frame.Regenerate {
+			return err
+		}
+		_, err = s.RequestReply(ctx, message)
+		return err
+	case FrameDelete:
+		return s.Delete(ctx, conversation.ID, frame.MessageID, participant)
+	case FrameRegenerate:
+		_, err := s.Regenerate(ctx, conversation.ID, frame.MessageID)
+		return err
+	case FrameFeedback:
+		feedback, err := s.Rate(ctx, conversation.ID, frame.MessageID, participant.ID, frame.Rating)
+		if err != nil {
+			return err
+		}
+		return sess.conn.Send(FeedbackSavedFrame{
+			Type:       FrameFeedbackSaved,
+			MessageID:  feedback.MessageID,
+			FeedbackID: feedback.ID,
+			Rating:     feedback.Rating,
+		})
+	case FramePresence:
+		if !s.presence.SetStatus(participant.Role, participant.ID, frame.Status) {
+			return fmt.Errorf("status must be online or away")
+		}
+		return nil
+	case FramePresenceSubscribe:
+		s.presence.Subscribe(sess.conn)
+		return sess.conn.Send(PresenceSnapshotFrame{Type: FramePresenceSnapshot, Entries: s.presence.List("")})
+	case FramePresenceUnsubscribe:
+		s.presence.Unsubscribe(sess.conn)
+		return nil
+	}
+	return fmt.Errorf("unknown frame type %q", frame.Type)
+}
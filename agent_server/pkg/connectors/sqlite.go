@@ -29,17 +29,26 @@ func NewSqliteConnector(config *configs.DBConfig) SqliteConnector {
 }
 
 func (sql *sqliteConnector) Connect(ctx context.Context) error {
-	db, err := gorm.Open(sqlite.Open("agentchat.db"), &gorm.Config{
+	path := sql.cfg.Path
+	if path == "" {
+		path = "agentchat.db"
+	}
+	// WAL lets readers run alongside the writer, writers wait for each
+	// other instead of failing with "database is locked", and transactions
+	// take the write lock up front so two of them cannot deadlock upgrading
+	// their read locks
+	dsn := path + "?_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Info),
 	})
 	if err != nil {
-		fmt.Errorf("Failed to open sqlite connection %s.", err)
+		fmt.Printf("Failed to open sqlite connection %s.\n", err)
 		return err
 	}
 
 	sqlDB, err := db.DB()
 	if err != nil {
-		fmt.Errorf("Failed to create sqlite client connection pool %s.", err)
+		fmt.Printf("Failed to create sqlite client connection pool %s.\n", err)
 		return err
 	}
 
@@ -59,7 +68,7 @@ func (sql *sqliteConnector) Disconnect(ctx context.Context) error {
 	fmt.Print("Disconnecting with postgres client.")
 	db, err := sql.db.DB()
 	if err != nil {
-		fmt.Errorf("disconnecting with postgres client %s.", err)
+		fmt.Printf("disconnecting with postgres client %s.\n", err)
 		return err
 	}
 	err = db.Close()
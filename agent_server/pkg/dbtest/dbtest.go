@@ -0,0 +1,32 @@
+// Package dbtest opens migrated sqlite databases for tests.
+package dbtest
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/sdutt/agentserver/configs"
+	"github.com/sdutt/agentserver/pkg/connectors"
+	"github.com/sdutt/agentserver/repository"
+)
+
+// Open migrates a fresh database in a temporary directory of t. It is
+// closed when the test ends.
+func Open(t testing.TB) connectors.SqliteConnector {
+	t.Helper()
+	ctx := context.Background()
+	db := connectors.NewSqliteConnector(&configs.DBConfig{
+		Path:               filepath.Join(t.TempDir(), "agentchat.db"),
+		MaxIdealConnection: 10,
+		MaxOpenConnection:  10,
+	})
+	if err := db.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Disconnect(ctx) })
+	if err := repository.Migrate(ctx, db, true); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
@@ -0,0 +1,150 @@
+package export
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sdutt/agentserver/configs"
+	models "github.com/sdutt/agentserver/models/chat"
+	jobmodels "github.com/sdutt/agentserver/models/jobs"
+	"github.com/sdutt/agentserver/pkg/jobs"
+	"github.com/sdutt/agentserver/pkg/transcript"
+	"github.com/sdutt/agentserver/repository"
+)
+
+// KindExport is the job kind of queued bulk exports.
+const KindExport = "export"
+
+// Request selects the conversations started in [From, To).
+type Request struct {
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	Format   string    `json:"format"`
+	Redacted bool      `json:"redacted"`
+}
+
+func (req Request) FileName() string {
+	return fmt.Sprintf("conversations-%s-%s.zip", req.From.Format("20060102"), req.To.Format("20060102"))
+}
+
+// Archive writes a zip holding one transcript per conversation, flushing w
+// after each one when it is an http.Flusher.
+func Archive(ctx context.Context, w io.Writer, conversations repository.ConversationRepository, list []models.Conversation, req Request) error {
+	zw := zip.NewWriter(w)
+	for _, conversation := range list {
+		messages, err := conversations.ListMessages(ctx, conversation.ID)
+		if err != nil {
+			return fmt.Errorf("conversation %s: %w", conversation.ID, err)
+		}
+		entry, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     transcript.FileName(conversation.ID, req.Format),
+			Method:   zip.Deflate,
+			Modified: conversation.CreatedAt,
+		})
+		if err != nil {
+			return fmt.Errorf("conversation %s: %w", conversation.ID, err)
+		}
+		if err := transcript.Write(entry, req.Format, transcript.New(conversation, messages, req.Redacted)); err != nil {
+			return fmt.Errorf("conversation %s: %w", conversation.ID, err)
+		}
+		if flusher, ok := w.(http.Flusher); ok {
+			zw.Flush()
+			flusher.Flush()
+		}
+	}
+	return zw.Close()
+}
+
+// Exporter writes queued exports to files under the configured directory.
+type Exporter struct {
+	config        *configs.JobsConfig
+	conversations repository.ConversationRepository
+}
+
+func NewExporter(config *configs.JobsConfig, conversations repository.ConversationRepository) *Exporter {
+	return &Exporter{config, conversations}
+}
+
+// Run deletes archives older than the export TTL, and temporary files left
+// by crashed attempts, until ctx is done.
+func (e *Exporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(max(e.config.ExportTTL/24, time.Second))
+	defer ticker.Stop()
+	for {
+		e.sweep(time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (e *Exporter) sweep(now time.Time) {
+	entries, err := os.ReadDir(e.config.ExportDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Unable to list exports: %v", err)
+		}
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || info.IsDir() || now.Sub(info.ModTime()) < e.config.ExportTTL {
+			continue
+		}
+		if err := os.Remove(filepath.Join(e.config.ExportDir, entry.Name())); err != nil {
+			log.Printf("Unable to delete expired export %s: %v", entry.Name(), err)
+		}
+	}
+}
+
+// Path is where the export job id stores its archive.
+func (e *Exporter) Path(id string) string {
+	return filepath.Join(e.config.ExportDir, id+".zip")
+}
+
+// Handle runs an export job; the result is the archive path.
+func (e *Exporter) Handle(ctx context.Context, job *jobmodels.Job) (string, error) {
+	var req Request
+	if err := json.Unmarshal(job.Payload, &req); err != nil {
+		return "", jobs.Permanent(err)
+	}
+	if !transcript.ValidFormat(req.Format) {
+		return "", jobs.Permanent(fmt.Errorf("invalid format %q", req.Format))
+	}
+	list, err := e.conversations.ListConversations(ctx, req.From, req.To)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(e.config.ExportDir, 0o755); err != nil {
+		return "", err
+	}
+	// write aside and rename so a crashed attempt never leaves a partial
+	// archive at the final path
+	tmp, err := os.CreateTemp(e.config.ExportDir, job.ID+"-*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if err := Archive(ctx, tmp, e.conversations, list, req); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	path := e.Path(job.ID)
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
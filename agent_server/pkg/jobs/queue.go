@@ -0,0 +1,180 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/sdutt/agentserver/configs"
+	models "github.com/sdutt/agentserver/models/jobs"
+	"github.com/sdutt/agentserver/repository"
+)
+
+// Handler performs one attempt of a job. Returning an error retries the job
+// with backoff unless it is Permanent or the attempts are used up.
+type Handler func(ctx context.Context, job *models.Job) (result string, err error)
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying; the job is dead-lettered.
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+func IsPermanent(err error) bool {
+	var permanent permanentError
+	return errors.As(err, &permanent)
+}
+
+// Queue runs persisted jobs on a pool of workers. Jobs are stored before
+// Enqueue returns, so they survive restarts and are picked up by any
+// instance sharing the database.
+type Queue struct {
+	config   *configs.JobsConfig
+	jobs     repository.JobRepository
+	mu       sync.RWMutex
+	handlers map[string]Handler
+	wake     chan struct{}
+}
+
+func NewQueue(config *configs.JobsConfig, jobs repository.JobRepository) *Queue {
+	return &Queue{
+		config:   config,
+		jobs:     jobs,
+		handlers: make(map[string]Handler),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+func (q *Queue) Register(kind string, handler Handler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[kind] = handler
+}
+
+// Enqueue stores a job of kind with payload encoded as JSON.
+func (q *Queue) Enqueue(ctx context.Context, kind string, payload interface{}) (*models.Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	job := &models.Job{Kind: kind, Payload: data, MaxAttempts: q.config.MaxAttempts}
+	if err := q.jobs.Enqueue(ctx, job); err != nil {
+		return nil, err
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// Run processes jobs until ctx is done.
+func (q *Queue) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < q.config.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (q *Queue) work(ctx context.Context) {
+	ticker := time.NewTicker(q.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		// drain the queue before waiting again
+		for ctx.Err() == nil {
+			job, err := q.jobs.Claim(ctx, q.kinds(), q.config.VisibilityTimeout)
+			if err != nil {
+				log.Printf("Unable to claim job: %v", err)
+				break
+			}
+			if job == nil {
+				break
+			}
+			q.process(ctx, job)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-q.wake:
+		}
+	}
+}
+
+func (q *Queue) process(ctx context.Context, job *models.Job) {
+	q.mu.RLock()
+	handler := q.handlers[job.Kind]
+	q.mu.RUnlock()
+
+	runCtx, cancel := context.WithTimeout(ctx, q.config.VisibilityTimeout)
+	result, err := run(runCtx, handler, job)
+	cancel()
+
+	// the job outlives this process, so bookkeeping must too
+	saveCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	switch {
+	case err == nil:
+		err = q.jobs.Complete(saveCtx, job, result)
+	case ctx.Err() != nil:
+		log.Printf("Job %s interrupted by shutdown", job.ID)
+		err = q.jobs.Release(saveCtx, job)
+	default:
+		retryAt := time.Time{}
+		if !IsPermanent(err) && !job.LastAttempt() {
+			retryAt = time.Now().Add(q.backoff(job.Attempts))
+		}
+		log.Printf("Job %s (%s) attempt %d failed: %v", job.ID, job.Kind, job.Attempts, err)
+		err = q.jobs.Fail(saveCtx, job, err.Error(), retryAt)
+	}
+	if err != nil {
+		log.Printf("Unable to update job %s: %v", job.ID, err)
+	}
+}
+
+// run calls handler, turning a panic into a failed attempt.
+func run(ctx context.Context, handler Handler, job *models.Job) (result string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return handler(ctx, job)
+}
+
+// backoff doubles the delay with every attempt, with up to 20% jitter so
+// jobs failing together do not retry together.
+func (q *Queue) backoff(attempt int) time.Duration {
+	delay := q.config.BackoffBase
+	for i := 1; i < attempt && delay < q.config.BackoffMax; i++ {
+		delay *= 2
+	}
+	delay = min(delay, q.config.BackoffMax)
+	return delay - time.Duration(rand.Int63n(int64(delay)/5+1))
+}
+
+func (q *Queue) kinds() []string {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	kinds := make([]string, 0, len(q.handlers))
+	for kind := range q.handlers {
+		kinds = append(kinds, kind)
+	}
+	return kinds
+}
@@ -0,0 +1,148 @@
+// Package lyzrfake is a stand-in for the subset of the Lyzr v3 API the
+// server uses: agents, credentials and chat inference. State is kept in
+// memory, replies can be scripted and faults injected, so the server can
+// run offline against it, as a subcommand or an httptest.Server.
+package lyzrfake
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	clients "github.com/sdutt/agentserver/clients/lyzr"
+	models "github.com/sdutt/agentserver/models/lyzr"
+)
+
+// Server serves the fake API. The zero value is not usable; call New.
+type Server struct {
+	mu          sync.Mutex
+	apiKey      string
+	agents      map[string]*models.Agent
+	credentials map[string]*clients.CredentialResponse
+	replies     []Reply
+	faults      []*Fault
+	chats       []models.ChatPayload
+	handler     http.Handler
+}
+
+// Payload returns a valid agent payload named name, for tests that create
+// or update agents.
+func Payload(name string) models.AgentPayload {
+	topP, temperature := 0.9, 0.0
+	return models.AgentPayload{
+		Name:            name,
+		SystemPrompt:    "Be brief.",
+		LLMCredentialID: "cred",
+		ProviderID:      "OpenAI",
+		Model:           "gpt-4o-mini",
+		TopP:            &topP,
+		Temperature:     &temperature,
+		ResponseFormat:  map[string]interface{}{"type": "text"},
+	}
+}
+
+type Option func(*Server)
+
+// WithAPIKey makes every request without this x-api-key fail with 401.
+func WithAPIKey(key string) Option {
+	return func(s *Server) {
+		s.apiKey = key
+	}
+}
+
+// WithReplies scripts the chat replies, see Reply.
+func WithReplies(replies ...Reply) Option {
+	return func(s *Server) {
+		s.replies = append(s.replies, replies...)
+	}
+}
+
+// WithAgents seeds the agent store.
+func WithAgents(agents ...models.Agent) Option {
+	return func(s *Server) {
+		for i := range agents {
+			s.agents[agents[i].ID] = &agents[i]
+		}
+	}
+}
+
+func New(opts ...Option) *Server {
+	s := &Server{
+		agents:      map[string]*models.Agent{},
+		credentials: map[string]*clients.CredentialResponse{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v3/agents/{$}", s.createAgent)
+	mux.HandleFunc("GET /v3/agents/{$}", s.listAgents)
+	mux.HandleFunc("GET /v3/agents/{id}", s.getAgent)
+	mux.HandleFunc("PUT /v3/agents/{id}", s.updateAgent)
+	mux.HandleFunc("DELETE /v3/agents/{id}", s.deleteAgent)
+
+	mux.HandleFunc("POST /v3/tools/credentials", s.createCredential)
+	mux.HandleFunc("GET /v3/tools/credentials", s.listCredentials)
+	mux.HandleFunc("GET /v3/tools/credentials/{id}", s.getCredential)
+	mux.HandleFunc("PUT /v3/tools/credentials/{id}", s.updateCredential)
+	mux.HandleFunc("DELETE /v3/tools/credentials/{id}", s.deleteCredential)
+
+	mux.HandleFunc("POST /v3/inference/chat/{$}", s.chat)
+	mux.HandleFunc("POST /v3/inference/stream/{$}", s.stream)
+
+	// scripting at runtime, for the subcommand
+	mux.HandleFunc("GET /_fake/faults", s.listFaults)
+	mux.HandleFunc("POST /_fake/faults", s.addFault)
+	mux.HandleFunc("DELETE /_fake/faults", s.clearFaults)
+	mux.HandleFunc("POST /_fake/replies", s.addReplies)
+	mux.HandleFunc("DELETE /_fake/replies", s.clearReplies)
+	s.handler = mux
+	return s
+}
+
+// Start serves the fake on a local port until the returned server is
+// closed; point LyzrAPIURL at its URL.
+func (s *Server) Start() *httptest.Server {
+	return httptest.NewServer(s)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	isAdmin := strings.HasPrefix(r.URL.Path, "/_fake/")
+	if !isAdmin && s.apiKey != "" && r.Header.Get("x-api-key") != s.apiKey {
+		writeError(w, http.StatusUnauthorized, "Invalid API key")
+		return
+	}
+	if !isAdmin && s.injectFault(w, r) {
+		return
+	}
+	s.handler.ServeHTTP(w, r)
+}
+
+// Chats returns the chat requests received so far.
+func (s *Server) Chats() []models.ChatPayload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]models.ChatPayload(nil), s.chats...)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeError answers like Lyzr's FastAPI backend does.
+func writeError(w http.ResponseWriter, status int, detail string) {
+	writeJSON(w, status, map[string]string{"detail": detail})
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, out interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(out); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, "Invalid JSON: "+err.Error())
+		return false
+	}
+	return true
+}
@@ -0,0 +1,126 @@
+package lyzrfake_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	clients "github.com/sdutt/agentserver/clients/lyzr"
+	"github.com/sdutt/agentserver/configs"
+	models "github.com/sdutt/agentserver/models/lyzr"
+	"github.com/sdutt/agentserver/pkg/lyzrfake"
+)
+
+const apiKey = "test-key"
+
+// newClient starts fake and returns a client pointed at it.
+func newClient(t *testing.T, fake *lyzrfake.Server, key string) *clients.LyzrClient {
+	t.Helper()
+	server := fake.Start()
+	t.Cleanup(server.Close)
+	return clients.NewLyzrClient(&configs.AppConfig{
+		LyzrAPIURL:  server.URL,
+		LyzrAPIKey:  key,
+		LyzrBreaker: configs.BreakerConfig{Window: time.Minute, MinRequests: 100, FailureRate: 1, OpenFor: time.Minute, HalfOpenProbes: 1},
+		LyzrTimeout: configs.LyzrTimeoutConfig{Default: 5 * time.Second, Chat: 5 * time.Second},
+	})
+}
+
+func TestAgentsRoundTrip(t *testing.T) {
+	client := newClient(t, lyzrfake.New(lyzrfake.WithAPIKey(apiKey)), apiKey)
+	ctx := context.Background()
+
+	created, err := client.CreateAgent(ctx, lyzrfake.Payload("Support"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.UpdateAgent(ctx, created.AgentId, lyzrfake.Payload("Sales")); err != nil {
+		t.Fatal(err)
+	}
+	agent, err := client.GetAgent(ctx, created.AgentId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if agent.Name != "Sales" || agent.AgentInstructions == nil || *agent.AgentInstructions != "Be brief." || agent.Temperature != 0 || agent.TopP != 0.9 {
+		t.Errorf("got %+v", agent)
+	}
+	agents, err := client.ListAgents(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(agents) != 1 || agents[0].ID != created.AgentId {
+		t.Errorf("got %+v, want the created agent", agents)
+	}
+
+	if err := client.DeleteAgent(ctx, created.AgentId); err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.GetAgent(ctx, created.AgentId)
+	var apiErr *clients.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("got %v, want a 404", err)
+	}
+}
+
+func TestRejectsOtherAPIKeys(t *testing.T) {
+	client := newClient(t, lyzrfake.New(lyzrfake.WithAPIKey(apiKey)), "wrong-key")
+
+	_, err := client.ListAgents(context.Background())
+	var apiErr *clients.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("got %v, want a 401", err)
+	}
+}
+
+func TestStreamKeepsLineBreaks(t *testing.T) {
+	reply := "Two steps:\n1. restart\n2. retry"
+	fake := lyzrfake.New(
+		lyzrfake.WithAgents(models.Agent{ID: "a1", Name: "Support"}),
+		lyzrfake.WithReplies(lyzrfake.Reply{AgentID: "a1", Response: reply}),
+	)
+	client := newClient(t, fake, apiKey)
+
+	var deltas []string
+	resp, err := client.Stream(context.Background(), models.ChatPayload{AgentID: "a1", UserID: "u1", SessionID: "s1", Message: "It broke"}, func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Response != reply || strings.Join(deltas, "") != reply {
+		t.Errorf("got reply %q from deltas %q, want %q", resp.Response, deltas, reply)
+	}
+	if len(deltas) != 4 {
+		t.Errorf("got %d deltas, want one per word", len(deltas))
+	}
+	if chats := fake.Chats(); len(chats) != 1 || chats[0].Message != "It broke" {
+		t.Errorf("got chats %+v", chats)
+	}
+}
+
+func TestFaultsAreRetried(t *testing.T) {
+	fake := lyzrfake.New(
+		lyzrfake.WithAgents(models.Agent{ID: "a1", Name: "Support"}),
+		lyzrfake.WithFaults(lyzrfake.Fault{Method: http.MethodGet, Path: "/v3/agents/", Status: http.StatusServiceUnavailable, RetryAfter: "0", Times: 1}),
+	)
+	client := newClient(t, fake, apiKey)
+
+	agents, err := client.ListAgents(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(agents) != 1 {
+		t.Errorf("got %d agents, want 1", len(agents))
+	}
+
+	fake.AddFault(lyzrfake.Fault{Path: "/v3/inference/", Status: http.StatusBadRequest, Body: "bad message"})
+	_, err = client.Chat(context.Background(), models.ChatPayload{AgentID: "a1", Message: "Hi"})
+	var apiErr *clients.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("got %v, want the injected 400", err)
+	}
+}
@@ -0,0 +1,209 @@
+package lyzrfake
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	clients "github.com/sdutt/agentserver/clients/lyzr"
+	models "github.com/sdutt/agentserver/models/lyzr"
+	"github.com/sdutt/agentserver/pkg/ids"
+)
+
+// newObjectID returns an id shaped like the Mongo ids Lyzr hands out.
+func newObjectID() string {
+	return ids.New()[:24]
+}
+
+func now() string {
+	return time.Now().UTC().Format("2006-01-02T15:04:05.000000")
+}
+
+// applyPayload stores payload the way Lyzr echoes agents back: the system
+// prompt becomes the agent instructions.
+func applyPayload(agent *models.Agent, payload models.AgentPayload) {
+	agent.Name = payload.Name
+	agent.Description = payload.Description
+	instructions := payload.SystemPrompt
+	agent.AgentInstructions = &instructions
+	agent.Features = agent.Features[:0]
+	for _, feature := range payload.Features {
+		agent.Features = append(agent.Features, feature)
+	}
+	agent.Tools = agent.Tools[:0]
+	for _, tool := range payload.Tools {
+		agent.Tools = append(agent.Tools, tool)
+	}
+	agent.LLM_CredentialID = payload.LLMCredentialID
+	agent.ProviderID = payload.ProviderID
+	agent.Model = payload.Model
+	agent.TopP = payload.GetTopP()
+	agent.Temperature = payload.GetTemperature()
+	agent.ResponseFormat = payload.ResponseFormat
+	agent.UpdatedAt = now()
+}
+
+func (s *Server) createAgent(w http.ResponseWriter, r *http.Request) {
+	var payload models.AgentPayload
+	if !readJSON(w, r, &payload) {
+		return
+	}
+	if err := payload.Validate(); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	agent := &models.Agent{ID: newObjectID(), Version: "3", CreatedAt: now(), Features: []interface{}{}, Tools: []interface{}{}}
+	applyPayload(agent, payload)
+	s.agents[agent.ID] = agent
+	writeJSON(w, http.StatusOK, map[string]string{"agent_id": agent.ID})
+}
+
+func (s *Server) listAgents(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	agents := []*models.Agent{}
+	for _, agent := range s.agents {
+		agents = append(agents, agent)
+	}
+	sort.Slice(agents, func(i, j int) bool {
+		return agents[i].CreatedAt < agents[j].CreatedAt ||
+			(agents[i].CreatedAt == agents[j].CreatedAt && agents[i].ID < agents[j].ID)
+	})
+	writeJSON(w, http.StatusOK, agents)
+}
+
+func (s *Server) getAgent(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	agent, ok := s.agents[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Agent not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, agent)
+}
+
+func (s *Server) updateAgent(w http.ResponseWriter, r *http.Request) {
+	var payload models.AgentPayload
+	if !readJSON(w, r, &payload) {
+		return
+	}
+	if err := payload.Validate(); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	agent, ok := s.agents[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Agent not found")
+		return
+	}
+	applyPayload(agent, payload)
+	writeJSON(w, http.StatusOK, map[string]string{"agent_id": agent.ID, "message": "Agent updated successfully"})
+}
+
+func (s *Server) deleteAgent(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := r.PathValue("id")
+	if _, ok := s.agents[id]; !ok {
+		writeError(w, http.StatusNotFound, "Agent not found")
+		return
+	}
+	delete(s.agents, id)
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Agent deleted successfully"})
+}
+
+// credentialBody is a credential the way Lyzr lists it.
+type credentialBody struct {
+	ID string `json:"_id"`
+	clients.CredentialResponse
+}
+
+func (s *Server) createCredential(w http.ResponseWriter, r *http.Request) {
+	var payload models.CredentialPayload
+	if !readJSON(w, r, &payload) {
+		return
+	}
+	if payload.Name == "" || payload.ProviderID == "" {
+		writeError(w, http.StatusUnprocessableEntity, "name and provider_id are required")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cred := &clients.CredentialResponse{
+		ID:          newObjectID(),
+		Name:        payload.Name,
+		ProviderID:  payload.ProviderID,
+		Type:        "tool",
+		Credentials: payload.Credentials,
+		MetaData:    payload.MetaData,
+		CreatedAt:   now(),
+		UpdatedAt:   now(),
+	}
+	s.credentials[cred.ID] = cred
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"credential_id": cred.ID,
+		"name":          cred.Name,
+		"provider_id":   cred.ProviderID,
+		"credentials":   cred.Credentials,
+		"meta_data":     cred.MetaData,
+	})
+}
+
+func (s *Server) listCredentials(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []credentialBody{}
+	for _, cred := range s.credentials {
+		out = append(out, credentialBody{cred.ID, *cred})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt < out[j].CreatedAt })
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) getCredential(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cred, ok := s.credentials[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Credential not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, credentialBody{cred.ID, *cred})
+}
+
+func (s *Server) updateCredential(w http.ResponseWriter, r *http.Request) {
+	var payload models.CredentialPayload
+	if !readJSON(w, r, &payload) {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cred, ok := s.credentials[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Credential not found")
+		return
+	}
+	cred.Name = payload.Name
+	cred.ProviderID = payload.ProviderID
+	cred.Credentials = payload.Credentials
+	cred.MetaData = payload.MetaData
+	cred.UpdatedAt = now()
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Credential updated successfully"})
+}
+
+func (s *Server) deleteCredential(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := r.PathValue("id")
+	if _, ok := s.credentials[id]; !ok {
+		writeError(w, http.StatusNotFound, "Credential not found")
+		return
+	}
+	delete(s.credentials, id)
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Credential deleted successfully"})
+}
@@ -0,0 +1,248 @@
+package lyzrfake
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	models "github.com/sdutt/agentserver/models/lyzr"
+)
+
+// Reply scripts the answer to chat messages: the first reply whose AgentID
+// and Contains match, when set, answers with Response. Times limits how
+// often a reply is used, zero meaning always. Unmatched messages are
+// echoed.
+type Reply struct {
+	AgentID  string `json:"agent_id,omitempty"`
+	Contains string `json:"contains,omitempty"`
+	Response string `json:"response"`
+	Times    int    `json:"times,omitempty"`
+}
+
+// Fault makes matching requests fail: Method and the Path prefix, when
+// set, select requests, which are answered with Status after Delay. A
+// zero Status only delays. Times limits how many requests fail, zero
+// meaning all of them until the fault is cleared.
+type Fault struct {
+	Method     string   `json:"method,omitempty"`
+	Path       string   `json:"path,omitempty"`
+	Status     int      `json:"status,omitempty"`
+	Body       string   `json:"body,omitempty"`
+	RetryAfter string   `json:"retry_after,omitempty"`
+	Delay      Duration `json:"delay,omitempty"`
+	Times      int      `json:"times,omitempty"`
+}
+
+// Duration reads "1.5s" style durations from JSON.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(text)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func WithFaults(faults ...Fault) Option {
+	return func(s *Server) {
+		for i := range faults {
+			s.faults = append(s.faults, &faults[i])
+		}
+	}
+}
+
+func (s *Server) AddFault(fault Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &fault)
+}
+
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+func (s *Server) AddReplies(replies ...Reply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replies = append(s.replies, replies...)
+}
+
+func (s *Server) ClearReplies() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replies = nil
+}
+
+// takeFault returns the first fault matching r and counts it used up.
+func (s *Server) takeFault(r *http.Request) *Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, fault := range s.faults {
+		if fault.Method != "" && !strings.EqualFold(fault.Method, r.Method) {
+			continue
+		}
+		if !strings.HasPrefix(r.URL.Path, fault.Path) {
+			continue
+		}
+		taken := *fault
+		if fault.Times > 0 {
+			if fault.Times--; fault.Times == 0 {
+				s.faults = append(s.faults[:i], s.faults[i+1:]...)
+			}
+		}
+		return &taken
+	}
+	return nil
+}
+
+// injectFault applies the fault matching r, if any, and reports whether
+// it answered the request.
+func (s *Server) injectFault(w http.ResponseWriter, r *http.Request) bool {
+	fault := s.takeFault(r)
+	if fault == nil {
+		return false
+	}
+	if fault.Delay > 0 {
+		select {
+		case <-time.After(time.Duration(fault.Delay)):
+		case <-r.Context().Done():
+			return true
+		}
+	}
+	if fault.Status == 0 {
+		return false
+	}
+	if fault.RetryAfter != "" {
+		w.Header().Set("Retry-After", fault.RetryAfter)
+	}
+	body := fault.Body
+	if body == "" {
+		body = http.StatusText(fault.Status)
+	}
+	writeError(w, fault.Status, body)
+	return true
+}
+
+// reply picks the scripted answer to payload.
+func (s *Server) reply(payload models.ChatPayload) string {
+	for i := range s.replies {
+		reply := &s.replies[i]
+		if reply.AgentID != "" && reply.AgentID != payload.AgentID {
+			continue
+		}
+		if !strings.Contains(payload.Message, reply.Contains) {
+			continue
+		}
+		response := reply.Response
+		if reply.Times > 0 {
+			if reply.Times--; reply.Times == 0 {
+				s.replies = append(s.replies[:i], s.replies[i+1:]...)
+			}
+		}
+		return response
+	}
+	return fmt.Sprintf("Echo: %s", payload.Message)
+}
+
+// answer records a chat and returns its reply, or false if the agent does
+// not exist.
+func (s *Server) answer(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var payload models.ChatPayload
+	if !readJSON(w, r, &payload) {
+		return "", false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.agents[payload.AgentID]; !ok {
+		writeError(w, http.StatusNotFound, "Agent not found")
+		return "", false
+	}
+	s.chats = append(s.chats, payload)
+	return s.reply(payload), true
+}
+
+func (s *Server) chat(w http.ResponseWriter, r *http.Request) {
+	response, ok := s.answer(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"response": response, "module_outputs": map[string]interface{}{}})
+}
+
+// stream sends the reply word by word as server-sent events.
+func (s *Server) stream(w http.ResponseWriter, r *http.Request) {
+	response, ok := s.answer(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	flusher, _ := w.(http.Flusher)
+	words := strings.SplitAfter(response, " ")
+	for _, word := range words {
+		writeEvent(w, word)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	writeEvent(w, "[DONE]")
+}
+
+// writeEvent sends data as one server-sent event. A data: line ends at the
+// first line break, so every line of data gets its own.
+func writeEvent(w io.Writer, data string) {
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(w, "data: %s\n", line)
+	}
+	fmt.Fprint(w, "\n")
+}
+
+func (s *Server) listFaults(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	faults := []*Fault{}
+	faults = append(faults, s.faults...)
+	writeJSON(w, http.StatusOK, faults)
+}
+
+func (s *Server) addFault(w http.ResponseWriter, r *http.Request) {
+	var fault Fault
+	if !readJSON(w, r, &fault) {
+		return
+	}
+	s.AddFault(fault)
+	writeJSON(w, http.StatusCreated, fault)
+}
+
+func (s *Server) clearFaults(w http.ResponseWriter, r *http.Request) {
+	s.ClearFaults()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) addReplies(w http.ResponseWriter, r *http.Request) {
+	var replies []Reply
+	if !readJSON(w, r, &replies) {
+		return
+	}
+	s.AddReplies(replies...)
+	writeJSON(w, http.StatusCreated, replies)
+}
+
+func (s *Server) clearReplies(w http.ResponseWriter, r *http.Request) {
+	s.ClearReplies()
+	w.WriteHeader(http.StatusNoContent)
+}
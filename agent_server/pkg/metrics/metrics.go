@@ -0,0 +1,236 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	models "github.com/sdutt/agentserver/models/chat"
+	"github.com/sdutt/agentserver/repository"
+)
+
+const (
+	BucketHour = "hour"
+	BucketDay  = "day"
+	BucketWeek = "week"
+
+	GroupByNone     = ""
+	GroupByModel    = "model"
+	GroupByRevision = "revision"
+
+	// GroupUnknown collects activity without a model or revision, such as
+	// conversations the agent never answered.
+	GroupUnknown = "unknown"
+
+	// MaxBuckets bounds the size of a report.
+	MaxBuckets = 1000
+)
+
+func BucketSize(bucket string) (time.Duration, error) {
+	switch bucket {
+	case BucketHour:
+		return time.Hour, nil
+	case BucketDay:
+		return 24 * time.Hour, nil
+	case BucketWeek:
+		return 7 * 24 * time.Hour, nil
+	}
+	return 0, fmt.Errorf("bucket must be one of hour, day, week")
+}
+
+func ValidGroupBy(groupBy string) bool {
+	return groupBy == GroupByNone || groupBy == GroupByModel || groupBy == GroupByRevision
+}
+
+type Latency struct {
+	Median int64 `json:"median_ms"`
+	P95    int64 `json:"p95_ms"`
+}
+
+type Feedback struct {
+	Up    int64   `json:"up"`
+	Down  int64   `json:"down"`
+	Ratio float64 `json:"ratio"`
+}
+
+type Bucket struct {
+	Start                time.Time     `json:"start"`
+	ConversationsStarted int64         `json:"conversations_started"`
+	Messages             int64         `json:"messages"`
+	Calls                int64         `json:"calls"`
+	Latency              Latency       `json:"latency"`
+	Errors               int64         `json:"errors"`
+	ErrorRate            float64       `json:"error_rate"`
+	StatusCodes          map[int]int64 `json:"status_codes"`
+	Escalations          int64         `json:"escalations"`
+	EscalationRate       float64       `json:"escalation_rate"`
+	Feedback             Feedback      `json:"feedback"`
+	PromptTokens         int64         `json:"prompt_tokens"`
+	CompletionTokens     int64         `json:"completion_tokens"`
+	Cost                 float64       `json:"cost"`
+
+	latencies []int64
+}
+
+type Series struct {
+	Group   string    `json:"group"`
+	Buckets []*Bucket `json:"buckets"`
+}
+
+type Report struct {
+	AgentID string    `json:"agent_id"`
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	Bucket  string    `json:"bucket"`
+	GroupBy string    `json:"group_by,omitempty"`
+	Series  []*Series `json:"series"`
+}
+
+// Build folds the activity of an agent into time buckets of the given size,
+// one series per model or agent revision when groupBy is set. Conversation
+// level numbers are attributed to the group of the conversation's first
+// agent call, or to GroupUnknown when it has none.
+func Build(agentID string, activity *repository.AgentActivity, from, to time.Time, bucket string, groupBy string) (*Report, error) {
+	size, err := BucketSize(bucket)
+	if err != nil {
+		return nil, err
+	}
+	from = from.UTC().Truncate(size)
+	to = to.UTC()
+	if n := int(math.Ceil(float64(to.Sub(from)) / float64(size))); n > MaxBuckets {
+		return nil, fmt.Errorf("window spans %d buckets, at most %d are allowed", n, MaxBuckets)
+	}
+
+	r := &report{
+		Report: Report{AgentID: agentID, From: from, To: to, Bucket: bucket, GroupBy: groupBy},
+		size:   size,
+		index:  map[string]map[time.Time]*Bucket{},
+	}
+
+	conversationGroup := map[string]string{}
+	for _, call := range activity.FirstCalls {
+		conversationGroup[call.ConversationID] = groupKey(groupBy, call.AgentModel, call.AgentRevision)
+	}
+	groupOf := func(conversationID string) string {
+		if group, ok := conversationGroup[conversationID]; ok {
+			return group
+		}
+		return groupKey(groupBy, "", "")
+	}
+	for _, call := range activity.Calls {
+		b := r.bucket(groupKey(groupBy, call.AgentModel, call.AgentRevision), call.CreatedAt)
+		b.Calls++
+		b.StatusCodes[call.StatusCode]++
+		if call.Failed() {
+			b.Errors++
+		} else {
+			b.latencies = append(b.latencies, call.LatencyMs)
+		}
+		b.PromptTokens += int64(call.PromptTokens)
+		b.CompletionTokens += int64(call.CompletionTokens)
+		b.Cost += call.Cost
+	}
+	for _, conversation := range activity.Conversations {
+		b := r.bucket(groupOf(conversation.ID), conversation.CreatedAt)
+		b.ConversationsStarted++
+		if conversation.EscalatedAt != nil {
+			b.Escalations++
+		}
+	}
+	for _, message := range activity.Messages {
+		r.bucket(groupOf(message.ConversationID), message.CreatedAt).Messages++
+	}
+	for _, feedback := range activity.Feedback {
+		b := r.bucket(groupKey(groupBy, feedback.AgentModel, feedback.AgentRevision), feedback.CreatedAt)
+		switch feedback.Rating {
+		case models.RatingUp:
+			b.Feedback.Up++
+		case models.RatingDown:
+			b.Feedback.Down++
+		}
+	}
+	return r.finish(), nil
+}
+
+type report struct {
+	Report
+	size  time.Duration
+	index map[string]map[time.Time]*Bucket
+}
+
+func (r *report) bucket(group string, at time.Time) *Bucket {
+	start := at.UTC().Truncate(r.size)
+	buckets, ok := r.index[group]
+	if !ok {
+		buckets = map[time.Time]*Bucket{}
+		r.index[group] = buckets
+	}
+	b, ok := buckets[start]
+	if !ok {
+		b = &Bucket{Start: start, StatusCodes: map[int]int64{}}
+		buckets[start] = b
+	}
+	return b
+}
+
+func (r *report) finish() *Report {
+	groups := make([]string, 0, len(r.index))
+	for group := range r.index {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	r.Series = []*Series{}
+	for _, group := range groups {
+		series := &Series{Group: group}
+		for _, b := range r.index[group] {
+			b.Latency = percentiles(b.latencies)
+			b.ErrorRate = rate(b.Errors, b.Calls)
+			b.EscalationRate = rate(b.Escalations, b.ConversationsStarted)
+			b.Feedback.Ratio = rate(b.Feedback.Up, b.Feedback.Up+b.Feedback.Down)
+			series.Buckets = append(series.Buckets, b)
+		}
+		sort.Slice(series.Buckets, func(i, j int) bool {
+			return series.Buckets[i].Start.Before(series.Buckets[j].Start)
+		})
+		r.Series = append(r.Series, series)
+	}
+	return &r.Report
+}
+
+func groupKey(groupBy, model, revision string) string {
+	var group string
+	switch groupBy {
+	case GroupByNone:
+		return ""
+	case GroupByModel:
+		group = model
+	case GroupByRevision:
+		group = revision
+	}
+	if group == "" {
+		return GroupUnknown
+	}
+	return group
+}
+
+// percentiles uses the nearest rank method.
+func percentiles(values []int64) Latency {
+	if len(values) == 0 {
+		return Latency{}
+	}
+	sorted := append([]int64(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := func(p float64) int64 {
+		i := int(math.Ceil(p*float64(len(sorted)))) - 1
+		return sorted[max(i, 0)]
+	}
+	return Latency{Median: rank(0.5), P95: rank(0.95)}
+}
+
+func rate(part, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total)
+}
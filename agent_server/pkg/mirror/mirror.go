@@ -0,0 +1,350 @@
+// Package mirror keeps a local copy of the agents of every provider, so
+// listings do not call the providers and agents can carry local metadata.
+// A reconciler brings the copy in line with the providers and reports the
+// changes made outside the app as drift.
+package mirror
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/sdutt/agentserver/configs"
+	models "github.com/sdutt/agentserver/models/agents"
+	lyzr "github.com/sdutt/agentserver/models/lyzr"
+	webhookmodels "github.com/sdutt/agentserver/models/webhooks"
+	"github.com/sdutt/agentserver/pkg/cache"
+	"github.com/sdutt/agentserver/pkg/providers"
+	"github.com/sdutt/agentserver/pkg/webhooks"
+	"github.com/sdutt/agentserver/repository"
+)
+
+// Agent is a mirrored agent as the API shows it: the provider's agent and
+// the local metadata.
+type Agent struct {
+	lyzr.Agent
+	Owner       string    `json:"owner"`
+	WorkspaceID string    `json:"workspace_id"`
+	Tags        []string  `json:"tags"`
+	SyncedAt    time.Time `json:"synced_at"`
+}
+
+// Metadata is what the app keeps about an agent beyond its provider's
+// configuration.
+type Metadata struct {
+	Owner       string   `json:"owner"`
+	WorkspaceID string   `json:"workspace_id"`
+	Tags        []string `json:"tags"`
+}
+
+type Mirror struct {
+	config    *configs.AgentSyncConfig
+	providers *providers.Registry
+	agents    repository.AgentMirrorRepository
+	webhooks  *webhooks.Dispatcher
+	// syncing lets one sync run at a time, and keeps the app's own changes
+	// to the mirror from landing in the middle of one
+	syncing sync.Mutex
+}
+
+func NewMirror(config *configs.AgentSyncConfig, registry *providers.Registry, agents repository.AgentMirrorRepository, dispatcher *webhooks.Dispatcher) *Mirror {
+	return &Mirror{config: config, providers: registry, agents: agents, webhooks: dispatcher}
+}
+
+// Run syncs right away and then every interval until ctx is done.
+func (m *Mirror) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.config.Interval)
+	defer ticker.Stop()
+	for {
+		if _, err := m.Sync(ctx, models.SyncScheduled); err != nil && ctx.Err() == nil {
+			log.Printf("Agent sync failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync reconciles the mirror with the providers and stores the report,
+// also when listing the agents failed. When only some providers failed, the
+// others are still reconciled and a *providers.ListError is returned with
+// the report. Manual syncs skip the cached agent list.
+func (m *Mirror) Sync(ctx context.Context, trigger string) (*models.AgentSync, error) {
+	if trigger == models.SyncManual {
+		ctx = cache.Refresh(ctx)
+	}
+	m.syncing.Lock()
+	defer m.syncing.Unlock()
+
+	report := &models.AgentSync{
+		Trigger:   trigger,
+		StartedAt: time.Now(),
+		Created:   []string{},
+		Updated:   []string{},
+		Deleted:   []string{},
+	}
+	workspaces := map[string]string{}
+	err := m.reconcile(ctx, report, workspaces)
+	report.FinishedAt = time.Now()
+	if err != nil {
+		report.Error = err.Error()
+	}
+	if saveErr := m.agents.SaveSync(ctx, report, m.config.KeepReports); saveErr != nil {
+		log.Printf("Unable to save agent sync report: %v", saveErr)
+	}
+	var partial *providers.ListError
+	if err != nil && !errors.As(err, &partial) {
+		return report, err
+	}
+	if report.Drifted() {
+		log.Printf("Agents changed outside the app: %d created, %d updated, %d deleted",
+			len(report.Created), len(report.Updated), len(report.Deleted))
+		m.publishDrift(ctx, report, workspaces)
+	}
+	return report, err
+}
+
+// publishDrift sends every workspace the part of the report about its
+// agents. Agents without a workspace are reported without one, which only
+// subscriptions to every workspace receive.
+func (m *Mirror) publishDrift(ctx context.Context, report *models.AgentSync, workspaces map[string]string) {
+	parts := map[string]*models.AgentSync{}
+	part := func(agentID string) *models.AgentSync {
+		workspaceID := workspaces[agentID]
+		if parts[workspaceID] == nil {
+			copied := *report
+			copied.Created, copied.Updated, copied.Deleted = []string{}, []string{}, []string{}
+			parts[workspaceID] = &copied
+		}
+		return parts[workspaceID]
+	}
+	for _, id := range report.Created {
+		p := part(id)
+		p.Created = append(p.Created, id)
+	}
+	for _, id := range report.Updated {
+		p := part(id)
+		p.Updated = append(p.Updated, id)
+	}
+	for _, id := range report.Deleted {
+		p := part(id)
+		p.Deleted = append(p.Deleted, id)
+	}
+	for workspaceID, p := range parts {
+		m.webhooks.Publish(ctx, webhookmodels.EventAgentsDrifted, workspaceID, p)
+	}
+}
+
+// reconcile fills report and records the workspace of every agent it
+// changed in workspaces.
+func (m *Mirror) reconcile(ctx context.Context, report *models.AgentSync, workspaces map[string]string) error {
+	_, err := m.agents.LastSuccessfulSync(ctx)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return err
+	}
+	report.Baseline = errors.Is(err, repository.ErrNotFound)
+
+	// the agents of a provider that could not be listed are kept as they
+	// are; the others are reconciled
+	remote, listErr := m.providers.ListAgents(ctx)
+	var partial *providers.ListError
+	if listErr != nil && !errors.As(listErr, &partial) {
+		return listErr
+	}
+	stored, err := m.agents.ListAgents(ctx, true)
+	if err != nil {
+		return err
+	}
+	local := make(map[string]*models.MirroredAgent, len(stored))
+	for i := range stored {
+		local[stored[i].ID] = &stored[i]
+	}
+
+	report.Total = len(remote)
+	seen := make(map[string]bool, len(remote))
+	for i := range remote {
+		agent, err := mirrored(&remote[i])
+		if err != nil {
+			return err
+		}
+		seen[agent.ID] = true
+		current, ok := local[agent.ID]
+		if ok {
+			workspaces[agent.ID] = current.WorkspaceID
+		}
+		switch {
+		case !ok || current.DeletedAt.Valid:
+			report.Created = append(report.Created, agent.ID)
+		case current.Hash != agent.Hash:
+			report.Updated = append(report.Updated, agent.ID)
+		case current.Model != agent.Model || current.Description != agent.Description ||
+			(!agent.CreatedAt.IsZero() && !agent.CreatedAt.Equal(current.CreatedAt)):
+			// mirrored before these columns were copied out of the data
+		default:
+			continue
+		}
+		if err := m.agents.SaveAgent(ctx, agent); err != nil {
+			return err
+		}
+	}
+	for _, agent := range stored {
+		if seen[agent.ID] || agent.DeletedAt.Valid {
+			continue
+		}
+		if partial != nil && partial.Failed[agent.Provider] != nil {
+			continue
+		}
+		report.Deleted = append(report.Deleted, agent.ID)
+		workspaces[agent.ID] = agent.WorkspaceID
+		if err := m.agents.DeleteAgent(ctx, agent.ID); err != nil {
+			return err
+		}
+	}
+	return listErr
+}
+
+// mirrored turns an agent returned by a provider into its local copy.
+func mirrored(agent *lyzr.Agent) (*models.MirroredAgent, error) {
+	data, err := json.Marshal(agent)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	return &models.MirroredAgent{
+		ID:          agent.ID,
+		Provider:    agent.Provider,
+		Name:        agent.Name,
+		Description: agent.Description,
+		Model:       agent.Model,
+		Data:        data,
+		Hash:        hex.EncodeToString(sum[:]),
+		SyncedAt:    time.Now(),
+		CreatedAt:   parseCreatedAt(agent.CreatedAt),
+	}, nil
+}
+
+// createdAtLayouts are the ways providers write creation times. Lyzr
+// leaves out the zone, which is UTC.
+var createdAtLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999", "2006-01-02 15:04:05.999999999"}
+
+// parseCreatedAt returns the zero time if value is in none of the layouts.
+func parseCreatedAt(value string) time.Time {
+	for _, layout := range createdAtLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Local()
+		}
+	}
+	return time.Time{}
+}
+
+// Page is one page of a listing of the mirror.
+type Page struct {
+	Agents []Agent
+	Total  int64
+	Next   *repository.AgentCursor
+}
+
+// Find returns a page of the mirrored agents matching filter, syncing
+// first if the mirror was never filled.
+func (m *Mirror) Find(ctx context.Context, filter repository.AgentFilter) (*Page, error) {
+	if _, err := m.agents.LastSuccessfulSync(ctx); errors.Is(err, repository.ErrNotFound) {
+		var partial *providers.ListError
+		if _, err := m.Sync(ctx, models.SyncOnDemand); err != nil && !errors.As(err, &partial) {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	found, err := m.agents.FindAgents(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	page := &Page{Agents: make([]Agent, 0, len(found.Agents)), Total: found.Total, Next: found.Next}
+	for i := range found.Agents {
+		agent, err := toAgent(&found.Agents[i])
+		if err != nil {
+			return nil, err
+		}
+		page.Agents = append(page.Agents, *agent)
+	}
+	return page, nil
+}
+
+// Refresh copies an agent the app just created or changed, so the next
+// sync does not take it for drift.
+func (m *Mirror) Refresh(ctx context.Context, agentID string) error {
+	m.syncing.Lock()
+	defer m.syncing.Unlock()
+	remote, err := m.providers.GetAgent(ctx, agentID)
+	if err != nil {
+		return err
+	}
+	agent, err := mirrored(remote)
+	if err != nil {
+		return err
+	}
+	return m.agents.SaveAgent(ctx, agent)
+}
+
+// Forget drops an agent the app just deleted.
+func (m *Mirror) Forget(ctx context.Context, agentID string) error {
+	m.syncing.Lock()
+	defer m.syncing.Unlock()
+	return m.agents.DeleteAgent(ctx, agentID)
+}
+
+// Workspace returns the workspace a mirrored agent belongs to, or "" when
+// it has none or is not mirrored.
+func (m *Mirror) Workspace(ctx context.Context, agentID string) string {
+	stored, err := m.agents.GetAgent(ctx, agentID)
+	if err != nil {
+		return ""
+	}
+	return stored.WorkspaceID
+}
+
+// SetMetadata replaces the local metadata of a mirrored agent.
+func (m *Mirror) SetMetadata(ctx context.Context, agentID string, metadata Metadata) (*Agent, error) {
+	stored, err := m.agents.GetAgent(ctx, agentID)
+	if err != nil {
+		return nil, err
+	}
+	stored.Owner = metadata.Owner
+	stored.WorkspaceID = metadata.WorkspaceID
+	stored.Tags = metadata.Tags
+	if stored.Tags == nil {
+		stored.Tags = []string{}
+	}
+	if err := m.agents.UpdateMetadata(ctx, stored); err != nil {
+		return nil, err
+	}
+	return toAgent(stored)
+}
+
+// Syncs returns the latest sync reports, newest first.
+func (m *Mirror) Syncs(ctx context.Context, limit int) ([]models.AgentSync, error) {
+	return m.agents.ListSyncs(ctx, limit)
+}
+
+func toAgent(stored *models.MirroredAgent) (*Agent, error) {
+	agent := &Agent{
+		Owner:       stored.Owner,
+		WorkspaceID: stored.WorkspaceID,
+		Tags:        stored.Tags,
+		SyncedAt:    stored.SyncedAt,
+	}
+	if agent.Tags == nil {
+		agent.Tags = []string{}
+	}
+	if err := json.Unmarshal(stored.Data, &agent.Agent); err != nil {
+		return nil, err
+	}
+	return agent, nil
+}
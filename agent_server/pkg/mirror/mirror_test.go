@@ -0,0 +1,94 @@
+package mirror_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	clients "github.com/sdutt/agentserver/clients/lyzr"
+	"github.com/sdutt/agentserver/configs"
+	models "github.com/sdutt/agentserver/models/agents"
+	lyzr "github.com/sdutt/agentserver/models/lyzr"
+	webhookmodels "github.com/sdutt/agentserver/models/webhooks"
+	"github.com/sdutt/agentserver/pkg/cache"
+	"github.com/sdutt/agentserver/pkg/dbtest"
+	"github.com/sdutt/agentserver/pkg/jobs"
+	"github.com/sdutt/agentserver/pkg/lyzrfake"
+	"github.com/sdutt/agentserver/pkg/mirror"
+	"github.com/sdutt/agentserver/pkg/providers"
+	"github.com/sdutt/agentserver/pkg/webhooks"
+	"github.com/sdutt/agentserver/repository"
+)
+
+func TestDriftReachesTheWorkspaceOwningTheAgent(t *testing.T) {
+	db := dbtest.Open(t)
+	ctx := context.Background()
+	server := lyzrfake.New(lyzrfake.WithAgents(lyzr.Agent{ID: "a1", Name: "Billing"}, lyzr.Agent{ID: "a2", Name: "Sales"})).Start()
+	defer server.Close()
+	client := clients.NewLyzrClient(&configs.AppConfig{
+		LyzrAPIURL:  server.URL,
+		LyzrBreaker: configs.BreakerConfig{Window: time.Minute, MinRequests: 100, FailureRate: 1, OpenFor: time.Minute, HalfOpenProbes: 1},
+		LyzrTimeout: configs.LyzrTimeoutConfig{Default: 5 * time.Second, Chat: 5 * time.Second},
+	})
+	registry := providers.NewRegistry(providers.Lyzr(client), repository.NewLocalAgentRepository(db), cache.NewLoader(cache.NewMemoryCache(16)), &configs.CacheConfig{AgentsTTL: time.Minute})
+	webhookRepo := repository.NewWebhookRepository(db)
+	dispatcher := webhooks.NewDispatcher(&configs.WebhooksConfig{Timeout: time.Second}, webhookRepo, jobs.NewQueue(&configs.JobsConfig{MaxAttempts: 1}, repository.NewJobRepository(db)))
+	m := mirror.NewMirror(&configs.AgentSyncConfig{Interval: time.Hour, KeepReports: 10}, registry, repository.NewAgentMirrorRepository(db), dispatcher)
+
+	subscriptions := map[string]*webhookmodels.Subscription{}
+	for _, workspaceID := range []string{"w1", "w2", ""} {
+		sub := &webhookmodels.Subscription{WorkspaceID: workspaceID, URL: "https://hooks.example.test/" + workspaceID, Active: true}
+		if err := webhookRepo.CreateSubscription(ctx, sub); err != nil {
+			t.Fatal(err)
+		}
+		subscriptions[workspaceID] = sub
+	}
+
+	if _, err := m.Sync(ctx, models.SyncManual); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.SetMetadata(ctx, "a1", mirror.Metadata{WorkspaceID: "w1"}); err != nil {
+		t.Fatal(err)
+	}
+	// both agents change behind the app's back
+	for _, id := range []string{"a1", "a2"} {
+		if _, err := client.UpdateAgent(ctx, id, lyzrfake.Payload("Renamed")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	report, err := m.Sync(ctx, models.SyncManual)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Updated) != 2 {
+		t.Fatalf("got %+v, want both agents updated", report)
+	}
+
+	drifted := func(workspaceID string) [][]string {
+		deliveries, _, err := webhookRepo.ListDeliveries(ctx, subscriptions[workspaceID].ID, 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out [][]string
+		for _, delivery := range deliveries {
+			var event struct {
+				Data models.AgentSync `json:"data"`
+			}
+			if err := json.Unmarshal(delivery.Payload, &event); err != nil {
+				t.Fatal(err)
+			}
+			out = append(out, event.Data.Updated)
+		}
+		return out
+	}
+	if got := drifted("w1"); len(got) != 1 || len(got[0]) != 1 || got[0][0] != "a1" {
+		t.Errorf("w1 got %v, want a1 only", got)
+	}
+	if got := drifted("w2"); len(got) != 0 {
+		t.Errorf("w2 got %v, want nothing", got)
+	}
+	if got := drifted(""); len(got) != 2 {
+		t.Errorf("the global subscription got %v, want both parts", got)
+	}
+}
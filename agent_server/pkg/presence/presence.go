@@ -0,0 +1,390 @@
+package presence
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sdutt/agentserver/pkg/broker"
+	"github.com/sdutt/agentserver/pkg/ids"
+)
+
+const (
+	KindUser     = "user"
+	KindOperator = "operator"
+	KindAgent    = "agent"
+
+	StatusOnline  = "online"
+	StatusAway    = "away"
+	StatusOffline = "offline"
+
+	FramePresence = "presence"
+
+	// topic carries presence updates between instances.
+	topic = "presence"
+)
+
+// Subscriber receives presence change frames. Chat clients satisfy it; Send
+// should give up on a client that stops reading instead of blocking.
+type Subscriber interface {
+	Send(frame interface{}) error
+}
+
+type Entry struct {
+	Kind        string    `json:"kind"`
+	ID          string    `json:"id"`
+	Status      string    `json:"status"`
+	LastSeen    time.Time `json:"last_seen"`
+	Connections int       `json:"connections"`
+	// Manual is set while the participant chose to appear away.
+	manual bool
+}
+
+type ChangeFrame struct {
+	Type string `json:"type"`
+	Entry
+}
+
+type key struct {
+	kind string
+	id   string
+}
+
+// instance is what another server instance last reported.
+type instance struct {
+	seen    time.Time
+	entries map[key]Entry
+}
+
+// update is the broker message sharing an instance's entries. A full update
+// replaces everything the instance reported before.
+type update struct {
+	Origin  string  `json:"origin"`
+	Full    bool    `json:"full,omitempty"`
+	Entries []Entry `json:"entries"`
+}
+
+// Tracker keeps the presence of everyone with a chat connection. A
+// participant is online while at least one of its connections is open and
+// active, away after AwayAfter without activity or when it says so, and
+// offline once the last connection closes.
+//
+// Each instance tracks its own connections and shares them on the broker;
+// List and the change frames merge what every instance reported. Offline
+// participants are forgotten after the retention period.
+type Tracker struct {
+	id          string
+	awayAfter   time.Duration
+	retention   time.Duration
+	broker      broker.Broker
+	mu          sync.Mutex
+	entries     map[key]*Entry
+	remote      map[string]*instance
+	subscribers map[Subscriber]struct{}
+}
+
+func NewTracker(awayAfter, retention time.Duration, b broker.Broker) *Tracker {
+	return &Tracker{
+		id:          ids.New(),
+		awayAfter:   awayAfter,
+		retention:   retention,
+		broker:      b,
+		entries:     make(map[key]*Entry),
+		remote:      make(map[string]*instance),
+		subscribers: make(map[Subscriber]struct{}),
+	}
+}
+
+func (t *Tracker) Connect(kind, id string) {
+	t.update(kind, id, func(e *Entry) {
+		e.Connections++
+		if !e.manual {
+			e.Status = StatusOnline
+		}
+	})
+}
+
+func (t *Tracker) Disconnect(kind, id string) {
+	t.update(kind, id, func(e *Entry) {
+		e.Connections = max(e.Connections-1, 0)
+		if e.Connections == 0 {
+			e.Status = StatusOffline
+			e.manual = false
+		}
+	})
+}
+
+// Touch records activity, bringing an idle participant back online.
+func (t *Tracker) Touch(kind, id string) {
+	t.update(kind, id, func(e *Entry) {
+		if e.Connections > 0 && !e.manual {
+			e.Status = StatusOnline
+		}
+	})
+}
+
+// SetStatus applies a status chosen by the participant: away sticks until
+// it reports online again.
+func (t *Tracker) SetStatus(kind, id, status string) bool {
+	if status != StatusOnline && status != StatusAway {
+		return false
+	}
+	t.update(kind, id, func(e *Entry) {
+		if e.Connections == 0 {
+			return
+		}
+		e.manual = status == StatusAway
+		e.Status = status
+	})
+	return true
+}
+
+func (t *Tracker) Subscribe(s Subscriber) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.subscribers[s] = struct{}{}
+}
+
+func (t *Tracker) Unsubscribe(s Subscriber) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.subscribers, s)
+}
+
+// List returns the entries of the given kind, or of every kind when kind is
+// empty, ordered by kind and id.
+func (t *Tracker) List(kind string) []Entry {
+	t.mu.Lock()
+	keys := map[key]struct{}{}
+	for k := range t.entries {
+		keys[k] = struct{}{}
+	}
+	for _, inst := range t.remote {
+		for k := range inst.entries {
+			keys[k] = struct{}{}
+		}
+	}
+	entries := make([]Entry, 0, len(keys))
+	for k := range keys {
+		if kind == "" || k.kind == kind {
+			entry, _ := t.merged(k)
+			entries = append(entries, entry)
+		}
+	}
+	t.mu.Unlock()
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Kind != entries[j].Kind {
+			return entries[i].Kind < entries[j].Kind
+		}
+		return entries[i].ID < entries[j].ID
+	})
+	return entries
+}
+
+// Run shares presence with the other instances, marks idle participants
+// away and forgets offline ones until ctx is done.
+func (t *Tracker) Run(ctx context.Context) {
+	cancel, err := t.broker.Subscribe(topic, t.receive)
+	if err != nil {
+		log.Printf("Unable to subscribe to presence updates: %v", err)
+	} else {
+		defer cancel()
+	}
+	interval := max(t.awayAfter/4, time.Second)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			t.sweep(now, 3*interval)
+		}
+	}
+}
+
+// sweep runs once per interval. Instances silent for longer than expiry are
+// assumed gone along with their connections.
+func (t *Tracker) sweep(now time.Time, expiry time.Duration) {
+	t.mu.Lock()
+	affected := map[key]Entry{}
+	for k, e := range t.entries {
+		switch {
+		case e.Status == StatusOnline && now.Sub(e.LastSeen) >= t.awayAfter:
+			affected[k], _ = t.merged(k)
+			e.Status = StatusAway
+		case e.Connections == 0 && now.Sub(e.LastSeen) >= t.retention:
+			delete(t.entries, k)
+		}
+	}
+	for origin, inst := range t.remote {
+		if now.Sub(inst.seen) >= expiry {
+			for k := range inst.entries {
+				affected[k], _ = t.merged(k)
+			}
+			delete(t.remote, origin)
+		}
+	}
+	snapshot := update{Origin: t.id, Full: true, Entries: make([]Entry, 0, len(t.entries))}
+	for _, e := range t.entries {
+		snapshot.Entries = append(snapshot.Entries, *e)
+	}
+	changed := t.changed(affected)
+	subscribers := t.subscriberList()
+	t.mu.Unlock()
+	t.publish(snapshot)
+	t.notify(subscribers, changed)
+}
+
+func (t *Tracker) update(kind, id string, change func(e *Entry)) {
+	if id == "" {
+		return
+	}
+	t.mu.Lock()
+	k := key{kind, id}
+	e, ok := t.entries[k]
+	if !ok {
+		e = &Entry{Kind: kind, ID: id, Status: StatusOffline}
+		t.entries[k] = e
+	}
+	before, _ := t.merged(k)
+	local := *e
+	change(e)
+	e.LastSeen = time.Now()
+	changed := t.changed(map[key]Entry{k: before})
+	var subscribers []Subscriber
+	if len(changed) > 0 {
+		subscribers = t.subscriberList()
+	}
+	shared := e.Status != local.Status || e.Connections != local.Connections
+	entry := *e
+	t.mu.Unlock()
+	if shared {
+		t.publish(update{Origin: t.id, Entries: []Entry{entry}})
+	}
+	t.notify(subscribers, changed)
+}
+
+// receive applies an update of another instance.
+func (t *Tracker) receive(payload []byte) {
+	var u update
+	if err := json.Unmarshal(payload, &u); err != nil {
+		log.Printf("Invalid presence update: %v", err)
+		return
+	}
+	if u.Origin == t.id {
+		return
+	}
+	t.mu.Lock()
+	inst, ok := t.remote[u.Origin]
+	if !ok {
+		inst = &instance{entries: map[key]Entry{}}
+		t.remote[u.Origin] = inst
+	}
+	inst.seen = time.Now()
+	affected := map[key]Entry{}
+	if u.Full {
+		for k := range inst.entries {
+			affected[k], _ = t.merged(k)
+		}
+	}
+	for _, e := range u.Entries {
+		k := key{e.Kind, e.ID}
+		if _, ok := affected[k]; !ok {
+			affected[k], _ = t.merged(k)
+		}
+	}
+	if u.Full {
+		inst.entries = map[key]Entry{}
+	}
+	for _, e := range u.Entries {
+		inst.entries[key{e.Kind, e.ID}] = e
+	}
+	changed := t.changed(affected)
+	subscribers := t.subscriberList()
+	t.mu.Unlock()
+	t.notify(subscribers, changed)
+}
+
+// merged combines what every instance knows of k: the best status, the
+// latest activity and the sum of connections.
+func (t *Tracker) merged(k key) (Entry, bool) {
+	entry := Entry{Kind: k.kind, ID: k.id, Status: StatusOffline}
+	found := false
+	add := func(e Entry) {
+		found = true
+		if rank(e.Status) > rank(entry.Status) {
+			entry.Status = e.Status
+		}
+		if e.LastSeen.After(entry.LastSeen) {
+			entry.LastSeen = e.LastSeen
+		}
+		entry.Connections += e.Connections
+	}
+	if e, ok := t.entries[k]; ok {
+		add(*e)
+	}
+	for _, inst := range t.remote {
+		if e, ok := inst.entries[k]; ok {
+			add(e)
+		}
+	}
+	return entry, found
+}
+
+// changed returns the merged entries whose status differs from before.
+func (t *Tracker) changed(before map[key]Entry) []Entry {
+	var changed []Entry
+	for k, b := range before {
+		if after, _ := t.merged(k); after.Status != b.Status {
+			changed = append(changed, after)
+		}
+	}
+	return changed
+}
+
+func rank(status string) int {
+	switch status {
+	case StatusOnline:
+		return 2
+	case StatusAway:
+		return 1
+	}
+	return 0
+}
+
+func (t *Tracker) publish(u update) {
+	payload, err := json.Marshal(u)
+	if err != nil {
+		log.Printf("Unable to encode presence update: %v", err)
+		return
+	}
+	if err := t.broker.Publish(context.Background(), topic, payload); err != nil {
+		log.Printf("Publish of presence update failed: %v", err)
+	}
+}
+
+func (t *Tracker) subscriberList() []Subscriber {
+	subscribers := make([]Subscriber, 0, len(t.subscribers))
+	for s := range t.subscribers {
+		subscribers = append(subscribers, s)
+	}
+	return subscribers
+}
+
+// notify sends the changes to the subscribers. A subscriber that cannot be
+// written to is dropped rather than retried on every change.
+func (t *Tracker) notify(subscribers []Subscriber, entries []Entry) {
+	for _, s := range subscribers {
+		for _, entry := range entries {
+			if err := s.Send(ChangeFrame{Type: FramePresence, Entry: entry}); err != nil {
+				log.Printf("Presence update to subscriber failed: %v", err)
+				t.Unsubscribe(s)
+				break
+			}
+		}
+	}
+}
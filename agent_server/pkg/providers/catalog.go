@@ -0,0 +1,49 @@
+package providers
+
+import (
+	"context"
+
+	"github.com/sdutt/agentserver/pkg/cache"
+)
+
+const catalogTag = "catalog"
+
+// modelLister is implemented by providers that can tell which models they
+// offer.
+type modelLister interface {
+	ListModels(ctx context.Context, opts ...CallOption) ([]string, error)
+}
+
+var _ modelLister = (*openaiProvider)(nil)
+
+// Catalog describes a provider agents can be created on. Models is empty
+// for providers that do not list their models; Error is set when listing
+// them failed.
+type Catalog struct {
+	Name    string   `json:"name"`
+	Default bool     `json:"default"`
+	Models  []string `json:"models"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// Catalog describes every provider, the default one first. Model lists are
+// cached per provider.
+func (r *Registry) Catalog(ctx context.Context) []Catalog {
+	names := r.names()
+	out := make([]Catalog, 0, len(names))
+	for _, name := range names {
+		catalog := Catalog{Name: name, Default: name == r.fallback.Name(), Models: []string{}}
+		if lister, ok := r.providers[name].(modelLister); ok {
+			models, err := cache.Load(ctx, r.cache, "catalog:"+name, r.config.CatalogTTL, []string{catalogTag}, func(ctx context.Context) ([]string, error) {
+				return lister.ListModels(ctx)
+			})
+			if err != nil {
+				catalog.Error = err.Error()
+			} else {
+				catalog.Models = models
+			}
+		}
+		out = append(out, catalog)
+	}
+	return out
+}
@@ -0,0 +1,122 @@
+package providers
+
+import (
+	"context"
+	"errors"
+
+	clients "github.com/sdutt/agentserver/clients/lyzr"
+	"github.com/sdutt/agentserver/clients/openai"
+	models "github.com/sdutt/agentserver/models/lyzr"
+)
+
+// client is what the HTTP clients of the providers have in common. They
+// share the Lyzr client's call machinery, so they take its call options
+// and fail with its errors.
+type client interface {
+	Name() string
+	BreakerStatus() clients.BreakerStatus
+	CreateAgent(ctx context.Context, payload models.AgentPayload, opts ...clients.CallOption) (*models.AgentResponse, error)
+	ListAgents(ctx context.Context, opts ...clients.CallOption) ([]models.Agent, error)
+	GetAgent(ctx context.Context, agentID string, opts ...clients.CallOption) (*models.Agent, error)
+	UpdateAgent(ctx context.Context, agentID string, payload models.AgentPayload, opts ...clients.CallOption) (*models.AgentResponse, error)
+	DeleteAgent(ctx context.Context, agentID string, opts ...clients.CallOption) error
+	Chat(ctx context.Context, payload models.ChatPayload, opts ...clients.CallOption) (*models.ChatResponse, error)
+	Stream(ctx context.Context, payload models.ChatPayload, onDelta func(delta string) error, opts ...clients.CallOption) (*models.ChatResponse, error)
+}
+
+var (
+	_ client = (*clients.LyzrClient)(nil)
+	_ client = (*openai.Client)(nil)
+)
+
+// clientProvider adapts a client to AgentProvider, translating call
+// options and errors.
+type clientProvider struct {
+	client client
+}
+
+// Lyzr runs agents on the Lyzr agent API.
+func Lyzr(client *clients.LyzrClient) AgentProvider {
+	return &clientProvider{client: client}
+}
+
+// openaiProvider also lists the models of the server.
+type openaiProvider struct {
+	clientProvider
+	lister *openai.Client
+}
+
+// OpenAI runs agents against an OpenAI-compatible chat completions API.
+func OpenAI(client *openai.Client) AgentProvider {
+	return &openaiProvider{clientProvider: clientProvider{client: client}, lister: client}
+}
+
+func (p *openaiProvider) ListModels(ctx context.Context, opts ...CallOption) ([]string, error) {
+	names, err := p.lister.ListModels(ctx, p.options(opts)...)
+	return names, p.translate(err)
+}
+
+func (p *clientProvider) Name() string {
+	return p.client.Name()
+}
+
+func (p *clientProvider) BreakerStatus() clients.BreakerStatus {
+	return p.client.BreakerStatus()
+}
+
+func (p *clientProvider) CreateAgent(ctx context.Context, payload models.AgentPayload, opts ...CallOption) (*models.AgentResponse, error) {
+	resp, err := p.client.CreateAgent(ctx, payload, p.options(opts)...)
+	return resp, p.translate(err)
+}
+
+func (p *clientProvider) ListAgents(ctx context.Context, opts ...CallOption) ([]models.Agent, error) {
+	agents, err := p.client.ListAgents(ctx, p.options(opts)...)
+	return agents, p.translate(err)
+}
+
+func (p *clientProvider) GetAgent(ctx context.Context, agentID string, opts ...CallOption) (*models.Agent, error) {
+	agent, err := p.client.GetAgent(ctx, agentID, p.options(opts)...)
+	return agent, p.translate(err)
+}
+
+func (p *clientProvider) UpdateAgent(ctx context.Context, agentID string, payload models.AgentPayload, opts ...CallOption) (*models.AgentResponse, error) {
+	resp, err := p.client.UpdateAgent(ctx, agentID, payload, p.options(opts)...)
+	return resp, p.translate(err)
+}
+
+func (p *clientProvider) DeleteAgent(ctx context.Context, agentID string, opts ...CallOption) error {
+	return p.translate(p.client.DeleteAgent(ctx, agentID, p.options(opts)...))
+}
+
+func (p *clientProvider) Chat(ctx context.Context, payload models.ChatPayload, opts ...CallOption) (*models.ChatResponse, error) {
+	resp, err := p.client.Chat(ctx, payload, p.options(opts)...)
+	return resp, p.translate(err)
+}
+
+func (p *clientProvider) Stream(ctx context.Context, payload models.ChatPayload, onDelta func(delta string) error, opts ...CallOption) (*models.ChatResponse, error) {
+	resp, err := p.client.Stream(ctx, payload, onDelta, p.options(opts)...)
+	return resp, p.translate(err)
+}
+
+func (p *clientProvider) options(opts []CallOption) []clients.CallOption {
+	options := newCallOptions(opts)
+	var out []clients.CallOption
+	if options.idempotencyKey != "" {
+		out = append(out, clients.WithIdempotencyKey(options.idempotencyKey))
+	}
+	return out
+}
+
+// translate turns the errors of the clients into provider errors. Other
+// errors, such as network failures, pass through.
+func (p *clientProvider) translate(err error) error {
+	var apiErr *clients.APIError
+	if errors.As(err, &apiErr) {
+		return &Error{StatusCode: apiErr.StatusCode, Message: apiErr.Message}
+	}
+	var unavailable *clients.UpstreamUnavailableError
+	if errors.As(err, &unavailable) {
+		return &UnavailableError{Provider: p.client.Name(), RetryIn: unavailable.RetryIn}
+	}
+	return err
+}
@@ -0,0 +1,300 @@
+// Package providers routes agent calls to the backend each agent runs on.
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	clients "github.com/sdutt/agentserver/clients/lyzr"
+	"github.com/sdutt/agentserver/configs"
+	models "github.com/sdutt/agentserver/models/lyzr"
+	"github.com/sdutt/agentserver/pkg/cache"
+	"github.com/sdutt/agentserver/repository"
+)
+
+// AgentProvider is a backend that stores agents and answers chats with
+// them. Providers fail with *Error when the backend refuses a call and with
+// *UnavailableError while it is known to be down.
+type AgentProvider interface {
+	Name() string
+	CreateAgent(ctx context.Context, payload models.AgentPayload, opts ...CallOption) (*models.AgentResponse, error)
+	ListAgents(ctx context.Context, opts ...CallOption) ([]models.Agent, error)
+	GetAgent(ctx context.Context, agentID string, opts ...CallOption) (*models.Agent, error)
+	UpdateAgent(ctx context.Context, agentID string, payload models.AgentPayload, opts ...CallOption) (*models.AgentResponse, error)
+	DeleteAgent(ctx context.Context, agentID string, opts ...CallOption) error
+	Chat(ctx context.Context, payload models.ChatPayload, opts ...CallOption) (*models.ChatResponse, error)
+	// Stream is Chat with the reply passed to onDelta as it is produced.
+	Stream(ctx context.Context, payload models.ChatPayload, onDelta func(delta string) error, opts ...CallOption) (*models.ChatResponse, error)
+}
+
+// CallOption adjusts a single provider call.
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	idempotencyKey string
+}
+
+func newCallOptions(opts []CallOption) *callOptions {
+	options := &callOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// WithIdempotencyKey lets the provider drop repeats of a write, which makes
+// the write safe to retry.
+func WithIdempotencyKey(key string) CallOption {
+	return func(opts *callOptions) {
+		opts.idempotencyKey = key
+	}
+}
+
+// Error is a call the provider answered with a failure status.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("provider error: %s (status %d)", e.Message, e.StatusCode)
+}
+
+// UnavailableError is returned without calling the provider while it is
+// known to be down.
+type UnavailableError struct {
+	Provider string
+	RetryIn  time.Duration
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("%s unavailable, retry in %s", e.Provider, e.RetryIn.Round(time.Second))
+}
+
+func IsUnavailable(err error) bool {
+	var unavailable *UnavailableError
+	return errors.As(err, &unavailable)
+}
+
+// breakerReporter is implemented by providers guarded by a circuit
+// breaker.
+type breakerReporter interface {
+	BreakerStatus() clients.BreakerStatus
+}
+
+var ErrUnknownProvider = errors.New("unknown agent provider")
+
+// agentsTag marks every cached agent and agent list.
+const agentsTag = "agents"
+
+// Registry finds the provider of an agent. Agents kept in the local agent
+// store name their provider; any other agent belongs to the default one.
+// Agent lists and agents read through the registry are cached until an
+// agent is written through it or the entries expire.
+type Registry struct {
+	fallback  AgentProvider
+	providers map[string]AgentProvider
+	local     repository.LocalAgentRepository
+	cache     *cache.Loader
+	config    *configs.CacheConfig
+}
+
+func NewRegistry(fallback AgentProvider, local repository.LocalAgentRepository, loader *cache.Loader, config *configs.CacheConfig) *Registry {
+	return &Registry{
+		fallback:  fallback,
+		providers: map[string]AgentProvider{fallback.Name(): fallback},
+		local:     local,
+		cache:     loader,
+		config:    config,
+	}
+}
+
+func (r *Registry) Register(provider AgentProvider) {
+	r.providers[provider.Name()] = provider
+}
+
+// Provider returns the provider called name, the default one if name is
+// empty.
+func (r *Registry) Provider(name string) (AgentProvider, error) {
+	if name == "" {
+		return r.fallback, nil
+	}
+	provider, ok := r.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownProvider, name)
+	}
+	return provider, nil
+}
+
+// ForAgent returns the provider agentID runs on.
+func (r *Registry) ForAgent(ctx context.Context, agentID string) (AgentProvider, error) {
+	agent, err := r.local.GetAgent(ctx, agentID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return r.fallback, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.Provider(agent.Provider)
+}
+
+// names lists the providers, the default one first.
+func (r *Registry) names() []string {
+	names := []string{r.fallback.Name()}
+	for name := range r.providers {
+		if name != r.fallback.Name() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// CreateAgent creates the agent on the provider named in the payload.
+func (r *Registry) CreateAgent(ctx context.Context, payload models.AgentPayload, opts ...CallOption) (*models.AgentResponse, error) {
+	provider, err := r.Provider(payload.Provider)
+	if err != nil {
+		return nil, err
+	}
+	payload.Provider = ""
+	defer r.cache.Invalidate(ctx, agentsTag)
+	return provider.CreateAgent(ctx, payload, opts...)
+}
+
+// ListError reports the providers whose agents could not be listed.
+type ListError struct {
+	Failed map[string]error
+}
+
+func (e *ListError) Error() string {
+	names := make([]string, 0, len(e.Failed))
+	for name := range e.Failed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s: %v", name, e.Failed[name]))
+	}
+	return "unable to list agents of " + strings.Join(parts, "; ")
+}
+
+// ListAgents lists the agents of every provider. A provider that fails
+// does not hold up the others: their agents are returned together with a
+// *ListError naming it. Each provider's list is cached on its own and
+// concurrent callers share one round of calls, unless opts are given. A
+// context marked by cache.Refresh also drops the cached agents.
+func (r *Registry) ListAgents(ctx context.Context, opts ...CallOption) ([]models.Agent, error) {
+	if cache.IsRefresh(ctx) {
+		r.cache.Invalidate(ctx, agentsTag)
+	}
+	out := []models.Agent{}
+	var failed map[string]error
+	for _, name := range r.names() {
+		provider := r.providers[name]
+		agents, err := load(ctx, r, "agents:"+name, opts, func(ctx context.Context) ([]models.Agent, error) {
+			agents, err := provider.ListAgents(ctx, opts...)
+			if err != nil {
+				return nil, err
+			}
+			for i := range agents {
+				agents[i].Provider = name
+			}
+			return agents, nil
+		})
+		if err != nil {
+			log.Printf("Unable to list the agents of %s: %v", name, err)
+			if failed == nil {
+				failed = map[string]error{}
+			}
+			failed[name] = err
+			continue
+		}
+		out = append(out, agents...)
+	}
+	if failed != nil {
+		return out, &ListError{Failed: failed}
+	}
+	return out, nil
+}
+
+// load reads agents through the cache. Calls with options skip it, since a
+// shared call would run with the options of whoever started it.
+func load[T any](ctx context.Context, r *Registry, key string, opts []CallOption, fetch func(ctx context.Context) (T, error)) (T, error) {
+	if len(opts) > 0 {
+		return fetch(ctx)
+	}
+	return cache.Load(ctx, r.cache, key, r.config.AgentsTTL, []string{agentsTag}, fetch)
+}
+
+func (r *Registry) GetAgent(ctx context.Context, agentID string, opts ...CallOption) (*models.Agent, error) {
+	return load(ctx, r, "agent:"+agentID, opts, func(ctx context.Context) (*models.Agent, error) {
+		provider, err := r.ForAgent(ctx, agentID)
+		if err != nil {
+			return nil, err
+		}
+		agent, err := provider.GetAgent(ctx, agentID, opts...)
+		if err != nil {
+			return nil, err
+		}
+		agent.Provider = provider.Name()
+		return agent, nil
+	})
+}
+
+// UpdateAgent updates the agent on its provider. Agents cannot move to
+// another provider.
+func (r *Registry) UpdateAgent(ctx context.Context, agentID string, payload models.AgentPayload, opts ...CallOption) (*models.AgentResponse, error) {
+	provider, err := r.ForAgent(ctx, agentID)
+	if err != nil {
+		return nil, err
+	}
+	if payload.Provider != "" && payload.Provider != provider.Name() {
+		return nil, &Error{StatusCode: http.StatusBadRequest, Message: "the provider of an agent cannot change"}
+	}
+	payload.Provider = ""
+	defer r.cache.Invalidate(ctx, agentsTag)
+	return provider.UpdateAgent(ctx, agentID, payload, opts...)
+}
+
+func (r *Registry) DeleteAgent(ctx context.Context, agentID string, opts ...CallOption) error {
+	provider, err := r.ForAgent(ctx, agentID)
+	if err != nil {
+		return err
+	}
+	defer r.cache.Invalidate(ctx, agentsTag)
+	return provider.DeleteAgent(ctx, agentID, opts...)
+}
+
+func (r *Registry) Chat(ctx context.Context, payload models.ChatPayload, opts ...CallOption) (*models.ChatResponse, error) {
+	provider, err := r.ForAgent(ctx, payload.AgentID)
+	if err != nil {
+		return nil, err
+	}
+	return provider.Chat(ctx, payload, opts...)
+}
+
+func (r *Registry) Stream(ctx context.Context, payload models.ChatPayload, onDelta func(delta string) error, opts ...CallOption) (*models.ChatResponse, error) {
+	provider, err := r.ForAgent(ctx, payload.AgentID)
+	if err != nil {
+		return nil, err
+	}
+	return provider.Stream(ctx, payload, onDelta, opts...)
+}
+
+// Breakers reports the circuit breaker of every provider that has one.
+func (r *Registry) Breakers() map[string]clients.BreakerStatus {
+	out := map[string]clients.BreakerStatus{}
+	for name, provider := range r.providers {
+		if reporter, ok := provider.(breakerReporter); ok {
+			out[name] = reporter.BreakerStatus()
+		}
+	}
+	return out
+}
@@ -0,0 +1,208 @@
+package providers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	clients "github.com/sdutt/agentserver/clients/lyzr"
+	"github.com/sdutt/agentserver/clients/openai"
+	"github.com/sdutt/agentserver/configs"
+	models "github.com/sdutt/agentserver/models/lyzr"
+	"github.com/sdutt/agentserver/pkg/cache"
+	"github.com/sdutt/agentserver/pkg/dbtest"
+	"github.com/sdutt/agentserver/pkg/lyzrfake"
+	"github.com/sdutt/agentserver/pkg/providers"
+	"github.com/sdutt/agentserver/repository"
+)
+
+var breaker = configs.BreakerConfig{Window: time.Minute, MinRequests: 100, FailureRate: 1, OpenFor: time.Minute, HalfOpenProbes: 1}
+
+// newRegistry serves Lyzr from lyzr and the OpenAI-compatible provider
+// from completions.
+func newRegistry(t *testing.T, lyzr, completions http.Handler) *providers.Registry {
+	t.Helper()
+	lyzrServer := httptest.NewServer(lyzr)
+	t.Cleanup(lyzrServer.Close)
+	completionServer := httptest.NewServer(completions)
+	t.Cleanup(completionServer.Close)
+
+	local := repository.NewLocalAgentRepository(dbtest.Open(t))
+	lyzrClient := clients.NewLyzrClient(&configs.AppConfig{
+		LyzrAPIURL:  lyzrServer.URL,
+		LyzrAPIKey:  "test-key",
+		LyzrBreaker: breaker,
+		LyzrTimeout: configs.LyzrTimeoutConfig{Default: 5 * time.Second, Chat: 5 * time.Second},
+	})
+	openaiClient := openai.NewClient(&configs.OpenAIConfig{Name: "local", BaseURL: completionServer.URL, Timeout: 5 * time.Second, Breaker: breaker}, local)
+
+	registry := providers.NewRegistry(providers.Lyzr(lyzrClient), local, cache.NewLoader(cache.NewMemoryCache(16)), &configs.CacheConfig{AgentsTTL: time.Minute, CatalogTTL: time.Minute})
+	registry.Register(providers.OpenAI(openaiClient))
+	return registry
+}
+
+// payload is lyzrfake.Payload for the named provider.
+func payload(provider string) models.AgentPayload {
+	payload := lyzrfake.Payload("Support")
+	payload.Provider = provider
+	return payload
+}
+
+func TestListAgentsKeepsTheAgentsOfHealthyProviders(t *testing.T) {
+	// the fake expects another key, so every Lyzr call is refused
+	registry := newRegistry(t, lyzrfake.New(lyzrfake.WithAPIKey("other-key")), http.NotFoundHandler())
+	ctx := context.Background()
+	created, err := registry.CreateAgent(ctx, payload("local"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	agents, err := registry.ListAgents(ctx)
+	var listErr *providers.ListError
+	if !errors.As(err, &listErr) {
+		t.Fatalf("got %v, want a list error", err)
+	}
+	var apiErr *providers.Error
+	if !errors.As(listErr.Failed["lyzr"], &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("got %v for lyzr, want a 401 provider error", listErr.Failed["lyzr"])
+	}
+	if len(agents) != 1 || agents[0].ID != created.ID || agents[0].Provider != "local" {
+		t.Errorf("got %+v, want the local agent", agents)
+	}
+}
+
+func TestListAgentsWithOptionsSkipsTheCache(t *testing.T) {
+	var mu sync.Mutex
+	lists := 0
+	fake := lyzrfake.New(lyzrfake.WithAPIKey("test-key"), lyzrfake.WithAgents(models.Agent{ID: "a1", Name: "Support"}))
+	registry := newRegistry(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.URL.Path == "/v3/agents/" {
+			mu.Lock()
+			lists++
+			mu.Unlock()
+		}
+		fake.ServeHTTP(w, r)
+	}), http.NotFoundHandler())
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := registry.ListAgents(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	agents, err := registry.ListAgents(ctx, providers.WithIdempotencyKey("k1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(agents) != 1 {
+		t.Errorf("got %+v, want the Lyzr agent", agents)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if lists != 2 {
+		t.Errorf("got %d calls to Lyzr, want one cached and one with options", lists)
+	}
+}
+
+func TestCallsTranslateOptionsAndErrors(t *testing.T) {
+	var mu sync.Mutex
+	var keys []string
+	lyzr := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v3/agents/":
+			mu.Lock()
+			keys = append(keys, r.Header.Get(clients.HeaderIdempotencyKey))
+			mu.Unlock()
+			json.NewEncoder(w).Encode(models.AgentResponse{AgentId: "a1"})
+		case r.Method == http.MethodGet && r.URL.Path == "/v3/agents/":
+			json.NewEncoder(w).Encode([]models.Agent{{ID: "a1", Name: "Support"}})
+		default:
+			http.Error(w, `{"detail":"not found"}`, http.StatusNotFound)
+		}
+	})
+	registry := newRegistry(t, lyzr, http.NotFoundHandler())
+	ctx := context.Background()
+
+	if _, err := registry.CreateAgent(ctx, payload(""), providers.WithIdempotencyKey("k1")); err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != "k1" {
+		t.Errorf("got idempotency keys %v, want k1", keys)
+	}
+
+	agents, err := registry.ListAgents(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(agents) != 1 || agents[0].Provider != "lyzr" {
+		t.Errorf("got %+v, want the lyzr agent", agents)
+	}
+
+	_, err = registry.GetAgent(ctx, "missing")
+	var apiErr *providers.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("got %v, want a 404 provider error", err)
+	}
+	_, err = registry.UpdateAgent(ctx, "a1", payload("local"))
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("got %v, want a 400 provider error", err)
+	}
+}
+
+func TestStreamThroughTheOpenAIProvider(t *testing.T) {
+	var request struct {
+		Model    string `json:"model"`
+		Stream   bool   `json:"stream"`
+		Messages []struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		} `json:"messages"`
+	}
+	completions := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat/completions" {
+			http.NotFound(w, r)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, word := range []string{"It ", "ships ", "today."} {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", word)
+		}
+		fmt.Fprint(w, "data: {\"choices\":[],\"usage\":{\"prompt_tokens\":7,\"completion_tokens\":3,\"total_tokens\":10}}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	})
+	registry := newRegistry(t, http.NotFoundHandler(), completions)
+	ctx := context.Background()
+	created, err := registry.CreateAgent(ctx, payload("local"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var deltas []string
+	resp, err := registry.Stream(ctx, models.ChatPayload{AgentID: created.ID, UserID: "u1", Message: "When does it ship?"}, func(delta string) error {
+		deltas = append(deltas, delta)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(deltas, "|") != "It |ships |today." || resp.Response != "It ships today." {
+		t.Errorf("got deltas %q and reply %q", deltas, resp.Response)
+	}
+	if resp.Usage == nil || resp.Usage.TotalTokens != 10 {
+		t.Errorf("got usage %+v, want 10 tokens", resp.Usage)
+	}
+	if !request.Stream || request.Model != "gpt-4o-mini" || len(request.Messages) != 2 || request.Messages[0].Content != "Be brief." {
+		t.Errorf("got request %+v", request)
+	}
+}
@@ -0,0 +1,44 @@
+package redact
+
+import "regexp"
+
+type rule struct {
+	kind        string
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// order matters: IP addresses are matched before phone numbers, and phone
+// numbers before the looser card pattern, which would also take a spaced
+// out international number. Phone numbers need an international prefix or
+// grouped digits without dots, so dates, decimals and plain order numbers
+// stay.
+var rules = []rule{
+	{"email", regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`), "[EMAIL]"},
+	{"ssn", regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`), "[SSN]"},
+	{"ip", regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`), "[IP]"},
+	{"phone", regexp.MustCompile(`\+\d{1,3}(?:[ -]\(?\d{1,8}\)?){2,4}\b|(?:\(\d{3}\) ?|\b\d{3}[ -])\d{3,4}[ -]\d{4}\b`), "[PHONE]"},
+	{"card", regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), "[CARD]"},
+}
+
+// Text masks emails, social security, card and phone numbers and IP addresses.
+func Text(s string) string {
+	for _, r := range rules {
+		s = r.pattern.ReplaceAllString(s, r.replacement)
+	}
+	return s
+}
+
+// Detect names the kinds of personal data Text would mask in s, in rule
+// order. A kind matched only inside an earlier kind, such as the digits of
+// a card number, is not reported.
+func Detect(s string) []string {
+	var kinds []string
+	for _, r := range rules {
+		if r.pattern.MatchString(s) {
+			kinds = append(kinds, r.kind)
+			s = r.pattern.ReplaceAllString(s, r.replacement)
+		}
+	}
+	return kinds
+}
@@ -0,0 +1,51 @@
+package redact_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sdutt/agentserver/pkg/redact"
+)
+
+func TestText(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"mail me at jane.doe@example.com", "mail me at [EMAIL]"},
+		{"ssn 123-45-6789", "ssn [SSN]"},
+		{"card 4111 1111 1111 1111 please", "card [CARD] please"},
+		{"call 555-123-4567", "call [PHONE]"},
+		{"call (555) 123-4567", "call [PHONE]"},
+		{"call +1 555 123 4567", "call [PHONE]"},
+		{"call +44 20 7946 0958", "call [PHONE]"},
+		{"call +49 151 12345678", "call [PHONE]"},
+		{"call 020 7946 0958", "call [PHONE]"},
+		{"from 192.168.1.10", "from [IP]"},
+		{"on 2026-10-19", "on 2026-10-19"},
+		{"order 123456789", "order 123456789"},
+		{"pi is 3.14159265", "pi is 3.14159265"},
+		{"version 1.2.3", "version 1.2.3"},
+	}
+	for _, tt := range tests {
+		if got := redact.Text(tt.in); got != tt.want {
+			t.Errorf("Text(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"see you on 2026-10-19", nil},
+		{"card 4111-1111-1111-1111", []string{"card"}},
+		{"host 10.0.0.1, call 555-123-4567", []string{"ip", "phone"}},
+		{"jane@example.com or +1 555 123 4567", []string{"email", "phone"}},
+	}
+	for _, tt := range tests {
+		if got := redact.Detect(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Detect(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
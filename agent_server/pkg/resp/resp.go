@@ -0,0 +1,137 @@
+// Package resp is a small client for the Redis serialization protocol,
+// shared by the Redis-backed broker and cache.
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+const dialTimeout = 5 * time.Second
+
+// Conn is one connection speaking the Redis serialization protocol. It is
+// not safe for concurrent use.
+type Conn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// Dial connects to addr and authenticates when password is set.
+func Dial(addr, password string) (*Conn, error) {
+	conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	rc := &Conn{conn: conn, reader: bufio.NewReader(conn)}
+	if password != "" {
+		conn.SetDeadline(time.Now().Add(dialTimeout))
+		if err := rc.Write("AUTH", password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if _, err := rc.Read(); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("auth: %w", err)
+		}
+		conn.SetDeadline(time.Time{})
+	}
+	return rc, nil
+}
+
+// Write sends one command made of args.
+func (rc *Conn) Write(args ...string) error {
+	buf := make([]byte, 0, 64)
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, arg...)
+		buf = append(buf, '\r', '\n')
+	}
+	_, err := rc.conn.Write(buf)
+	return err
+}
+
+// Error is an error reply sent by the server.
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// Read returns the next reply: a string, int64, []byte, nil or []interface{}.
+// Error replies are returned as an Error, and kept as Error items inside
+// arrays.
+func (rc *Conn) Read() (interface{}, error) {
+	line, err := rc.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errors.New("malformed reply")
+	}
+	kind, line := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return line, nil
+	case '-':
+		return nil, Error(line)
+	case ':':
+		return strconv.ParseInt(line, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(rc.reader, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		// an error item, such as a failed command in EXEC, does not end
+		// the array: the rest must still be read off the connection
+		items := make([]interface{}, n)
+		for i := range items {
+			item, err := rc.Read()
+			var replyErr Error
+			if errors.As(err, &replyErr) {
+				item = replyErr
+			} else if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("unexpected reply type %q", kind)
+}
+
+// Do writes one command and reads its reply.
+func (rc *Conn) Do(args ...string) (interface{}, error) {
+	if err := rc.Write(args...); err != nil {
+		return nil, err
+	}
+	return rc.Read()
+}
+
+// SetDeadline bounds the next reads and writes on the connection.
+func (rc *Conn) SetDeadline(t time.Time) error {
+	return rc.conn.SetDeadline(t)
+}
+
+func (rc *Conn) Close() error {
+	return rc.conn.Close()
+}
@@ -0,0 +1,105 @@
+package tokens
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Estimate approximates the token count of text at four characters a token.
+// It is close enough for budgeting prompts; reported usage should come from
+// the provider when it has any.
+func Estimate(text string) int {
+	n := utf8.RuneCountInString(text)
+	if n == 0 {
+		return 0
+	}
+	return (n + 3) / 4
+}
+
+// Price is the cost in USD per thousand tokens.
+type Price struct {
+	Prompt     float64
+	Completion float64
+}
+
+type modelPrice struct {
+	prefix string
+	price  Price
+}
+
+// defaultPrices are list prices at the time of writing; deployments correct
+// and extend them with ParsePrices.
+var defaultPrices = []modelPrice{
+	{"gpt-4o-mini", Price{0.00015, 0.0006}},
+	{"gpt-4o", Price{0.0025, 0.01}},
+	{"gpt-4.1-mini", Price{0.0004, 0.0016}},
+	{"gpt-4.1", Price{0.002, 0.008}},
+	{"gpt-4", Price{0.03, 0.06}},
+	{"gpt-3.5", Price{0.0005, 0.0015}},
+	{"claude-3-5-haiku", Price{0.0008, 0.004}},
+	{"claude-3-haiku", Price{0.00025, 0.00125}},
+	{"claude", Price{0.003, 0.015}},
+	{"gemini", Price{0.000075, 0.0003}},
+}
+
+// Prices matches model names to prices by prefix, longest prefix first.
+type Prices struct {
+	table []modelPrice
+}
+
+// ParsePrices returns the default prices overridden by spec, a list of
+// "model=prompt:completion" entries in USD per thousand tokens separated by
+// commas.
+func ParsePrices(spec string) (*Prices, error) {
+	overrides := map[string]Price{}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		model, value, ok := strings.Cut(entry, "=")
+		prompt, completion, ok2 := strings.Cut(value, ":")
+		if !ok || !ok2 || model == "" {
+			return nil, fmt.Errorf("price %q must look like model=prompt:completion", entry)
+		}
+		var price Price
+		var err error
+		if price.Prompt, err = strconv.ParseFloat(prompt, 64); err != nil {
+			return nil, fmt.Errorf("price %q: %w", entry, err)
+		}
+		if price.Completion, err = strconv.ParseFloat(completion, 64); err != nil {
+			return nil, fmt.Errorf("price %q: %w", entry, err)
+		}
+		overrides[strings.ToLower(model)] = price
+	}
+	prices := &Prices{}
+	for model, price := range overrides {
+		prices.table = append(prices.table, modelPrice{model, price})
+	}
+	for _, p := range defaultPrices {
+		if _, ok := overrides[p.prefix]; !ok {
+			prices.table = append(prices.table, p)
+		}
+	}
+	sort.SliceStable(prices.table, func(i, j int) bool {
+		return len(prices.table[i].prefix) > len(prices.table[j].prefix)
+	})
+	return prices, nil
+}
+
+// Cost estimates the USD cost of a call. Unknown models cost nothing.
+func (p *Prices) Cost(model string, promptTokens, completionTokens int) float64 {
+	model = strings.ToLower(model)
+	if i := strings.LastIndex(model, "/"); i >= 0 {
+		model = model[i+1:]
+	}
+	for _, entry := range p.table {
+		if strings.HasPrefix(model, entry.prefix) {
+			return float64(promptTokens)/1000*entry.price.Prompt + float64(completionTokens)/1000*entry.price.Completion
+		}
+	}
+	return 0
+}
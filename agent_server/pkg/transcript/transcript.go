@@ -0,0 +1,182 @@
+package transcript
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	models "github.com/sdutt/agentserver/models/chat"
+	"github.com/sdutt/agentserver/pkg/redact"
+)
+
+const (
+	FormatJSON     = "json"
+	FormatMarkdown = "md"
+	FormatCSV      = "csv"
+)
+
+type Transcript struct {
+	Conversation models.Conversation `json:"conversation"`
+	Messages     []models.Message    `json:"messages"`
+	ExportedAt   time.Time           `json:"exported_at"`
+	Redacted     bool                `json:"redacted"`
+}
+
+func New(conversation models.Conversation, messages []models.Message, redacted bool) *Transcript {
+	t := &Transcript{
+		Conversation: conversation,
+		Messages:     messages,
+		ExportedAt:   time.Now().UTC(),
+		Redacted:     redacted,
+	}
+	if redacted {
+		c := &t.Conversation
+		c.UserID = redact.Text(c.UserID)
+		c.EscalationReason = redact.Text(c.EscalationReason)
+		c.Resolution = redact.Text(c.Resolution)
+		c.Summary = redact.Text(c.Summary)
+		for i := range t.Messages {
+			m := &t.Messages[i]
+			m.SenderID = redact.Text(m.SenderID)
+			m.Text = redact.Text(m.Text)
+			m.Attachments = redactAttachments(m.Attachments)
+		}
+	}
+	return t
+}
+
+// redactAttachments returns a copy of attachments with names and URLs masked,
+// leaving the stored message untouched.
+func redactAttachments(attachments []models.Attachment) []models.Attachment {
+	if len(attachments) == 0 {
+		return attachments
+	}
+	out := make([]models.Attachment, len(attachments))
+	for i, a := range attachments {
+		a.Name = redact.Text(a.Name)
+		a.URL = redact.Text(a.URL)
+		out[i] = a
+	}
+	return out
+}
+
+func ValidFormat(format string) bool {
+	switch format {
+	case FormatJSON, FormatMarkdown, FormatCSV:
+		return true
+	}
+	return false
+}
+
+func ContentType(format string) string {
+	switch format {
+	case FormatMarkdown:
+		return "text/markdown; charset=utf-8"
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	}
+	return "application/json"
+}
+
+func FileName(conversationID, format string) string {
+	return fmt.Sprintf("conversation-%s.%s", conversationID, format)
+}
+
+func Write(w io.Writer, format string, t *Transcript) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(t)
+	case FormatMarkdown:
+		return writeMarkdown(w, t)
+	case FormatCSV:
+		return writeCSV(w, t)
+	}
+	return fmt.Errorf("unsupported format %q", format)
+}
+
+func writeMarkdown(w io.Writer, t *Transcript) error {
+	var b strings.Builder
+	c := t.Conversation
+	fmt.Fprintf(&b, "# Conversation %s\n\n", c.ID)
+	fmt.Fprintf(&b, "- Agent: %s\n", c.AgentID)
+	fmt.Fprintf(&b, "- User: %s\n", c.UserID)
+	if c.WorkspaceID != "" {
+		fmt.Fprintf(&b, "- Workspace: %s\n", c.WorkspaceID)
+	}
+	fmt.Fprintf(&b, "- Started: %s\n", c.CreatedAt.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "- Exported: %s\n", t.ExportedAt.Format(time.RFC3339))
+	if t.Redacted {
+		b.WriteString("- PII redacted\n")
+	}
+	b.WriteString("\n---\n")
+	for _, m := range t.Messages {
+		fmt.Fprintf(&b, "\n**%s** (%s)", m.Role, m.CreatedAt.UTC().Format(time.RFC3339))
+		if m.Role == models.RoleAgent && m.AgentName != "" {
+			fmt.Fprintf(&b, " _%s, %s, temperature %s_", m.AgentName, m.AgentModel, formatFloat(m.AgentTemperature))
+		}
+		b.WriteString("\n\n")
+		b.WriteString(m.Text)
+		b.WriteString("\n")
+		for _, a := range m.Attachments {
+			fmt.Fprintf(&b, "\n- Attachment: [%s](%s)", a.Name, a.URL)
+		}
+		if len(m.ModerationFlags) > 0 {
+			fmt.Fprintf(&b, "\n- Moderation: %s", strings.Join(m.ModerationFlags, ", "))
+		}
+		if len(m.Attachments) > 0 || len(m.ModerationFlags) > 0 {
+			b.WriteString("\n")
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeCSV(w io.Writer, t *Transcript) error {
+	cw := csv.NewWriter(w)
+	err := cw.Write([]string{
+		"conversation_id", "message_id", "seq", "timestamp", "role", "sender_id", "text",
+		"agent_name", "agent_model", "agent_temperature", "attachments", "moderation_flags",
+	})
+	if err != nil {
+		return err
+	}
+	for _, m := range t.Messages {
+		attachments := make([]string, 0, len(m.Attachments))
+		for _, a := range m.Attachments {
+			attachments = append(attachments, a.URL)
+		}
+		temperature := ""
+		if m.Role == models.RoleAgent {
+			temperature = formatFloat(m.AgentTemperature)
+		}
+		err := cw.Write([]string{
+			m.ConversationID,
+			m.ID,
+			strconv.FormatInt(m.Seq, 10),
+			m.CreatedAt.UTC().Format(time.RFC3339),
+			m.Role,
+			m.SenderID,
+			m.Text,
+			m.AgentName,
+			m.AgentModel,
+			temperature,
+			strings.Join(attachments, " "),
+			strings.Join(m.ModerationFlags, " "),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
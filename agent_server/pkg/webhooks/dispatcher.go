@@ -0,0 +1,214 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sdutt/agentserver/configs"
+	jobmodels "github.com/sdutt/agentserver/models/jobs"
+	models "github.com/sdutt/agentserver/models/webhooks"
+	"github.com/sdutt/agentserver/pkg/ids"
+	"github.com/sdutt/agentserver/pkg/jobs"
+	"github.com/sdutt/agentserver/repository"
+)
+
+// KindDelivery is the job kind of queued webhook deliveries.
+const KindDelivery = "webhook_delivery"
+
+// maxResponseBody bounds how much of a receiver's response is logged.
+const maxResponseBody = 2048
+
+// Event is the JSON body posted to subscribers.
+type Event struct {
+	ID          string      `json:"id"`
+	Type        string      `json:"type"`
+	WorkspaceID string      `json:"workspace_id"`
+	CreatedAt   time.Time   `json:"created_at"`
+	Data        interface{} `json:"data"`
+}
+
+type deliveryJob struct {
+	DeliveryID string `json:"delivery_id"`
+}
+
+// Dispatcher records a delivery for every subscription interested in an
+// event and posts it from the job queue, which retries failures with
+// exponential backoff.
+type Dispatcher struct {
+	config   *configs.WebhooksConfig
+	webhooks repository.WebhookRepository
+	queue    *jobs.Queue
+	client   *http.Client
+}
+
+func NewDispatcher(config *configs.WebhooksConfig, webhooks repository.WebhookRepository, queue *jobs.Queue) *Dispatcher {
+	return &Dispatcher{config, webhooks, queue, newClient(config.Timeout, config.AllowPrivate)}
+}
+
+// Publish fans event out to the workspace's subscriptions and to the
+// global ones, which have no workspace. Failures are
+// logged: webhooks never fail the operation that raised the event.
+func (d *Dispatcher) Publish(ctx context.Context, event, workspaceID string, data interface{}) {
+	subs, err := d.webhooks.MatchSubscriptions(ctx, workspaceID, event)
+	if err != nil {
+		log.Printf("Unable to look up webhooks for %s: %v", event, err)
+		return
+	}
+	if len(subs) == 0 {
+		return
+	}
+	envelope := Event{
+		ID:          ids.New(),
+		Type:        event,
+		WorkspaceID: workspaceID,
+		CreatedAt:   time.Now().UTC(),
+		Data:        data,
+	}
+	payload, err := json.Marshal(envelope)
+	if err != nil {
+		log.Printf("Unable to encode %s event: %v", event, err)
+		return
+	}
+	for _, sub := range subs {
+		delivery := &models.Delivery{
+			SubscriptionID: sub.ID,
+			EventID:        envelope.ID,
+			Event:          event,
+			Payload:        payload,
+		}
+		if err := d.enqueue(ctx, delivery); err != nil {
+			log.Printf("Unable to queue %s webhook for subscription %s: %v", event, sub.ID, err)
+		}
+	}
+}
+
+// Redeliver sends the payload of an earlier delivery again as a new
+// delivery.
+func (d *Dispatcher) Redeliver(ctx context.Context, deliveryID string) (*models.Delivery, error) {
+	original, err := d.webhooks.GetDelivery(ctx, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	delivery := &models.Delivery{
+		SubscriptionID: original.SubscriptionID,
+		EventID:        original.EventID,
+		Event:          original.Event,
+		Payload:        original.Payload,
+		RedeliveryOf:   original.ID,
+	}
+	if err := d.enqueue(ctx, delivery); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+func (d *Dispatcher) enqueue(ctx context.Context, delivery *models.Delivery) error {
+	delivery.Status = models.DeliveryPending
+	if err := d.webhooks.CreateDelivery(ctx, delivery); err != nil {
+		return err
+	}
+	job, err := d.queue.Enqueue(ctx, KindDelivery, deliveryJob{DeliveryID: delivery.ID})
+	if err != nil {
+		return err
+	}
+	delivery.JobID = job.ID
+	return d.webhooks.UpdateDelivery(ctx, delivery)
+}
+
+// Handle runs one delivery attempt.
+func (d *Dispatcher) Handle(ctx context.Context, job *jobmodels.Job) (string, error) {
+	var payload deliveryJob
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return "", jobs.Permanent(err)
+	}
+	delivery, err := d.webhooks.GetDelivery(ctx, payload.DeliveryID)
+	if err != nil {
+		return "", jobs.Permanent(err)
+	}
+	sub, err := d.webhooks.GetSubscription(ctx, delivery.SubscriptionID)
+	if err != nil {
+		return "", d.fail(ctx, delivery, jobs.Permanent(err))
+	}
+	if !sub.Active {
+		return "", d.fail(ctx, delivery, jobs.Permanent(fmt.Errorf("subscription %s is disabled", sub.ID)))
+	}
+	if err := d.CheckURL(ctx, sub.URL); errors.Is(err, ErrPrivateAddress) {
+		return "", d.fail(ctx, delivery, jobs.Permanent(err))
+	}
+
+	delivery.Attempts++
+	attempt := d.post(ctx, sub, delivery)
+	if err := d.webhooks.RecordAttempt(ctx, attempt); err != nil {
+		log.Printf("Unable to record attempt of delivery %s: %v", delivery.ID, err)
+	}
+	if attempt.Error != "" {
+		err := fmt.Errorf("%s", attempt.Error)
+		if job.LastAttempt() {
+			err = jobs.Permanent(err)
+		}
+		return "", d.fail(ctx, delivery, err)
+	}
+	now := time.Now()
+	delivery.Status = models.DeliverySucceeded
+	delivery.LastError = ""
+	delivery.DeliveredAt = &now
+	if err := d.webhooks.UpdateDelivery(ctx, delivery); err != nil {
+		log.Printf("Unable to update delivery %s: %v", delivery.ID, err)
+	}
+	return strconv.Itoa(attempt.StatusCode), nil
+}
+
+func (d *Dispatcher) post(ctx context.Context, sub *models.Subscription, delivery *models.Delivery) *models.DeliveryAttempt {
+	attempt := &models.DeliveryAttempt{DeliveryID: delivery.ID, Attempt: delivery.Attempts}
+	started := time.Now()
+	defer func() {
+		attempt.DurationMs = time.Since(started).Milliseconds()
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	timestamp := started.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, delivery.ID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, timestamp, delivery.ID, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	attempt.StatusCode = resp.StatusCode
+	attempt.ResponseBody = string(body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		attempt.Error = fmt.Sprintf("receiver answered %d", resp.StatusCode)
+	}
+	return attempt
+}
+
+// fail stores the outcome of a failed attempt and returns err for the queue.
+func (d *Dispatcher) fail(ctx context.Context, delivery *models.Delivery, err error) error {
+	delivery.Status = models.DeliveryRetrying
+	if jobs.IsPermanent(err) {
+		delivery.Status = models.DeliveryFailed
+	}
+	delivery.LastError = err.Error()
+	if err := d.webhooks.UpdateDelivery(ctx, delivery); err != nil {
+		log.Printf("Unable to update delivery %s: %v", delivery.ID, err)
+	}
+	return err
+}
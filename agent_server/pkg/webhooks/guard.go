@@ -0,0 +1,67 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrPrivateAddress is returned for webhook URLs that point into the
+// server's own network.
+var ErrPrivateAddress = errors.New("webhook url resolves to a private or loopback address")
+
+// CheckURL refuses URLs whose host resolves to a loopback, private,
+// link-local or unspecified address, unless private targets are allowed.
+func (d *Dispatcher) CheckURL(ctx context.Context, raw string) error {
+	if d.config.AllowPrivate {
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return fmt.Errorf("unable to resolve %s: %w", u.Hostname(), err)
+	}
+	for _, addr := range addrs {
+		if private(addr.IP) {
+			return ErrPrivateAddress
+		}
+	}
+	return nil
+}
+
+// private reports whether ip is not routable on the public internet.
+func private(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast()
+}
+
+// newClient returns the client deliveries are posted with. Unless private
+// targets are allowed it refuses to connect to private addresses, which
+// also covers hosts that resolve differently after the URL was checked.
+func newClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || private(ip) {
+				return ErrPrivateAddress
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
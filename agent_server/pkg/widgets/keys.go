@@ -0,0 +1,31 @@
+package widgets
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// NewPublishableKey returns a key that identifies a widget in public pages.
+func NewPublishableKey() string {
+	return "pk_" + random(16)
+}
+
+// NewSessionToken returns the bearer token of a visitor session.
+func NewSessionToken() string {
+	return "vst_" + random(32)
+}
+
+// HashToken is how session tokens are stored and looked up.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func random(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
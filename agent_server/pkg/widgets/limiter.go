@@ -0,0 +1,32 @@
+package widgets
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/sdutt/agentserver/pkg/cache"
+)
+
+// Limiter counts events per key in fixed windows. The counters live in the
+// cache, so with the redis driver every instance shares them.
+type Limiter struct {
+	cache cache.Cache
+}
+
+func NewLimiter(c cache.Cache) *Limiter {
+	return &Limiter{cache: c}
+}
+
+// Allow records an event for key and reports whether it is within limit
+// events per period. Events are let through when the cache is unavailable.
+func (l *Limiter) Allow(ctx context.Context, key string, limit int, period time.Duration) bool {
+	window := time.Now().UnixNano() / int64(period)
+	count, err := l.cache.Incr(ctx, "limit:"+key+":"+strconv.FormatInt(window, 10), period)
+	if err != nil {
+		log.Printf("Unable to count %s against its rate limit: %v", key, err)
+		return true
+	}
+	return count <= int64(limit)
+}
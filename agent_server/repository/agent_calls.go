@@ -0,0 +1,28 @@
+package repository
+
+import (
+	"context"
+
+	models "github.com/sdutt/agentserver/models/chat"
+	"github.com/sdutt/agentserver/pkg/connectors"
+	"github.com/sdutt/agentserver/pkg/ids"
+)
+
+type AgentCallRepository interface {
+	RecordCall(ctx context.Context, call *models.AgentCall) error
+}
+
+type agentCallRepository struct {
+	db connectors.SqliteConnector
+}
+
+func NewAgentCallRepository(db connectors.SqliteConnector) AgentCallRepository {
+	return &agentCallRepository{db}
+}
+
+func (repo *agentCallRepository) RecordCall(ctx context.Context, call *models.AgentCall) error {
+	if call.ID == "" {
+		call.ID = ids.New()
+	}
+	return repo.db.DB(ctx).Create(call).Error
+}
@@ -0,0 +1,229 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	models "github.com/sdutt/agentserver/models/agents"
+	"github.com/sdutt/agentserver/pkg/connectors"
+	"github.com/sdutt/agentserver/pkg/ids"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Sort keys of mirrored agent listings.
+const (
+	AgentSortName      = "name"
+	AgentSortCreatedAt = "created_at"
+	AgentSortUpdatedAt = "updated_at"
+)
+
+// AgentFilter selects a page of mirrored agents. Empty fields do not
+// filter; an agent must carry every tag in Tags.
+type AgentFilter struct {
+	Provider      string
+	Model         string
+	Query         string
+	Tags          []string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	Sort          string
+	Descending    bool
+	// After continues a listing past the agent it was cut at.
+	After *AgentCursor
+	Limit int
+}
+
+// AgentCursor is the position of an agent in a listing: its value of the
+// sort key and its id, which breaks ties.
+type AgentCursor struct {
+	Name      string    `json:"name,omitempty"`
+	Timestamp time.Time `json:"timestamp,omitempty"`
+	ID        string    `json:"id"`
+}
+
+type AgentPage struct {
+	Agents []models.MirroredAgent
+	Total  int64
+	// Next is where the following page starts, nil on the last page.
+	Next *AgentCursor
+}
+
+type AgentMirrorRepository interface {
+	// ListAgents returns the mirrored agents, with those deleted at their
+	// provider if includeDeleted is set.
+	ListAgents(ctx context.Context, includeDeleted bool) ([]models.MirroredAgent, error)
+	// FindAgents returns a page of the mirrored agents matching filter and
+	// how many match in total.
+	FindAgents(ctx context.Context, filter AgentFilter) (*AgentPage, error)
+	GetAgent(ctx context.Context, id string) (*models.MirroredAgent, error)
+	// SaveAgent stores what the provider returned for an agent, bringing
+	// it back if it was deleted. Local metadata is kept.
+	SaveAgent(ctx context.Context, agent *models.MirroredAgent) error
+	UpdateMetadata(ctx context.Context, agent *models.MirroredAgent) error
+	DeleteAgent(ctx context.Context, id string) error
+	// SaveSync stores a sync report and drops all but the latest keep.
+	SaveSync(ctx context.Context, sync *models.AgentSync, keep int) error
+	ListSyncs(ctx context.Context, limit int) ([]models.AgentSync, error)
+	// LastSuccessfulSync returns ErrNotFound until a sync succeeded.
+	LastSuccessfulSync(ctx context.Context) (*models.AgentSync, error)
+}
+
+type agentMirrorRepository struct {
+	db connectors.SqliteConnector
+}
+
+func NewAgentMirrorRepository(db connectors.SqliteConnector) AgentMirrorRepository {
+	return &agentMirrorRepository{db}
+}
+
+func (repo *agentMirrorRepository) ListAgents(ctx context.Context, includeDeleted bool) ([]models.MirroredAgent, error) {
+	query := repo.db.DB(ctx).Order("created_at, id")
+	if includeDeleted {
+		query = query.Unscoped()
+	}
+	agents := []models.MirroredAgent{}
+	if err := query.Find(&agents).Error; err != nil {
+		return nil, err
+	}
+	return agents, nil
+}
+
+func (repo *agentMirrorRepository) FindAgents(ctx context.Context, filter AgentFilter) (*AgentPage, error) {
+	db := repo.db.DB(ctx)
+	base := func() *gorm.DB {
+		q := db.Model(&models.MirroredAgent{})
+		if filter.Provider != "" {
+			q = q.Where("provider = ?", filter.Provider)
+		}
+		if filter.Model != "" {
+			q = q.Where("model = ?", filter.Model)
+		}
+		if filter.Query != "" {
+			pattern := "%" + escapeLike(filter.Query) + "%"
+			q = q.Where(`(name LIKE ? ESCAPE '\' OR description LIKE ? ESCAPE '\')`, pattern, pattern)
+		}
+		for _, tag := range filter.Tags {
+			q = q.Where("EXISTS (SELECT 1 FROM json_each(mirrored_agents.tags) WHERE json_each.value = ?)", tag)
+		}
+		if !filter.CreatedAfter.IsZero() {
+			q = q.Where("created_at >= ?", filter.CreatedAfter)
+		}
+		if !filter.CreatedBefore.IsZero() {
+			q = q.Where("created_at < ?", filter.CreatedBefore)
+		}
+		return q
+	}
+
+	page := &AgentPage{Agents: []models.MirroredAgent{}}
+	if err := base().Count(&page.Total).Error; err != nil {
+		return nil, err
+	}
+
+	column, direction, compare := filter.Sort, "ASC", ">"
+	if filter.Descending {
+		direction, compare = "DESC", "<"
+	}
+	var value interface{}
+	if filter.After != nil {
+		value = filter.After.Timestamp
+	}
+	if filter.Sort == AgentSortName {
+		column = "name COLLATE NOCASE"
+		if filter.After != nil {
+			value = filter.After.Name
+		}
+	}
+	q := base()
+	if filter.After != nil {
+		q = q.Where("("+column+" "+compare+" ? OR ("+column+" = ? AND id "+compare+" ?))", value, value, filter.After.ID)
+	}
+	err := q.Order(column + " " + direction + ", id " + direction).Limit(filter.Limit + 1).Find(&page.Agents).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(page.Agents) > filter.Limit {
+		page.Agents = page.Agents[:filter.Limit]
+		last := page.Agents[len(page.Agents)-1]
+		page.Next = &AgentCursor{ID: last.ID}
+		switch filter.Sort {
+		case AgentSortName:
+			page.Next.Name = last.Name
+		case AgentSortCreatedAt:
+			page.Next.Timestamp = last.CreatedAt
+		case AgentSortUpdatedAt:
+			page.Next.Timestamp = last.UpdatedAt
+		}
+	}
+	return page, nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+func (repo *agentMirrorRepository) GetAgent(ctx context.Context, id string) (*models.MirroredAgent, error) {
+	var agent models.MirroredAgent
+	err := repo.db.DB(ctx).Where("id = ?", id).First(&agent).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &agent, nil
+}
+
+func (repo *agentMirrorRepository) SaveAgent(ctx context.Context, agent *models.MirroredAgent) error {
+	columns := []string{"provider", "name", "description", "model", "data", "hash", "synced_at", "updated_at", "deleted_at"}
+	if !agent.CreatedAt.IsZero() {
+		columns = append(columns, "created_at")
+	}
+	return repo.db.DB(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns(columns),
+	}).Create(agent).Error
+}
+
+func (repo *agentMirrorRepository) UpdateMetadata(ctx context.Context, agent *models.MirroredAgent) error {
+	return repo.db.DB(ctx).Model(agent).Select("owner", "workspace_id", "tags").Updates(agent).Error
+}
+
+func (repo *agentMirrorRepository) DeleteAgent(ctx context.Context, id string) error {
+	return repo.db.DB(ctx).Where("id = ?", id).Delete(&models.MirroredAgent{}).Error
+}
+
+func (repo *agentMirrorRepository) SaveSync(ctx context.Context, sync *models.AgentSync, keep int) error {
+	if sync.ID == "" {
+		sync.ID = ids.New()
+	}
+	db := repo.db.DB(ctx)
+	if err := db.Create(sync).Error; err != nil {
+		return err
+	}
+	return db.Where("id NOT IN (?)", db.Model(&models.AgentSync{}).Select("id").Order("started_at DESC").Limit(keep)).
+		Delete(&models.AgentSync{}).Error
+}
+
+func (repo *agentMirrorRepository) ListSyncs(ctx context.Context, limit int) ([]models.AgentSync, error) {
+	syncs := []models.AgentSync{}
+	err := repo.db.DB(ctx).Order("started_at DESC").Limit(limit).Find(&syncs).Error
+	if err != nil {
+		return nil, err
+	}
+	return syncs, nil
+}
+
+func (repo *agentMirrorRepository) LastSuccessfulSync(ctx context.Context) (*models.AgentSync, error) {
+	var sync models.AgentSync
+	err := repo.db.DB(ctx).Where("error = ''").Order("started_at DESC").First(&sync).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sync, nil
+}
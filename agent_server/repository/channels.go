@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	models "github.com/sdutt/agentserver/models/chat"
+	"github.com/sdutt/agentserver/pkg/connectors"
+	"github.com/sdutt/agentserver/pkg/ids"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ChannelRepository interface {
+	// SaveThread records an external message; it reports false when the
+	// message was recorded before.
+	SaveThread(ctx context.Context, thread *models.ChannelThread) (bool, error)
+	// AttachThread files a thread saved without a conversation under one.
+	AttachThread(ctx context.Context, threadID, conversationID string) error
+	// DeleteThread forgets an external message that could not be handled,
+	// so a redelivery is not taken for a duplicate.
+	DeleteThread(ctx context.Context, threadID string) error
+	// FindConversation returns the conversation of the first of externalIDs
+	// that is known, or ErrNotFound.
+	FindConversation(ctx context.Context, channel string, externalIDs []string) (string, error)
+	ListThreads(ctx context.Context, conversationID string) ([]models.ChannelThread, error)
+}
+
+type channelRepository struct {
+	db connectors.SqliteConnector
+}
+
+func NewChannelRepository(db connectors.SqliteConnector) ChannelRepository {
+	return &channelRepository{db}
+}
+
+func (repo *channelRepository) SaveThread(ctx context.Context, thread *models.ChannelThread) (bool, error) {
+	if thread.ID == "" {
+		thread.ID = ids.New()
+	}
+	result := repo.db.DB(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(thread)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (repo *channelRepository) AttachThread(ctx context.Context, threadID, conversationID string) error {
+	return repo.db.DB(ctx).Model(&models.ChannelThread{}).Where("id = ?", threadID).
+		Update("conversation_id", conversationID).Error
+}
+
+func (repo *channelRepository) DeleteThread(ctx context.Context, threadID string) error {
+	return repo.db.DB(ctx).Where("id = ?", threadID).Delete(&models.ChannelThread{}).Error
+}
+
+func (repo *channelRepository) FindConversation(ctx context.Context, channel string, externalIDs []string) (string, error) {
+	if len(externalIDs) == 0 {
+		return "", ErrNotFound
+	}
+	var thread models.ChannelThread
+	err := repo.db.DB(ctx).
+		Where("channel = ? AND external_id IN ? AND conversation_id <> ''", channel, externalIDs).
+		Order("created_at DESC").First(&thread).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return thread.ConversationID, nil
+}
+
+// ListThreads returns the external messages of a conversation, oldest first.
+func (repo *channelRepository) ListThreads(ctx context.Context, conversationID string) ([]models.ChannelThread, error) {
+	threads := []models.ChannelThread{}
+	err := repo.db.DB(ctx).Where("conversation_id = ?", conversationID).Order("created_at").Find(&threads).Error
+	if err != nil {
+		return nil, err
+	}
+	return threads, nil
+}
@@ -0,0 +1,244 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	models "github.com/sdutt/agentserver/models/chat"
+	"github.com/sdutt/agentserver/pkg/connectors"
+	"github.com/sdutt/agentserver/pkg/ids"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrNotFound = errors.New("record not found")
+
+type ConversationRepository interface {
+	CreateConversation(ctx context.Context, conversation *models.Conversation) error
+	GetConversation(ctx context.Context, id string) (*models.Conversation, error)
+	ListConversations(ctx context.Context, from, to time.Time) ([]models.Conversation, error)
+	EscalateConversation(ctx context.Context, conversation *models.Conversation, reason string) error
+	ResolveConversation(ctx context.Context, conversation *models.Conversation, resolution string) error
+	AppendMessage(ctx context.Context, message *models.Message) error
+	GetMessage(ctx context.Context, conversationID, id string) (*models.Message, error)
+	ListMessages(ctx context.Context, conversationID string) ([]models.Message, error)
+	EditMessage(ctx context.Context, message *models.Message, text string, flags []string, editorID string) error
+	DeleteMessage(ctx context.Context, message *models.Message) error
+	ListEdits(ctx context.Context, messageID string) ([]models.MessageEdit, error)
+	SaveSummary(ctx context.Context, conversation *models.Conversation, summary string, upToSeq int64) error
+	SaveContextSnapshot(ctx context.Context, snapshot *models.ContextSnapshot) error
+	GetContextSnapshot(ctx context.Context, messageID string) (*models.ContextSnapshot, error)
+	MarkRead(ctx context.Context, state *models.ReadState) error
+	ListReadStates(ctx context.Context, conversationID string) ([]models.ReadState, error)
+}
+
+type conversationRepository struct {
+	db connectors.SqliteConnector
+}
+
+func NewConversationRepository(db connectors.SqliteConnector) ConversationRepository {
+	return &conversationRepository{db}
+}
+
+func (repo *conversationRepository) CreateConversation(ctx context.Context, conversation *models.Conversation) error {
+	if conversation.ID == "" {
+		conversation.ID = ids.New()
+	}
+	return repo.db.DB(ctx).Create(conversation).Error
+}
+
+func (repo *conversationRepository) GetConversation(ctx context.Context, id string) (*models.Conversation, error) {
+	var conversation models.Conversation
+	err := repo.db.DB(ctx).Where("id = ?", id).First(&conversation).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &conversation, nil
+}
+
+func (repo *conversationRepository) ListConversations(ctx context.Context, from, to time.Time) ([]models.Conversation, error) {
+	var conversations []models.Conversation
+	// times are stored as local-time text and SQLite compares them as text
+	err := repo.db.DB(ctx).
+		Where("created_at >= ? AND created_at < ?", from.Local(), to.Local()).
+		Order("created_at").
+		Find(&conversations).Error
+	return conversations, err
+}
+
+func (repo *conversationRepository) EscalateConversation(ctx context.Context, conversation *models.Conversation, reason string) error {
+	now := time.Now()
+	err := repo.db.DB(ctx).Model(conversation).Updates(map[string]interface{}{
+		"escalated_at":      now,
+		"escalation_reason": reason,
+	}).Error
+	if err != nil {
+		return err
+	}
+	conversation.EscalatedAt = &now
+	conversation.EscalationReason = reason
+	return nil
+}
+
+func (repo *conversationRepository) ResolveConversation(ctx context.Context, conversation *models.Conversation, resolution string) error {
+	now := time.Now()
+	err := repo.db.DB(ctx).Model(conversation).Updates(map[string]interface{}{
+		"resolved_at": now,
+		"resolution":  resolution,
+	}).Error
+	if err != nil {
+		return err
+	}
+	conversation.ResolvedAt = &now
+	conversation.Resolution = resolution
+	return nil
+}
+
+// AppendMessage stores the message at the end of its conversation, assigning
+// the next sequence number inside the same transaction.
+func (repo *conversationRepository) AppendMessage(ctx context.Context, message *models.Message) error {
+	if message.ID == "" {
+		message.ID = ids.New()
+	}
+	return repo.db.DB(ctx).Transaction(func(tx *gorm.DB) error {
+		// deleted messages keep their sequence number
+		var last int64
+		err := tx.Unscoped().Model(&models.Message{}).
+			Where("conversation_id = ?", message.ConversationID).
+			Select("COALESCE(MAX(seq), 0)").
+			Scan(&last).Error
+		if err != nil {
+			return err
+		}
+		message.Seq = last + 1
+		if err := tx.Create(message).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Conversation{}).
+			Where("id = ?", message.ConversationID).
+			Update("updated_at", time.Now()).Error
+	})
+}
+
+func (repo *conversationRepository) ListMessages(ctx context.Context, conversationID string) ([]models.Message, error) {
+	var messages []models.Message
+	err := repo.db.DB(ctx).
+		Where("conversation_id = ?", conversationID).
+		Order("seq").
+		Find(&messages).Error
+	return messages, err
+}
+
+func (repo *conversationRepository) GetMessage(ctx context.Context, conversationID, id string) (*models.Message, error) {
+	var message models.Message
+	err := repo.db.DB(ctx).
+		Where("conversation_id = ? AND id = ?", conversationID, id).
+		First(&message).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// EditMessage replaces the text of message and records the previous text in
+// the edit history.
+func (repo *conversationRepository) EditMessage(ctx context.Context, message *models.Message, text string, flags []string, editorID string) error {
+	return repo.db.DB(ctx).Transaction(func(tx *gorm.DB) error {
+		edit := &models.MessageEdit{
+			ID:           ids.New(),
+			MessageID:    message.ID,
+			EditorID:     editorID,
+			PreviousText: message.Text,
+		}
+		if err := tx.Create(edit).Error; err != nil {
+			return err
+		}
+		now := time.Now()
+		err := tx.Model(message).
+			Select("text", "edited_at", "moderation_flags").
+			Updates(&models.Message{Text: text, EditedAt: &now, ModerationFlags: flags}).Error
+		if err != nil {
+			return err
+		}
+		message.Text = text
+		message.EditedAt = &now
+		message.ModerationFlags = flags
+		return nil
+	})
+}
+
+func (repo *conversationRepository) DeleteMessage(ctx context.Context, message *models.Message) error {
+	return repo.db.DB(ctx).Delete(message).Error
+}
+
+func (repo *conversationRepository) ListEdits(ctx context.Context, messageID string) ([]models.MessageEdit, error) {
+	var edits []models.MessageEdit
+	err := repo.db.DB(ctx).
+		Where("message_id = ?", messageID).
+		Order("created_at").
+		Find(&edits).Error
+	return edits, err
+}
+
+func (repo *conversationRepository) SaveSummary(ctx context.Context, conversation *models.Conversation, summary string, upToSeq int64) error {
+	// a summary never replaces one covering more of the conversation
+	err := repo.db.DB(ctx).Model(conversation).
+		Where("summary_up_to_seq < ?", upToSeq).
+		Updates(map[string]interface{}{
+			"summary":           summary,
+			"summary_up_to_seq": upToSeq,
+		}).Error
+	if err != nil {
+		return err
+	}
+	conversation.Summary = summary
+	conversation.SummaryUpToSeq = upToSeq
+	return nil
+}
+
+func (repo *conversationRepository) SaveContextSnapshot(ctx context.Context, snapshot *models.ContextSnapshot) error {
+	if snapshot.ID == "" {
+		snapshot.ID = ids.New()
+	}
+	return repo.db.DB(ctx).Create(snapshot).Error
+}
+
+func (repo *conversationRepository) GetContextSnapshot(ctx context.Context, messageID string) (*models.ContextSnapshot, error) {
+	var snapshot models.ContextSnapshot
+	err := repo.db.DB(ctx).Where("message_id = ?", messageID).First(&snapshot).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// MarkRead moves the participant's read position forward; an older receipt
+// arriving late leaves it unchanged.
+func (repo *conversationRepository) MarkRead(ctx context.Context, state *models.ReadState) error {
+	return repo.db.DB(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "conversation_id"}, {Name: "participant_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"participant_role", "last_read_message_id", "last_read_seq", "read_at"}),
+		Where: clause.Where{Exprs: []clause.Expression{
+			clause.Expr{SQL: "excluded.last_read_seq > read_states.last_read_seq"},
+		}},
+	}).Create(state).Error
+}
+
+func (repo *conversationRepository) ListReadStates(ctx context.Context, conversationID string) ([]models.ReadState, error) {
+	var states []models.ReadState
+	err := repo.db.DB(ctx).
+		Where("conversation_id = ?", conversationID).
+		Order("participant_id").
+		Find(&states).Error
+	return states, err
+}
@@ -0,0 +1,75 @@
+package repository_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	models "github.com/sdutt/agentserver/models/chat"
+	"github.com/sdutt/agentserver/pkg/dbtest"
+	"github.com/sdutt/agentserver/repository"
+)
+
+func TestConcurrentAppendsKeepEveryMessage(t *testing.T) {
+	repo := repository.NewConversationRepository(dbtest.Open(t))
+	ctx := context.Background()
+	conversation := &models.Conversation{ID: "c1", AgentID: "a1", UserID: "u1"}
+	if err := repo.CreateConversation(ctx, conversation); err != nil {
+		t.Fatal(err)
+	}
+
+	const writers, each = 20, 10
+	var wg sync.WaitGroup
+	errs := make(chan error, writers*each)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < each; j++ {
+				errs <- repo.AppendMessage(ctx, &models.Message{ConversationID: conversation.ID, Role: models.RoleUser, SenderID: "u1", Text: "hi"})
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	messages, err := repo.ListMessages(ctx, conversation.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != writers*each {
+		t.Fatalf("got %d messages, want %d", len(messages), writers*each)
+	}
+	for i, message := range messages {
+		if message.Seq != int64(i+1) {
+			t.Fatalf("message %d has seq %d", i, message.Seq)
+		}
+	}
+}
+
+func TestListConversationsAcrossTimeZones(t *testing.T) {
+	local := time.Local
+	time.Local = time.FixedZone("UTC+5", 5*60*60)
+	t.Cleanup(func() { time.Local = local })
+
+	repo := repository.NewConversationRepository(dbtest.Open(t))
+	ctx := context.Background()
+	if err := repo.CreateConversation(ctx, &models.Conversation{ID: "c1", AgentID: "a1", UserID: "u1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	conversations, err := repo.ListConversations(ctx, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conversations) != 1 {
+		t.Errorf("got %d conversations, want the one created now", len(conversations))
+	}
+}
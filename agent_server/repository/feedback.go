@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	models "github.com/sdutt/agentserver/models/chat"
+	"github.com/sdutt/agentserver/pkg/connectors"
+	"github.com/sdutt/agentserver/pkg/ids"
+	"gorm.io/gorm/clause"
+)
+
+type FeedbackCount struct {
+	Up    int64   `json:"up"`
+	Down  int64   `json:"down"`
+	Ratio float64 `json:"ratio"`
+}
+
+type FeedbackAggregate struct {
+	AgentID string `json:"agent_id"`
+	FeedbackCount
+	ByReason   map[string]int64         `json:"by_reason"`
+	ByRevision map[string]FeedbackCount `json:"by_revision"`
+}
+
+type FeedbackRepository interface {
+	SaveFeedback(ctx context.Context, feedback *models.Feedback) error
+	AggregateFeedback(ctx context.Context, agentID string, from, to time.Time) (*FeedbackAggregate, error)
+}
+
+type feedbackRepository struct {
+	db connectors.SqliteConnector
+}
+
+func NewFeedbackRepository(db connectors.SqliteConnector) FeedbackRepository {
+	return &feedbackRepository{db}
+}
+
+// SaveFeedback inserts the rating or replaces the user's earlier rating of
+// the same message.
+func (repo *feedbackRepository) SaveFeedback(ctx context.Context, feedback *models.Feedback) error {
+	if feedback.ID == "" {
+		feedback.ID = ids.New()
+	}
+	db := repo.db.DB(ctx)
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "message_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rating", "reason", "comment", "updated_at"}),
+	}).Create(feedback).Error
+	if err != nil {
+		return err
+	}
+	// on conflict the stored row keeps its original id and created_at
+	var stored models.Feedback
+	err = db.Where("message_id = ? AND user_id = ?", feedback.MessageID, feedback.UserID).First(&stored).Error
+	if err != nil {
+		return err
+	}
+	*feedback = stored
+	return nil
+}
+
+func (repo *feedbackRepository) AggregateFeedback(ctx context.Context, agentID string, from, to time.Time) (*FeedbackAggregate, error) {
+	q := repo.db.DB(ctx).Model(&models.Feedback{}).Where("agent_id = ?", agentID)
+	// times are stored as local-time text and SQLite compares them as text
+	if !from.IsZero() {
+		q = q.Where("created_at >= ?", from.Local())
+	}
+	if !to.IsZero() {
+		q = q.Where("created_at < ?", to.Local())
+	}
+	var rows []struct {
+		AgentRevision string
+		Rating        string
+		Reason        string
+		Count         int64
+	}
+	err := q.Select("agent_revision, rating, reason, count(*) AS count").
+		Group("agent_revision, rating, reason").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	aggregate := &FeedbackAggregate{
+		AgentID:    agentID,
+		ByReason:   map[string]int64{},
+		ByRevision: map[string]FeedbackCount{},
+	}
+	for _, row := range rows {
+		revision := aggregate.ByRevision[row.AgentRevision]
+		switch row.Rating {
+		case models.RatingUp:
+			aggregate.Up += row.Count
+			revision.Up += row.Count
+		case models.RatingDown:
+			aggregate.Down += row.Count
+			revision.Down += row.Count
+		}
+		aggregate.ByRevision[row.AgentRevision] = revision
+		if row.Reason != "" {
+			aggregate.ByReason[row.Reason] += row.Count
+		}
+	}
+	aggregate.Ratio = ratio(aggregate.Up, aggregate.Down)
+	for key, revision := range aggregate.ByRevision {
+		revision.Ratio = ratio(revision.Up, revision.Down)
+		aggregate.ByRevision[key] = revision
+	}
+	return aggregate, nil
+}
+
+// ratio is the share of positive ratings, 0 when there are none.
+func ratio(up, down int64) float64 {
+	if up+down == 0 {
+		return 0
+	}
+	return float64(up) / float64(up+down)
+}
@@ -0,0 +1,238 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	models "github.com/sdutt/agentserver/models/jobs"
+	"github.com/sdutt/agentserver/pkg/connectors"
+	"github.com/sdutt/agentserver/pkg/ids"
+	"gorm.io/gorm"
+)
+
+// ErrNotRetryable is returned when requeueing a job that is still queued
+// or running.
+var ErrNotRetryable = errors.New("only finished jobs can be retried")
+
+type JobFilter struct {
+	Status string
+	Kind   string
+	Limit  int
+	Offset int
+}
+
+type JobRepository interface {
+	Enqueue(ctx context.Context, job *models.Job) error
+	// Claim locks the next due job of one of kinds for visibility and
+	// returns it, or nil when there is none.
+	Claim(ctx context.Context, kinds []string, visibility time.Duration) (*models.Job, error)
+	Complete(ctx context.Context, job *models.Job, result string) error
+	// Fail records a failed attempt, scheduling the job again at retryAt or
+	// dead-lettering it when retryAt is zero.
+	Fail(ctx context.Context, job *models.Job, reason string, retryAt time.Time) error
+	// Release hands a claimed job back without counting the attempt.
+	Release(ctx context.Context, job *models.Job) error
+	Requeue(ctx context.Context, id string) (*models.Job, error)
+	GetJob(ctx context.Context, id string) (*models.Job, error)
+	ListJobs(ctx context.Context, filter JobFilter) ([]models.Job, int64, error)
+	CountJobs(ctx context.Context) (map[string]int64, error)
+}
+
+type jobRepository struct {
+	db connectors.SqliteConnector
+}
+
+func NewJobRepository(db connectors.SqliteConnector) JobRepository {
+	return &jobRepository{db}
+}
+
+func (repo *jobRepository) Enqueue(ctx context.Context, job *models.Job) error {
+	if job.ID == "" {
+		job.ID = ids.New()
+	}
+	job.Status = models.StatusPending
+	if job.RunAt.IsZero() {
+		job.RunAt = time.Now()
+	}
+	return repo.db.DB(ctx).Create(job).Error
+}
+
+func (repo *jobRepository) Claim(ctx context.Context, kinds []string, visibility time.Duration) (*models.Job, error) {
+	if len(kinds) == 0 {
+		return nil, nil
+	}
+	db := repo.db.DB(ctx)
+	now := time.Now()
+	// attempts that outlived their visibility timeout count as failed
+	err := db.Model(&models.Job{}).
+		Where("status = ? AND locked_until < ? AND attempts >= max_attempts", models.StatusRunning, now).
+		Updates(map[string]interface{}{
+			"status":       models.StatusDead,
+			"last_error":   "visibility timeout expired",
+			"locked_by":    "",
+			"locked_until": nil,
+			"finished_at":  now,
+		}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// a single UPDATE keeps concurrent workers from claiming the same row
+	token := ids.New()
+	due := db.Model(&models.Job{}).Select("id").
+		Where("kind IN ?", kinds).
+		Where("(status = ? AND run_at <= ?) OR (status = ? AND locked_until < ?)", models.StatusPending, now, models.StatusRunning, now).
+		Order("run_at").Limit(1)
+	result := db.Model(&models.Job{}).Where("id = (?)", due).Updates(map[string]interface{}{
+		"status":       models.StatusRunning,
+		"attempts":     gorm.Expr("attempts + 1"),
+		"locked_by":    token,
+		"locked_until": now.Add(visibility),
+	})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	var job models.Job
+	if err := db.Where("locked_by = ?", token).First(&job).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (repo *jobRepository) Complete(ctx context.Context, job *models.Job, result string) error {
+	now := time.Now()
+	return repo.finish(ctx, job, map[string]interface{}{
+		"status":       models.StatusSucceeded,
+		"result":       result,
+		"last_error":   "",
+		"locked_by":    "",
+		"locked_until": nil,
+		"finished_at":  now,
+	})
+}
+
+func (repo *jobRepository) Fail(ctx context.Context, job *models.Job, reason string, retryAt time.Time) error {
+	updates := map[string]interface{}{
+		"status":       models.StatusPending,
+		"last_error":   reason,
+		"run_at":       retryAt,
+		"locked_by":    "",
+		"locked_until": nil,
+	}
+	if retryAt.IsZero() {
+		updates["status"] = models.StatusDead
+		updates["run_at"] = job.RunAt
+		updates["finished_at"] = time.Now()
+	}
+	return repo.finish(ctx, job, updates)
+}
+
+func (repo *jobRepository) Release(ctx context.Context, job *models.Job) error {
+	return repo.finish(ctx, job, map[string]interface{}{
+		"status":       models.StatusPending,
+		"attempts":     gorm.Expr("attempts - 1"),
+		"locked_by":    "",
+		"locked_until": nil,
+	})
+}
+
+// finish applies updates unless the claim was lost to another worker after
+// the visibility timeout.
+func (repo *jobRepository) finish(ctx context.Context, job *models.Job, updates map[string]interface{}) error {
+	result := repo.db.DB(ctx).Model(&models.Job{}).
+		Where("id = ? AND locked_by = ?", job.ID, job.LockedBy).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Requeue runs a dead or succeeded job again with a fresh set of attempts.
+func (repo *jobRepository) Requeue(ctx context.Context, id string) (*models.Job, error) {
+	job, err := repo.GetJob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != models.StatusDead && job.Status != models.StatusSucceeded {
+		return nil, ErrNotRetryable
+	}
+	result := repo.db.DB(ctx).Model(&models.Job{}).
+		Where("id = ? AND status = ?", job.ID, job.Status).
+		Updates(map[string]interface{}{
+			"status":      models.StatusPending,
+			"attempts":    0,
+			"run_at":      time.Now(),
+			"last_error":  "",
+			"result":      "",
+			"finished_at": nil,
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrNotRetryable
+	}
+	return repo.GetJob(ctx, id)
+}
+
+func (repo *jobRepository) GetJob(ctx context.Context, id string) (*models.Job, error) {
+	var job models.Job
+	err := repo.db.DB(ctx).Where("id = ?", id).First(&job).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (repo *jobRepository) ListJobs(ctx context.Context, filter JobFilter) ([]models.Job, int64, error) {
+	query := repo.db.DB(ctx).Model(&models.Job{})
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Kind != "" {
+		query = query.Where("kind = ?", filter.Kind)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	jobs := []models.Job{}
+	err := query.Order("created_at DESC").Limit(filter.Limit).Offset(filter.Offset).Find(&jobs).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return jobs, total, nil
+}
+
+func (repo *jobRepository) CountJobs(ctx context.Context) (map[string]int64, error) {
+	var rows []struct {
+		Status string
+		Count  int64
+	}
+	err := repo.db.DB(ctx).Model(&models.Job{}).
+		Select("status, COUNT(*) AS count").Group("status").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]int64{
+		models.StatusPending:   0,
+		models.StatusRunning:   0,
+		models.StatusSucceeded: 0,
+		models.StatusDead:      0,
+	}
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
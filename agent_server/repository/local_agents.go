@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	models "github.com/sdutt/agentserver/models/agents"
+	"github.com/sdutt/agentserver/pkg/connectors"
+	"github.com/sdutt/agentserver/pkg/ids"
+	"gorm.io/gorm"
+)
+
+type LocalAgentRepository interface {
+	CreateAgent(ctx context.Context, agent *models.LocalAgent) error
+	GetAgent(ctx context.Context, id string) (*models.LocalAgent, error)
+	// ListAgents returns the agents of provider, or of every provider if
+	// it is empty.
+	ListAgents(ctx context.Context, provider string) ([]models.LocalAgent, error)
+	UpdateAgent(ctx context.Context, agent *models.LocalAgent) error
+	DeleteAgent(ctx context.Context, id string) error
+}
+
+type localAgentRepository struct {
+	db connectors.SqliteConnector
+}
+
+func NewLocalAgentRepository(db connectors.SqliteConnector) LocalAgentRepository {
+	return &localAgentRepository{db}
+}
+
+func (repo *localAgentRepository) CreateAgent(ctx context.Context, agent *models.LocalAgent) error {
+	if agent.ID == "" {
+		agent.ID = ids.New()
+	}
+	return repo.db.DB(ctx).Create(agent).Error
+}
+
+func (repo *localAgentRepository) GetAgent(ctx context.Context, id string) (*models.LocalAgent, error) {
+	var agent models.LocalAgent
+	err := repo.db.DB(ctx).Where("id = ?", id).First(&agent).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &agent, nil
+}
+
+func (repo *localAgentRepository) ListAgents(ctx context.Context, provider string) ([]models.LocalAgent, error) {
+	query := repo.db.DB(ctx).Order("created_at")
+	if provider != "" {
+		query = query.Where("provider = ?", provider)
+	}
+	agents := []models.LocalAgent{}
+	if err := query.Find(&agents).Error; err != nil {
+		return nil, err
+	}
+	return agents, nil
+}
+
+func (repo *localAgentRepository) UpdateAgent(ctx context.Context, agent *models.LocalAgent) error {
+	return repo.db.DB(ctx).Model(agent).Select("payload").Updates(agent).Error
+}
+
+func (repo *localAgentRepository) DeleteAgent(ctx context.Context, id string) error {
+	result := repo.db.DB(ctx).Where("id = ?", id).Delete(&models.LocalAgent{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	models "github.com/sdutt/agentserver/models/chat"
+	"github.com/sdutt/agentserver/pkg/connectors"
+)
+
+// AgentActivity is the raw chat data of one agent inside a time window.
+type AgentActivity struct {
+	Conversations []models.Conversation
+	Messages      []ActivityMessage
+	Calls         []models.AgentCall
+	Feedback      []ActivityFeedback
+	// FirstCalls holds the earliest agent call of every conversation above,
+	// even when it was made before the window.
+	FirstCalls []ActivityCall
+}
+
+type ActivityCall struct {
+	ConversationID string
+	AgentModel     string
+	AgentRevision  string
+}
+
+type ActivityMessage struct {
+	ConversationID string
+	Role           string
+	CreatedAt      time.Time
+}
+
+type ActivityFeedback struct {
+	ConversationID string
+	AgentRevision  string
+	AgentModel     string
+	Rating         string
+	CreatedAt      time.Time
+}
+
+type MetricsRepository interface {
+	AgentActivity(ctx context.Context, agentID string, from, to time.Time) (*AgentActivity, error)
+}
+
+type metricsRepository struct {
+	db connectors.SqliteConnector
+}
+
+func NewMetricsRepository(db connectors.SqliteConnector) MetricsRepository {
+	return &metricsRepository{db}
+}
+
+func (repo *metricsRepository) AgentActivity(ctx context.Context, agentID string, from, to time.Time) (*AgentActivity, error) {
+	db := repo.db.DB(ctx)
+	var activity AgentActivity
+	// times are stored as local-time text and SQLite compares them as text
+	from, to = from.Local(), to.Local()
+
+	err := db.Where("agent_id = ? AND created_at >= ? AND created_at < ?", agentID, from, to).
+		Find(&activity.Conversations).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Table("messages").
+		Select("messages.conversation_id, messages.role, messages.created_at").
+		Joins("JOIN conversations ON conversations.id = messages.conversation_id").
+		Where("conversations.agent_id = ? AND messages.created_at >= ? AND messages.created_at < ?", agentID, from, to).
+		Where("messages.deleted_at IS NULL").
+		Scan(&activity.Messages).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Where("agent_id = ? AND created_at >= ? AND created_at < ?", agentID, from, to).
+		Order("created_at").
+		Find(&activity.Calls).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Table("feedbacks").
+		Select("feedbacks.conversation_id, feedbacks.agent_revision, messages.agent_model, feedbacks.rating, feedbacks.created_at").
+		Joins("LEFT JOIN messages ON messages.id = feedbacks.message_id").
+		Where("feedbacks.agent_id = ? AND feedbacks.created_at >= ? AND feedbacks.created_at < ?", agentID, from, to).
+		Scan(&activity.Feedback).Error
+	if err != nil {
+		return nil, err
+	}
+
+	active := db.Raw(`SELECT id FROM conversations WHERE agent_id = ? AND created_at >= ? AND created_at < ?
+		UNION SELECT messages.conversation_id FROM messages
+		JOIN conversations ON conversations.id = messages.conversation_id
+		WHERE conversations.agent_id = ? AND messages.created_at >= ? AND messages.created_at < ?`,
+		agentID, from, to, agentID, from, to)
+	err = db.Table("agent_calls AS calls").
+		Select("calls.conversation_id, calls.agent_model, calls.agent_revision").
+		Where("calls.conversation_id IN (?)", active).
+		Where("calls.created_at = (SELECT MIN(created_at) FROM agent_calls WHERE conversation_id = calls.conversation_id)").
+		Scan(&activity.FirstCalls).Error
+	if err != nil {
+		return nil, err
+	}
+	return &activity, nil
+}
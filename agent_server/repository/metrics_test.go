@@ -0,0 +1,34 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	models "github.com/sdutt/agentserver/models/chat"
+	"github.com/sdutt/agentserver/pkg/dbtest"
+	"github.com/sdutt/agentserver/repository"
+)
+
+func TestAgentActivityAcrossTimeZones(t *testing.T) {
+	// stored times carry the offset of the host
+	local := time.Local
+	time.Local = time.FixedZone("UTC+5", 5*60*60)
+	t.Cleanup(func() { time.Local = local })
+
+	db := dbtest.Open(t)
+	ctx := context.Background()
+	conversation := &models.Conversation{ID: "c1", AgentID: "a1", UserID: "u1"}
+	if err := repository.NewConversationRepository(db).CreateConversation(ctx, conversation); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	activity, err := repository.NewMetricsRepository(db).AgentActivity(ctx, "a1", now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(activity.Conversations) != 1 {
+		t.Errorf("got %d conversations, want the one created now", len(activity.Conversations))
+	}
+}
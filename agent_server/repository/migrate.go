@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+
+	agents "github.com/sdutt/agentserver/models/agents"
+	models "github.com/sdutt/agentserver/models/chat"
+	jobs "github.com/sdutt/agentserver/models/jobs"
+	webhooks "github.com/sdutt/agentserver/models/webhooks"
+	widgets "github.com/sdutt/agentserver/models/widgets"
+	"github.com/sdutt/agentserver/pkg/connectors"
+)
+
+// Migrate creates or updates the tables backing the repositories. likeSearch
+// lets it succeed on a sqlite build without FTS5.
+func Migrate(ctx context.Context, db connectors.SqliteConnector, likeSearch bool) error {
+	err := db.DB(ctx).AutoMigrate(
+		&models.Conversation{},
+		&models.Message{},
+		&models.MessageEdit{},
+		&models.Feedback{},
+		&models.AgentCall{},
+		&models.ContextSnapshot{},
+		&models.ReadState{},
+		&models.ChannelThread{},
+		&jobs.Job{},
+		&webhooks.Subscription{},
+		&webhooks.Delivery{},
+		&webhooks.DeliveryAttempt{},
+		&webhooks.InboundDelivery{},
+		&widgets.Widget{},
+		&widgets.VisitorSession{},
+		&agents.LocalAgent{},
+		&agents.MirroredAgent{},
+		&agents.AgentSync{},
+	)
+	if err != nil {
+		return err
+	}
+	return migrateSearchIndex(db.DB(ctx), likeSearch)
+}
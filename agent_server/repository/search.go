@@ -0,0 +1,333 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sdutt/agentserver/pkg/connectors"
+	"gorm.io/gorm"
+)
+
+var ErrInvalidQuery = errors.New("invalid search query")
+
+// Snippets are HTML: the message text is escaped and matches are wrapped
+// in mark elements.
+const (
+	highlightStart = "<mark>"
+	highlightEnd   = "</mark>"
+)
+
+// snippet() of FTS5 cannot escape, so it marks matches with control
+// characters that are swapped for the mark elements after escaping.
+const (
+	ftsMarkStart = "\x02"
+	ftsMarkEnd   = "\x03"
+)
+
+// ErrNoFTS5 is returned by Migrate when sqlite was built without the
+// sqlite_fts5 tag and the LIKE fallback is not enabled.
+var ErrNoFTS5 = errors.New("sqlite built without fts5, build with -tags sqlite_fts5 or set DB__LIKE_SEARCH=true")
+
+// The FTS5 index mirrors messages.text through triggers, so it is updated in
+// the same transaction as the message rows themselves. It is keyed on
+// messages.search_rowid rather than the implicit rowid, which VACUUM may
+// renumber on a table with a string primary key.
+var searchIndexStatements = []string{
+	`CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(text, content='messages', content_rowid='search_rowid')`,
+	`CREATE TRIGGER IF NOT EXISTS messages_fts_ai AFTER INSERT ON messages BEGIN
+		UPDATE messages SET search_rowid = (SELECT COALESCE(MAX(search_rowid), 0) + 1 FROM messages)
+			WHERE id = new.id AND search_rowid IS NULL;
+		INSERT INTO messages_fts(rowid, text) SELECT search_rowid, text FROM messages WHERE id = new.id;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS messages_fts_ad AFTER DELETE ON messages BEGIN
+		INSERT INTO messages_fts(messages_fts, rowid, text) VALUES ('delete', old.search_rowid, old.text);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS messages_fts_au AFTER UPDATE OF text ON messages BEGIN
+		INSERT INTO messages_fts(messages_fts, rowid, text) VALUES ('delete', old.search_rowid, old.text);
+		INSERT INTO messages_fts(rowid, text) VALUES (new.search_rowid, new.text);
+	END`,
+}
+
+// Statements dropping an index left by an older schema, keyed on the implicit
+// rowid.
+var legacySearchIndexStatements = []string{
+	`DROP TRIGGER IF EXISTS messages_fts_ai`,
+	`DROP TRIGGER IF EXISTS messages_fts_ad`,
+	`DROP TRIGGER IF EXISTS messages_fts_au`,
+	`DROP TABLE IF EXISTS messages_fts`,
+}
+
+// migrateSearchIndex creates the FTS5 index. sqlite has to be built with the
+// sqlite_fts5 tag; without it migration fails unless likeSearch allows
+// search to fall back to LIKE.
+func migrateSearchIndex(db *gorm.DB, likeSearch bool) error {
+	var sql string
+	err := db.Raw(`SELECT COALESCE(MAX(sql), '') FROM sqlite_master WHERE name = 'messages_fts'`).Scan(&sql).Error
+	if err != nil {
+		return err
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		rebuild := sql == ""
+		if sql != "" && !strings.Contains(sql, "search_rowid") {
+			for _, stmt := range legacySearchIndexStatements {
+				if err := tx.Exec(stmt).Error; err != nil {
+					return err
+				}
+			}
+			rebuild = true
+		}
+		// number the messages stored before the index existed
+		var last int64
+		if err := tx.Raw(`SELECT COALESCE(MAX(search_rowid), 0) FROM messages`).Scan(&last).Error; err != nil {
+			return err
+		}
+		err := tx.Exec(`UPDATE messages SET search_rowid = ? + rowid WHERE search_rowid IS NULL`, last).Error
+		if err != nil {
+			return err
+		}
+		for _, stmt := range searchIndexStatements {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		if rebuild {
+			return tx.Exec(`INSERT INTO messages_fts(messages_fts) VALUES ('rebuild')`).Error
+		}
+		return nil
+	})
+	if err != nil && strings.Contains(err.Error(), "no such module: fts5") {
+		if !likeSearch {
+			return ErrNoFTS5
+		}
+		log.Printf("sqlite built without fts5, message search falls back to LIKE")
+		return nil
+	}
+	return err
+}
+
+type SearchQuery struct {
+	Query       string
+	AgentID     string
+	UserID      string
+	WorkspaceID string
+	From        time.Time
+	To          time.Time
+	Limit       int
+	Offset      int
+}
+
+type SearchHit struct {
+	MessageID      string    `json:"message_id"`
+	ConversationID string    `json:"conversation_id"`
+	Seq            int64     `json:"seq"`
+	Role           string    `json:"role"`
+	AgentID        string    `json:"agent_id"`
+	UserID         string    `json:"user_id"`
+	WorkspaceID    string    `json:"workspace_id"`
+	Snippet        string    `json:"snippet"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type SearchResult struct {
+	Hits  []SearchHit `json:"results"`
+	Total int64       `json:"total"`
+}
+
+type SearchRepository interface {
+	SearchMessages(ctx context.Context, query SearchQuery) (*SearchResult, error)
+}
+
+type searchRepository struct {
+	db connectors.SqliteConnector
+}
+
+func NewSearchRepository(db connectors.SqliteConnector) SearchRepository {
+	return &searchRepository{db}
+}
+
+func (repo *searchRepository) SearchMessages(ctx context.Context, query SearchQuery) (*SearchResult, error) {
+	db := repo.db.DB(ctx)
+	var indexed int64
+	if err := db.Raw(`SELECT count(*) FROM sqlite_master WHERE name = 'messages_fts'`).Scan(&indexed).Error; err != nil {
+		return nil, err
+	}
+	if indexed == 0 {
+		return repo.searchLike(db, query)
+	}
+	return repo.searchFTS(db, query)
+}
+
+func (repo *searchRepository) searchFTS(db *gorm.DB, query SearchQuery) (*SearchResult, error) {
+	base := func() *gorm.DB {
+		q := db.Table("messages_fts").
+			Joins("JOIN messages ON messages.search_rowid = messages_fts.rowid").
+			Joins("JOIN conversations ON conversations.id = messages.conversation_id").
+			Where("messages_fts MATCH ?", query.Query)
+		return applySearchFilters(q, query)
+	}
+
+	var result SearchResult
+	if err := base().Count(&result.Total).Error; err != nil {
+		return nil, searchError(err)
+	}
+	snippet := "snippet(messages_fts, 0, char(2), char(3), '…', 16) AS snippet"
+	err := base().
+		Select("messages.id AS message_id, messages.conversation_id, messages.seq, messages.role, messages.created_at, " +
+			"conversations.agent_id, conversations.user_id, conversations.workspace_id, " + snippet).
+		Order("bm25(messages_fts)").
+		Limit(query.Limit).
+		Offset(query.Offset).
+		Scan(&result.Hits).Error
+	if err != nil {
+		return nil, searchError(err)
+	}
+	for i := range result.Hits {
+		result.Hits[i].Snippet = markFTS(result.Hits[i].Snippet)
+	}
+	return &result, nil
+}
+
+// searchLike matches every bare term of the query as a substring. Operators
+// of the FTS5 syntax are ignored.
+func (repo *searchRepository) searchLike(db *gorm.DB, query SearchQuery) (*SearchResult, error) {
+	terms := searchTerms(query.Query)
+	if len(terms) == 0 {
+		return nil, ErrInvalidQuery
+	}
+	base := func() *gorm.DB {
+		q := db.Table("messages").
+			Joins("JOIN conversations ON conversations.id = messages.conversation_id")
+		for _, term := range terms {
+			q = q.Where(`messages.text LIKE ? ESCAPE '\'`, "%"+escapeLike(term)+"%")
+		}
+		return applySearchFilters(q, query)
+	}
+
+	var result SearchResult
+	if err := base().Count(&result.Total).Error; err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		SearchHit
+		Text string
+	}
+	err := base().
+		Select("messages.id AS message_id, messages.conversation_id, messages.seq, messages.role, messages.created_at, " +
+			"conversations.agent_id, conversations.user_id, conversations.workspace_id, messages.text").
+		Order("messages.created_at DESC").
+		Limit(query.Limit).
+		Offset(query.Offset).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	result.Hits = make([]SearchHit, 0, len(rows))
+	for _, row := range rows {
+		hit := row.SearchHit
+		hit.Snippet = highlight(row.Text, terms)
+		result.Hits = append(result.Hits, hit)
+	}
+	return &result, nil
+}
+
+func applySearchFilters(q *gorm.DB, query SearchQuery) *gorm.DB {
+	q = q.Where("messages.deleted_at IS NULL")
+	if query.AgentID != "" {
+		q = q.Where("conversations.agent_id = ?", query.AgentID)
+	}
+	if query.UserID != "" {
+		q = q.Where("conversations.user_id = ?", query.UserID)
+	}
+	if query.WorkspaceID != "" {
+		q = q.Where("conversations.workspace_id = ?", query.WorkspaceID)
+	}
+	// times are stored as local-time text and SQLite compares them as text
+	if !query.From.IsZero() {
+		q = q.Where("messages.created_at >= ?", query.From.Local())
+	}
+	if !query.To.IsZero() {
+		q = q.Where("messages.created_at < ?", query.To.Local())
+	}
+	return q
+}
+
+func searchError(err error) error {
+	msg := err.Error()
+	if strings.Contains(msg, "fts5: syntax error") || strings.Contains(msg, "unterminated string") || strings.Contains(msg, "no such column") {
+		return fmt.Errorf("%w: %s", ErrInvalidQuery, msg)
+	}
+	return err
+}
+
+var termPattern = regexp.MustCompile(`[\p{L}\p{N}_\-#]+`)
+
+func searchTerms(query string) []string {
+	var terms []string
+	for _, term := range termPattern.FindAllString(query, -1) {
+		switch term {
+		case "AND", "OR", "NOT", "NEAR":
+			continue
+		}
+		terms = append(terms, term)
+	}
+	return terms
+}
+
+// highlight cuts a window around the first matching term and marks every
+// term occurrence inside it.
+func highlight(text string, terms []string) string {
+	const window = 60
+	lower := strings.ToLower(text)
+	first := -1
+	for _, term := range terms {
+		if i := strings.Index(lower, strings.ToLower(term)); i >= 0 && (first < 0 || i < first) {
+			first = i
+		}
+	}
+	start := max(first-window, 0)
+	end := min(start+3*window, len(text))
+	// keep the cut on rune boundaries
+	for start > 0 && start < len(text) && !isRuneStart(text[start]) {
+		start--
+	}
+	for end < len(text) && !isRuneStart(text[end]) {
+		end++
+	}
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = regexp.QuoteMeta(term)
+	}
+	marker := regexp.MustCompile(`(?i)(` + strings.Join(quoted, "|") + `)`)
+	var b strings.Builder
+	last := start
+	for _, match := range marker.FindAllStringIndex(text[start:end], -1) {
+		b.WriteString(html.EscapeString(text[last : start+match[0]]))
+		b.WriteString(highlightStart + html.EscapeString(text[start+match[0]:start+match[1]]) + highlightEnd)
+		last = start + match[1]
+	}
+	b.WriteString(html.EscapeString(text[last:end]))
+	snippet := b.String()
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(text) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+// markFTS escapes a snippet made by FTS5 and marks its matches.
+func markFTS(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	return strings.NewReplacer(ftsMarkStart, highlightStart, ftsMarkEnd, highlightEnd).Replace(snippet)
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
@@ -0,0 +1,41 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+
+	models "github.com/sdutt/agentserver/models/chat"
+	"github.com/sdutt/agentserver/pkg/dbtest"
+	"github.com/sdutt/agentserver/repository"
+)
+
+func TestSnippetsEscapeMessageText(t *testing.T) {
+	for _, index := range []string{"fts", "like"} {
+		t.Run(index, func(t *testing.T) {
+			db := dbtest.Open(t)
+			ctx := context.Background()
+			conversations := repository.NewConversationRepository(db)
+			if err := conversations.CreateConversation(ctx, &models.Conversation{ID: "c1", AgentID: "a1", UserID: "u1"}); err != nil {
+				t.Fatal(err)
+			}
+			message := &models.Message{ConversationID: "c1", Role: models.RoleUser, SenderID: "u1", Text: `<img src=x onerror=alert(1)> invoice & refund`}
+			if err := conversations.AppendMessage(ctx, message); err != nil {
+				t.Fatal(err)
+			}
+			if index == "like" {
+				if err := db.DB(ctx).Exec("DROP TABLE messages_fts").Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			result, err := repository.NewSearchRepository(db).SearchMessages(ctx, repository.SearchQuery{Query: "invoice", Limit: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := `&lt;img src=x onerror=alert(1)&gt; <mark>invoice</mark> &amp; refund`
+			if len(result.Hits) != 1 || result.Hits[0].Snippet != want {
+				t.Errorf("got %+v, want the snippet %s", result.Hits, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	models "github.com/sdutt/agentserver/models/webhooks"
+	"github.com/sdutt/agentserver/pkg/connectors"
+	"github.com/sdutt/agentserver/pkg/ids"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type WebhookRepository interface {
+	CreateSubscription(ctx context.Context, sub *models.Subscription) error
+	GetSubscription(ctx context.Context, id string) (*models.Subscription, error)
+	ListSubscriptions(ctx context.Context, workspaceID string) ([]models.Subscription, error)
+	// MatchSubscriptions returns the active subscriptions of the workspace,
+	// and the global ones without a workspace, that want event.
+	MatchSubscriptions(ctx context.Context, workspaceID, event string) ([]models.Subscription, error)
+	UpdateSubscription(ctx context.Context, sub *models.Subscription) error
+	DeleteSubscription(ctx context.Context, id string) error
+	CreateDelivery(ctx context.Context, delivery *models.Delivery) error
+	GetDelivery(ctx context.Context, id string) (*models.Delivery, error)
+	ListDeliveries(ctx context.Context, subscriptionID string, limit, offset int) ([]models.Delivery, int64, error)
+	UpdateDelivery(ctx context.Context, delivery *models.Delivery) error
+	RecordAttempt(ctx context.Context, attempt *models.DeliveryAttempt) error
+	ListAttempts(ctx context.Context, deliveryID string) ([]models.DeliveryAttempt, error)
+	// ClaimInbound records an inbound delivery id; it reports false when
+	// the id was seen before. Ids recorded before expired are dropped.
+	ClaimInbound(ctx context.Context, id string, expired time.Time) (bool, error)
+	// ReleaseInbound forgets an inbound delivery id whose message could not
+	// be posted, so the sender can retry it.
+	ReleaseInbound(ctx context.Context, id string) error
+}
+
+type webhookRepository struct {
+	db connectors.SqliteConnector
+}
+
+func NewWebhookRepository(db connectors.SqliteConnector) WebhookRepository {
+	return &webhookRepository{db}
+}
+
+func (repo *webhookRepository) CreateSubscription(ctx context.Context, sub *models.Subscription) error {
+	if sub.ID == "" {
+		sub.ID = ids.New()
+	}
+	return repo.db.DB(ctx).Create(sub).Error
+}
+
+func (repo *webhookRepository) GetSubscription(ctx context.Context, id string) (*models.Subscription, error) {
+	var sub models.Subscription
+	err := repo.db.DB(ctx).Where("id = ?", id).First(&sub).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+func (repo *webhookRepository) ListSubscriptions(ctx context.Context, workspaceID string) ([]models.Subscription, error) {
+	query := repo.db.DB(ctx).Order("created_at")
+	if workspaceID != "" {
+		query = query.Where("workspace_id = ?", workspaceID)
+	}
+	subs := []models.Subscription{}
+	if err := query.Find(&subs).Error; err != nil {
+		return nil, err
+	}
+	return subs, nil
+}
+
+func (repo *webhookRepository) MatchSubscriptions(ctx context.Context, workspaceID, event string) ([]models.Subscription, error) {
+	var subs []models.Subscription
+	err := repo.db.DB(ctx).Where("(workspace_id = ? OR workspace_id = '') AND active = ?", workspaceID, true).Find(&subs).Error
+	if err != nil {
+		return nil, err
+	}
+	// the event filter is a JSON column, so it is applied here
+	matched := subs[:0]
+	for _, sub := range subs {
+		if sub.Wants(event) {
+			matched = append(matched, sub)
+		}
+	}
+	return matched, nil
+}
+
+func (repo *webhookRepository) UpdateSubscription(ctx context.Context, sub *models.Subscription) error {
+	return repo.db.DB(ctx).Model(sub).Select("url", "events", "active", "secret").Updates(sub).Error
+}
+
+func (repo *webhookRepository) DeleteSubscription(ctx context.Context, id string) error {
+	result := repo.db.DB(ctx).Where("id = ?", id).Delete(&models.Subscription{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (repo *webhookRepository) CreateDelivery(ctx context.Context, delivery *models.Delivery) error {
+	if delivery.ID == "" {
+		delivery.ID = ids.New()
+	}
+	return repo.db.DB(ctx).Create(delivery).Error
+}
+
+func (repo *webhookRepository) GetDelivery(ctx context.Context, id string) (*models.Delivery, error) {
+	var delivery models.Delivery
+	err := repo.db.DB(ctx).Where("id = ?", id).First(&delivery).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+func (repo *webhookRepository) ListDeliveries(ctx context.Context, subscriptionID string, limit, offset int) ([]models.Delivery, int64, error) {
+	query := repo.db.DB(ctx).Model(&models.Delivery{}).Where("subscription_id = ?", subscriptionID)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	deliveries := []models.Delivery{}
+	err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&deliveries).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return deliveries, total, nil
+}
+
+func (repo *webhookRepository) UpdateDelivery(ctx context.Context, delivery *models.Delivery) error {
+	return repo.db.DB(ctx).Model(delivery).
+		Select("status", "attempts", "job_id", "last_error", "delivered_at").
+		Updates(delivery).Error
+}
+
+func (repo *webhookRepository) RecordAttempt(ctx context.Context, attempt *models.DeliveryAttempt) error {
+	if attempt.ID == "" {
+		attempt.ID = ids.New()
+	}
+	if attempt.CreatedAt.IsZero() {
+		attempt.CreatedAt = time.Now()
+	}
+	return repo.db.DB(ctx).Create(attempt).Error
+}
+
+func (repo *webhookRepository) ListAttempts(ctx context.Context, deliveryID string) ([]models.DeliveryAttempt, error) {
+	attempts := []models.DeliveryAttempt{}
+	err := repo.db.DB(ctx).Where("delivery_id = ?", deliveryID).Order("attempt").Find(&attempts).Error
+	if err != nil {
+		return nil, err
+	}
+	return attempts, nil
+}
+
+func (repo *webhookRepository) ClaimInbound(ctx context.Context, id string, expired time.Time) (bool, error) {
+	if err := repo.db.DB(ctx).Where("created_at < ?", expired).Delete(&models.InboundDelivery{}).Error; err != nil {
+		return false, err
+	}
+	result := repo.db.DB(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&models.InboundDelivery{ID: id})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (repo *webhookRepository) ReleaseInbound(ctx context.Context, id string) error {
+	return repo.db.DB(ctx).Where("id = ?", id).Delete(&models.InboundDelivery{}).Error
+}
@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	models "github.com/sdutt/agentserver/models/widgets"
+	"github.com/sdutt/agentserver/pkg/connectors"
+	"github.com/sdutt/agentserver/pkg/ids"
+	"gorm.io/gorm"
+)
+
+type WidgetRepository interface {
+	CreateWidget(ctx context.Context, widget *models.Widget) error
+	GetWidget(ctx context.Context, id string) (*models.Widget, error)
+	GetWidgetByKey(ctx context.Context, key string) (*models.Widget, error)
+	ListWidgets(ctx context.Context, agentID, workspaceID string) ([]models.Widget, error)
+	UpdateWidget(ctx context.Context, widget *models.Widget) error
+	DeleteWidget(ctx context.Context, id string) error
+	CreateSession(ctx context.Context, session *models.VisitorSession) error
+	// GetSession finds an unexpired session by the hash of its token.
+	GetSession(ctx context.Context, tokenHash string) (*models.VisitorSession, error)
+	TouchSession(ctx context.Context, id string) error
+}
+
+type widgetRepository struct {
+	db connectors.SqliteConnector
+}
+
+func NewWidgetRepository(db connectors.SqliteConnector) WidgetRepository {
+	return &widgetRepository{db}
+}
+
+func (repo *widgetRepository) CreateWidget(ctx context.Context, widget *models.Widget) error {
+	if widget.ID == "" {
+		widget.ID = ids.New()
+	}
+	return repo.db.DB(ctx).Create(widget).Error
+}
+
+func (repo *widgetRepository) GetWidget(ctx context.Context, id string) (*models.Widget, error) {
+	return repo.findWidget(ctx, "id = ?", id)
+}
+
+func (repo *widgetRepository) GetWidgetByKey(ctx context.Context, key string) (*models.Widget, error) {
+	return repo.findWidget(ctx, "publishable_key = ?", key)
+}
+
+func (repo *widgetRepository) findWidget(ctx context.Context, query string, arg string) (*models.Widget, error) {
+	var widget models.Widget
+	err := repo.db.DB(ctx).Where(query, arg).First(&widget).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &widget, nil
+}
+
+func (repo *widgetRepository) ListWidgets(ctx context.Context, agentID, workspaceID string) ([]models.Widget, error) {
+	query := repo.db.DB(ctx).Order("created_at")
+	if agentID != "" {
+		query = query.Where("agent_id = ?", agentID)
+	}
+	if workspaceID != "" {
+		query = query.Where("workspace_id = ?", workspaceID)
+	}
+	widgets := []models.Widget{}
+	if err := query.Find(&widgets).Error; err != nil {
+		return nil, err
+	}
+	return widgets, nil
+}
+
+func (repo *widgetRepository) UpdateWidget(ctx context.Context, widget *models.Widget) error {
+	return repo.db.DB(ctx).Model(widget).
+		Select("name", "publishable_key", "allowed_domains", "greeting", "theme", "messages_per_minute", "sessions_per_hour", "active").
+		Updates(widget).Error
+}
+
+func (repo *widgetRepository) DeleteWidget(ctx context.Context, id string) error {
+	result := repo.db.DB(ctx).Where("id = ?", id).Delete(&models.Widget{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (repo *widgetRepository) CreateSession(ctx context.Context, session *models.VisitorSession) error {
+	if session.ID == "" {
+		session.ID = ids.New()
+	}
+	return repo.db.DB(ctx).Create(session).Error
+}
+
+func (repo *widgetRepository) GetSession(ctx context.Context, tokenHash string) (*models.VisitorSession, error) {
+	var session models.VisitorSession
+	err := repo.db.DB(ctx).Where("token_hash = ? AND expires_at > ?", tokenHash, time.Now()).First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (repo *widgetRepository) TouchSession(ctx context.Context, id string) error {
+	return repo.db.DB(ctx).Model(&models.VisitorSession{}).Where("id = ?", id).Update("last_seen_at", time.Now()).Error
+}
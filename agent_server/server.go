@@ -3,7 +3,10 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -13,8 +16,23 @@ import (
 	"github.com/quic-go/webtransport-go"
 	"github.com/sdutt/agentserver/api"
 	clients "github.com/sdutt/agentserver/clients/lyzr"
+	"github.com/sdutt/agentserver/clients/openai"
 	"github.com/sdutt/agentserver/configs"
+	"github.com/sdutt/agentserver/pkg/broker"
+	"github.com/sdutt/agentserver/pkg/cache"
+	"github.com/sdutt/agentserver/pkg/channels"
+	"github.com/sdutt/agentserver/pkg/channels/email"
+	"github.com/sdutt/agentserver/pkg/chat"
 	"github.com/sdutt/agentserver/pkg/connectors"
+	"github.com/sdutt/agentserver/pkg/export"
+	"github.com/sdutt/agentserver/pkg/jobs"
+	"github.com/sdutt/agentserver/pkg/mirror"
+	"github.com/sdutt/agentserver/pkg/presence"
+	"github.com/sdutt/agentserver/pkg/providers"
+	"github.com/sdutt/agentserver/pkg/tokens"
+	"github.com/sdutt/agentserver/pkg/webhooks"
+	"github.com/sdutt/agentserver/pkg/widgets"
+	"github.com/sdutt/agentserver/repository"
 )
 
 type Server struct {
@@ -24,14 +42,71 @@ type Server struct {
 	E         *gin.Engine
 	S         *http3.Server
 	WS        *webtransport.Server
+	Presence  *presence.Tracker
+	Broker    broker.Broker
+	Cache     cache.Cache
+	Jobs      *jobs.Queue
+	Channels  *channels.Manager
+	Mirror    *mirror.Mirror
+	Exports   *export.Exporter
 }
 
 type routerOpts struct {
 	router      *gin.Engine
 	config      *configs.AppConfig
 	lyzr_client *clients.LyzrClient
+	providers   *providers.Registry
+	cache       *cache.Loader
+	limiter     *widgets.Limiter
+	mirror      *mirror.Mirror
 	ws          *webtransport.Server
 	mux         *http.ServeMux
+	db          connectors.SqliteConnector
+	chat        *chat.Service
+	presence    *presence.Tracker
+	jobs        *jobs.Queue
+	exporter    *export.Exporter
+	webhooks    *webhooks.Dispatcher
+}
+
+// trustedProxies splits the comma separated TRUSTED_PROXIES setting. An
+// empty list trusts no proxy.
+func trustedProxies(setting string) []string {
+	var proxies []string
+	for _, proxy := range strings.Split(setting, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
+// newProviders puts Lyzr, the default agent provider, and the
+// OpenAI-compatible one, if configured, behind a registry.
+func newProviders(config *configs.AppConfig, lyzr_client *clients.LyzrClient, db connectors.SqliteConnector, loader *cache.Loader) *providers.Registry {
+	local := repository.NewLocalAgentRepository(db)
+	registry := providers.NewRegistry(providers.Lyzr(lyzr_client), local, loader, &config.Cache)
+	if config.OpenAI.BaseURL != "" {
+		registry.Register(providers.OpenAI(openai.NewClient(&config.OpenAI, local, openai.WithUserAgent(config.Name+"/"+config.Version))))
+	}
+	return registry
+}
+
+func newChatService(config *configs.AppConfig, registry *providers.Registry, db connectors.SqliteConnector, tracker *presence.Tracker, b broker.Broker, queue *jobs.Queue, dispatcher *webhooks.Dispatcher, prices *tokens.Prices) *chat.Service {
+	conversations := repository.NewConversationRepository(db)
+	return chat.NewService(
+		registry,
+		conversations,
+		repository.NewFeedbackRepository(db),
+		repository.NewAgentCallRepository(db),
+		prices,
+		chat.NewContextBuilder(&config.Context, registry, conversations, queue),
+		chat.NewHub(b),
+		tracker,
+		queue,
+		dispatcher,
+		config.OperatorKey,
+	)
 }
 
 func NewServer(config *configs.AppConfig) (*Server, error) {
@@ -39,8 +114,13 @@ func NewServer(config *configs.AppConfig) (*Server, error) {
 		config: config,
 	}
 
-	server.AllConnectors()
+	if err := server.AllConnectors(); err != nil {
+		return nil, err
+	}
 	router := gin.Default()
+	if err := router.SetTrustedProxies(trustedProxies(config.TrustedProxies)); err != nil {
+		return nil, fmt.Errorf("TRUSTED_PROXIES: %w", err)
+	}
 	router.Use(cors.New(cors.Config{
 		AllowAllOrigins:  true, // <--- Allows all origins
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
@@ -48,7 +128,11 @@ func NewServer(config *configs.AppConfig) (*Server, error) {
 		AllowCredentials: true,
 		// Optionally set more fields here
 	}))
-	lyzr_client := clients.NewLyzrClient(config)
+	var lyzrOptions []clients.Option
+	if config.LogLevel == "debug" {
+		lyzrOptions = append(lyzrOptions, clients.WithMiddleware(clients.LogRequests))
+	}
+	lyzr_client := clients.NewLyzrClient(config, lyzrOptions...)
 
 	cert, err := tls.LoadX509KeyPair(config.CertPath, config.KeyPath)
 
@@ -82,41 +166,204 @@ func NewServer(config *configs.AppConfig) (*Server, error) {
 	}
 
 	server.E = router
+	server.Presence = presence.NewTracker(config.PresenceAwayAfter, config.PresenceRetention, server.Broker)
+	server.Jobs = jobs.NewQueue(&config.Jobs, repository.NewJobRepository(server.DB))
 
+	dispatcher := webhooks.NewDispatcher(&config.Webhooks, repository.NewWebhookRepository(server.DB), server.Jobs)
+	prices, err := tokens.ParsePrices(config.Pricing.ModelPrices)
+	if err != nil {
+		return nil, fmt.Errorf("PRICING__MODEL_PRICES: %w", err)
+	}
+	loader := cache.NewLoader(server.Cache)
+	registry := newProviders(config, lyzr_client, server.DB, loader)
+	server.Mirror = mirror.NewMirror(&config.AgentSync, registry, repository.NewAgentMirrorRepository(server.DB), dispatcher)
+	server.Exports = export.NewExporter(&config.Jobs, repository.NewConversationRepository(server.DB))
 	opts := &routerOpts{
 		router:      router,
 		config:      config,
 		lyzr_client: lyzr_client,
+		providers:   registry,
+		cache:       loader,
+		limiter:     widgets.NewLimiter(server.Cache),
+		mirror:      server.Mirror,
 		ws:          server.WS,
 		mux:         mux,
+		db:          server.DB,
+		chat:        newChatService(config, registry, server.DB, server.Presence, server.Broker, server.Jobs, dispatcher, prices),
+		presence:    server.Presence,
+		jobs:        server.Jobs,
+		exporter:    server.Exports,
+		webhooks:    dispatcher,
 	}
+	server.Jobs.Register(chat.KindAgentReply, opts.chat.HandleReply)
+	server.Jobs.Register(chat.KindSummarize, opts.chat.Contexts().HandleSummarize)
+	server.Jobs.Register(export.KindExport, opts.exporter.Handle)
+	server.Jobs.Register(webhooks.KindDelivery, dispatcher.Handle)
+
+	server.Channels = channels.NewManager(opts.chat, repository.NewConversationRepository(server.DB), repository.NewChannelRepository(server.DB))
+	if config.Email.Enabled {
+		if config.Email.AgentID == "" {
+			return nil, errors.New("EMAIL__AGENT_ID is required when email is enabled")
+		}
+		server.Channels.Register(email.NewAdapter(&config.Email), channels.Target{
+			AgentID:     config.Email.AgentID,
+			WorkspaceID: config.Email.WorkspaceID,
+		})
+	}
+	server.Jobs.Register(chat.KindChannelSend, server.Channels.HandleSend)
 
 	server.setupRouter(opts)
 	// server.WS.H3.Handler = server.E
 	return server, nil
 }
 
-func (s *Server) AllConnectors() {
+func (s *Server) AllConnectors() error {
 	sql := connectors.NewSqliteConnector(&s.config.DbConfig)
 	s.DB = sql
+	b, err := broker.New(s.config)
+	if err != nil {
+		return err
+	}
+	s.Broker = b
+	c, err := cache.New(&s.config.Cache)
+	if err != nil {
+		return err
+	}
+	s.Cache = c
+	return nil
 }
 
 func (server *Server) setupRouter(opts *routerOpts) {
 	apiv1 := opts.router.Group("/v1/")
+	server.addHealthRoutes(apiv1, opts)
 	server.addAgentRoutes(apiv1, opts)
+	server.addProviderRoutes(apiv1, opts)
 	server.addCredentialRoutes(apiv1, opts)
+	server.addConversationRoutes(apiv1, opts)
+	server.addSearchRoutes(apiv1, opts)
+	server.addFeedbackRoutes(apiv1, opts)
+	server.addMetricsRoutes(apiv1, opts)
+	server.addPresenceRoutes(apiv1, opts)
+	server.addJobRoutes(apiv1, opts)
+	server.addWebhookRoutes(apiv1, opts)
+	server.addInboundRoutes(apiv1, opts)
+	server.addWidgetRoutes(apiv1, opts)
+	server.addPublicRoutes(apiv1, opts)
+}
+
+func (server *Server) addHealthRoutes(grp *gin.RouterGroup, opts *routerOpts) {
+	healthHandler := api.NewHealthApi(opts.config, opts.providers)
+	grp.GET("/health", healthHandler.Health)
 }
 
 func (server *Server) addAgentRoutes(grp *gin.RouterGroup, opts *routerOpts) {
-	agentHandler := api.NewAgentApi(opts.config, opts.lyzr_client, opts.ws)
+	agentHandler := api.NewAgentApi(opts.config, opts.providers, opts.mirror, opts.ws, opts.chat, opts.webhooks)
 	grp.POST("/agents", agentHandler.CreateAgent)
 	grp.GET("/agents", agentHandler.ListAgents)
 	grp.GET("/agents/chat", agentHandler.ChatWs)
-	// opts.router.GET("/agents/chat", agentHandler.Chat)
-	// opts.mux.HandleFunc("/agents/chat", agentHandler.Chat)
+	grp.POST("/agents/sync", agentHandler.SyncAgents)
+	grp.GET("/agents/sync", agentHandler.ListSyncs)
+	grp.GET("/agents/:id", agentHandler.GetAgent)
+	grp.PUT("/agents/:id", agentHandler.UpdateAgent)
+	grp.PATCH("/agents/:id", agentHandler.PatchAgent)
+	grp.DELETE("/agents/:id", agentHandler.DeleteAgent)
+	grp.PUT("/agents/:id/metadata", agentHandler.SetMetadata)
+	opts.mux.HandleFunc("/v1/agents/chat", agentHandler.Chat)
+}
+
+func (server *Server) addProviderRoutes(grp *gin.RouterGroup, opts *routerOpts) {
+	providerHandler := api.NewProvidersApi(opts.config, opts.providers)
+	grp.GET("/providers", providerHandler.ListProviders)
 }
 
 func (server *Server) addCredentialRoutes(grp *gin.RouterGroup, opts *routerOpts) {
-	credentialHandler := api.NewCredentialsApi(opts.config, opts.lyzr_client)
+	credentialHandler := api.NewCredentialsApi(opts.config, opts.lyzr_client, opts.cache)
 	grp.POST("/credentials", credentialHandler.CreateCredential)
+	grp.GET("/credentials", credentialHandler.ListCredentials)
+	grp.GET("/credentials/:id", credentialHandler.GetCredential)
+	grp.POST("/credentials/:id/rotate", credentialHandler.RotateCredential)
+	grp.DELETE("/credentials/:id", credentialHandler.DeleteCredential)
+}
+
+func (server *Server) addConversationRoutes(grp *gin.RouterGroup, opts *routerOpts) {
+	conversationHandler := api.NewConversationsApi(opts.config, repository.NewConversationRepository(opts.db), opts.chat, opts.jobs, repository.NewJobRepository(opts.db), opts.exporter)
+	grp.GET("/conversations/export", conversationHandler.ExportConversations)
+	grp.POST("/conversations/exports", conversationHandler.QueueExport)
+	grp.GET("/conversations/exports/:job_id", conversationHandler.DownloadExport)
+	grp.GET("/conversations/:id/export", conversationHandler.ExportConversation)
+	grp.GET("/conversations/:id/messages", conversationHandler.ListMessages)
+	grp.PATCH("/conversations/:id/messages/:message_id", conversationHandler.EditMessage)
+	grp.DELETE("/conversations/:id/messages/:message_id", conversationHandler.DeleteMessage)
+	grp.GET("/conversations/:id/messages/:message_id/edits", conversationHandler.ListEdits)
+	grp.POST("/conversations/:id/messages/:message_id/regenerate", conversationHandler.RegenerateMessage)
+	grp.GET("/conversations/:id/messages/:message_id/context", conversationHandler.MessageContext)
+	grp.POST("/conversations/:id/escalate", conversationHandler.Escalate)
+	grp.POST("/conversations/:id/resolve", conversationHandler.Resolve)
+	grp.GET("/conversations/:id/read-state", conversationHandler.ReadStates)
+}
+
+func (server *Server) addSearchRoutes(grp *gin.RouterGroup, opts *routerOpts) {
+	searchHandler := api.NewSearchApi(opts.config, repository.NewSearchRepository(opts.db))
+	grp.GET("/search/messages", searchHandler.SearchMessages)
+}
+
+func (server *Server) addFeedbackRoutes(grp *gin.RouterGroup, opts *routerOpts) {
+	feedbackHandler := api.NewFeedbackApi(opts.config, repository.NewFeedbackRepository(opts.db), opts.chat)
+	grp.POST("/conversations/:id/messages/:message_id/feedback", feedbackHandler.RateMessage)
+	grp.GET("/agents/:id/feedback", feedbackHandler.AgentFeedback)
+}
+
+func (server *Server) addMetricsRoutes(grp *gin.RouterGroup, opts *routerOpts) {
+	metricsHandler := api.NewMetricsApi(opts.config, repository.NewMetricsRepository(opts.db))
+	grp.GET("/agents/:id/metrics", metricsHandler.AgentMetrics)
+}
+
+func (server *Server) addPresenceRoutes(grp *gin.RouterGroup, opts *routerOpts) {
+	presenceHandler := api.NewPresenceApi(opts.config, opts.presence)
+	grp.GET("/presence", presenceHandler.ListPresence)
+}
+
+func (server *Server) addJobRoutes(grp *gin.RouterGroup, opts *routerOpts) {
+	jobsHandler := api.NewJobsApi(opts.config, repository.NewJobRepository(opts.db))
+	grp.GET("/admin/jobs", jobsHandler.ListJobs)
+	grp.GET("/admin/jobs/:id", jobsHandler.GetJob)
+	grp.POST("/admin/jobs/:id/retry", jobsHandler.RetryJob)
+}
+
+func (server *Server) addWebhookRoutes(grp *gin.RouterGroup, opts *routerOpts) {
+	webhooksHandler := api.NewWebhooksApi(opts.config, repository.NewWebhookRepository(opts.db), opts.webhooks)
+	grp.POST("/webhooks", webhooksHandler.CreateSubscription)
+	grp.GET("/webhooks", webhooksHandler.ListSubscriptions)
+	grp.GET("/webhooks/:id", webhooksHandler.GetSubscription)
+	grp.PATCH("/webhooks/:id", webhooksHandler.UpdateSubscription)
+	grp.DELETE("/webhooks/:id", webhooksHandler.DeleteSubscription)
+	grp.GET("/webhooks/:id/deliveries", webhooksHandler.ListDeliveries)
+	grp.GET("/webhooks/deliveries/:delivery_id", webhooksHandler.GetDelivery)
+	grp.POST("/webhooks/deliveries/:delivery_id/redeliver", webhooksHandler.Redeliver)
+}
+
+func (server *Server) addInboundRoutes(grp *gin.RouterGroup, opts *routerOpts) {
+	inboundHandler := api.NewInboundApi(opts.config, opts.chat, repository.NewWebhookRepository(opts.db))
+	grp.POST("/inbound/messages", inboundHandler.PostMessage)
+}
+
+func (server *Server) addWidgetRoutes(grp *gin.RouterGroup, opts *routerOpts) {
+	widgetsHandler := api.NewWidgetsApi(opts.config, repository.NewWidgetRepository(opts.db))
+	grp.POST("/widgets", widgetsHandler.CreateWidget)
+	grp.GET("/widgets", widgetsHandler.ListWidgets)
+	grp.GET("/widgets/:id", widgetsHandler.GetWidget)
+	grp.PATCH("/widgets/:id", widgetsHandler.UpdateWidget)
+	grp.DELETE("/widgets/:id", widgetsHandler.DeleteWidget)
+	grp.POST("/widgets/:id/rotate-key", widgetsHandler.RotateKey)
+}
+
+// addPublicRoutes serves embedded widgets; nothing else is reachable with a
+// publishable key or visitor token.
+func (server *Server) addPublicRoutes(grp *gin.RouterGroup, opts *routerOpts) {
+	publicHandler := api.NewPublicApi(opts.config, repository.NewWidgetRepository(opts.db), repository.NewConversationRepository(opts.db), opts.chat, opts.limiter)
+	grp.GET("/public/widgets/:key", publicHandler.GetWidget)
+	grp.POST("/public/sessions", publicHandler.CreateSession)
+	grp.GET("/public/messages", publicHandler.ListMessages)
+	grp.POST("/public/messages", publicHandler.PostMessage)
+	grp.GET("/public/chat", publicHandler.Chat)
 }
@@ -13,7 +13,7 @@ import (
 
 func Test() {
 	// Change to match your endpoint:
-	url := "https://agent.chat.app:6122/agents/chat"
+	url := "https://agent.chat.app:6122/v1/agents/chat"
 
 	cert, err := tls.LoadX509KeyPair("../cert.pem", "../key.pem")
 